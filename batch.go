@@ -0,0 +1,160 @@
+package jsonpatch
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// BatchOptions configures ApplyBatch and ApplyBatchSeq.
+type BatchOptions struct {
+	// Workers is the number of documents patched concurrently. Zero means
+	// runtime.GOMAXPROCS(0).
+	Workers int
+	// MaxFailures aborts the batch once this many documents failed to patch.
+	// Zero means no limit.
+	MaxFailures int
+}
+
+// BatchResult is the outcome of patching one document of a batch.
+type BatchResult struct {
+	// Index is the position of the document in the input.
+	Index int
+	// Document is the patched copy of the document, or nil if Err is set.
+	Document any
+	// Err is the *Error that stopped the patch, or the batch's error for
+	// documents ApplyBatch did not get to.
+	Err error
+}
+
+// ErrBatchAborted is returned when a batch stops after BatchOptions.MaxFailures failures.
+var ErrBatchAborted = errors.New("jsonpatch: batch aborted after too many failures")
+
+// ApplyBatch applies patch to a copy of each of docs with a pool of workers
+// and returns one result per document, in input order. The patch is compiled
+// once; compile errors are returned before any document is patched.
+//
+// The error is ErrBatchAborted if the batch stopped after MaxFailures
+// failures, or a *Error wrapping ctx.Err() if ctx was done by the end of the
+// batch. Either way the results of the documents that were not patched carry
+// the same error.
+func ApplyBatch(ctx context.Context, docs []any, patch Patch, opts BatchOptions) ([]BatchResult, error) {
+	compiled, err := Compile(patch)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]BatchResult, len(docs))
+	done := make([]bool, len(docs))
+	err = compiled.applyBatch(ctx, slices.Values(docs), opts, func(r BatchResult) bool {
+		results[r.Index] = r
+		done[r.Index] = true
+		return true
+	})
+	if err != nil {
+		for i := range results {
+			if !done[i] {
+				results[i] = BatchResult{Index: i, Err: err}
+			}
+		}
+	}
+	return results, err
+}
+
+// ApplyBatchSeq is like ApplyBatch but reads documents from docs as workers
+// become free and passes each result to fn as soon as it is ready, so results
+// arrive out of order. fn is called from the calling goroutine, one result at
+// a time; returning false stops the batch, in which case ApplyBatchSeq returns nil.
+func ApplyBatchSeq(ctx context.Context, docs iter.Seq[any], patch Patch, opts BatchOptions, fn func(BatchResult) bool) error {
+	compiled, err := Compile(patch)
+	if err != nil {
+		return err
+	}
+	return compiled.applyBatch(ctx, docs, opts, fn)
+}
+
+type batchJob struct {
+	index int
+	doc   any
+}
+
+func (p *CompiledPatch) applyBatch(ctx context.Context, docs iter.Seq[any], opts BatchOptions, fn func(BatchResult) bool) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// stop only ends the feeding of new documents; documents already handed
+	// to a worker are patched under ctx and still reported.
+	feedCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	jobs := make(chan batchJob)
+	results := make(chan BatchResult)
+	var exhausted bool
+	go func() {
+		defer close(jobs)
+		i := 0
+		for doc := range docs {
+			// select picks among ready cases at random, so check first that
+			// feeding has not been stopped.
+			if feedCtx.Err() != nil {
+				return
+			}
+			select {
+			case jobs <- batchJob{index: i, doc: doc}:
+			case <-feedCtx.Done():
+				return
+			}
+			i++
+		}
+		exhausted = true
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				doc, err := p.apply(ctx, job.doc)
+				results <- BatchResult{Index: job.index, Document: doc, Err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var failures int
+	var batchErr error
+	stopped := false
+	for r := range results {
+		if stopped {
+			continue // drain the workers
+		}
+		if !fn(r) {
+			stopped = true
+			stop()
+			continue
+		}
+		if r.Err != nil {
+			failures++
+			if opts.MaxFailures > 0 && failures >= opts.MaxFailures && batchErr == nil {
+				batchErr = ErrBatchAborted
+				stop()
+			}
+		}
+	}
+	switch {
+	case stopped:
+		return nil
+	case batchErr != nil:
+		return batchErr
+	case !exhausted || ctx.Err() != nil:
+		return &Error{Index: -1, Err: ctx.Err()}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package jsonpatch_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestApplyBatch(t *testing.T) {
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/v", Value: 2.0},
+		{Op: jsonpatch.Add, Path: "/tags/-", Value: "migrated"},
+	}
+	var docs []any
+	for i := 0; i < 100; i++ {
+		if i%10 == 3 {
+			docs = append(docs, map[string]any{"tags": []any{}})
+			continue
+		}
+		docs = append(docs, map[string]any{"v": 1.0, "tags": []any{}})
+	}
+	results, err := jsonpatch.ApplyBatch(context.Background(), docs, patch, jsonpatch.BatchOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("ApplyBatch: %v", err)
+	}
+	want := map[string]any{"v": 2.0, "tags": []any{"migrated"}}
+	for i, r := range results {
+		if r.Index != i {
+			t.Fatalf("results[%d].Index = %d", i, r.Index)
+		}
+		if i%10 == 3 {
+			var perr *jsonpatch.Error
+			if !errors.As(r.Err, &perr) || perr.Index != 0 {
+				t.Errorf("results[%d].Err = %v, want *Error at index 0", i, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil || !reflect.DeepEqual(r.Document, want) {
+			t.Errorf("results[%d] = %v, %v", i, r.Document, r.Err)
+		}
+	}
+	if !reflect.DeepEqual(docs[0], map[string]any{"v": 1.0, "tags": []any{}}) {
+		t.Fatalf("input modified: %v", docs[0])
+	}
+}
+
+func TestApplyBatchMaxFailures(t *testing.T) {
+	docs := make([]any, 1000)
+	for i := range docs {
+		docs[i] = map[string]any{}
+	}
+	results, err := jsonpatch.ApplyBatch(context.Background(), docs,
+		jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/missing"}}, jsonpatch.BatchOptions{Workers: 2, MaxFailures: 5})
+	if !errors.Is(err, jsonpatch.ErrBatchAborted) {
+		t.Fatalf("error = %v, want ErrBatchAborted", err)
+	}
+	skipped := 0
+	for _, r := range results {
+		if errors.Is(r.Err, jsonpatch.ErrBatchAborted) {
+			skipped++
+		}
+	}
+	if skipped < len(docs)-10 {
+		t.Fatalf("%d documents skipped, want nearly all", skipped)
+	}
+}
+
+func TestApplyBatchContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := jsonpatch.ApplyBatch(ctx, []any{map[string]any{}}, jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/a", Value: 1.0}}, jsonpatch.BatchOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+
+	if _, err := jsonpatch.ApplyBatch(context.Background(), nil, jsonpatch.Patch{{Op: "bogus", Path: "/a"}}, jsonpatch.BatchOptions{}); err == nil {
+		t.Fatal("ApplyBatch with an invalid patch succeeded")
+	}
+}
+
+func TestApplyBatchSeq(t *testing.T) {
+	docs := func(yield func(any) bool) {
+		for i := 0; i < 50; i++ {
+			if !yield(map[string]any{"n": float64(i)}) {
+				return
+			}
+		}
+	}
+	seen := make(map[int]bool)
+	err := jsonpatch.ApplyBatchSeq(context.Background(), docs, jsonpatch.Patch{{Op: jsonpatch.Copy, From: "/n", Path: "/m"}},
+		jsonpatch.BatchOptions{Workers: 3}, func(r jsonpatch.BatchResult) bool {
+			if r.Err != nil {
+				t.Errorf("document %d: %v", r.Index, r.Err)
+			}
+			if m := r.Document.(map[string]any)["m"]; m != float64(r.Index) {
+				t.Errorf("document %d: m = %v", r.Index, m)
+			}
+			seen[r.Index] = true
+			return len(seen) < 20
+		})
+	if err != nil {
+		t.Fatalf("ApplyBatchSeq: %v", err)
+	}
+	if len(seen) != 20 {
+		t.Fatalf("fn called for %d documents after stopping at 20", len(seen))
+	}
+}
@@ -0,0 +1,302 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// Provenance identifies the write that produced a value.
+type Provenance struct {
+	// Revision, Actor and Time describe the patch, as passed to Blame.Record.
+	Revision uint64
+	Actor    string
+	Time     time.Time
+	// Op is the delta operation (add, replace or remove) and Index the
+	// position in the patch of the operation that produced it.
+	Op    Op
+	Index int
+}
+
+// BlameEntry is a location and the write that last set it.
+type BlameEntry struct {
+	Path string
+	Provenance
+}
+
+// Blame maps every location of a document to the patch that last wrote it.
+// It mirrors the document's structure and is kept current by recording the
+// Diff of each applied patch, so array elements keep their provenance when
+// inserts and removals shift them. Move and copy are recorded as the add and
+// remove deltas Prepare reports, so moved values are attributed to the move.
+//
+// A Blame is safe for concurrent use.
+type Blame struct {
+	mu   sync.RWMutex
+	root *blameNode
+}
+
+// blameNode mirrors one value of the document. prov is set where a write
+// replaced the value as a whole and inherited from the parent otherwise;
+// changed is the latest write at or below the node.
+type blameNode struct {
+	prov    *Provenance
+	changed *Provenance
+	members map[string]*blameNode // objects
+	elems   []*blameNode          // arrays
+	array   bool
+}
+
+// NewBlame returns a Blame for document, attributing all of its values to origin.
+func NewBlame(document any, origin Provenance) (*Blame, error) {
+	doc, err := normalizeJSONInput(document)
+	if err != nil {
+		return nil, err
+	}
+	p := origin
+	root := newBlameNode(doc)
+	root.prov, root.changed = &p, &p
+	return &Blame{root: root}, nil
+}
+
+func newBlameNode(value any) *blameNode {
+	switch v := value.(type) {
+	case map[string]any:
+		n := &blameNode{members: make(map[string]*blameNode, len(v))}
+		for k, e := range v {
+			n.members[k] = newBlameNode(e)
+		}
+		return n
+	case []any:
+		n := &blameNode{array: true, elems: make([]*blameNode, len(v))}
+		for i, e := range v {
+			n.elems[i] = newBlameNode(e)
+		}
+		return n
+	case *OrderedObject:
+		n := &blameNode{members: make(map[string]*blameNode, len(v.keys))}
+		for _, k := range v.keys {
+			n.members[k] = newBlameNode(v.values[k])
+		}
+		return n
+	}
+	return &blameNode{}
+}
+
+// Record attributes the deltas of diff, the result of preparing a patch
+// against the document as it is now, to the patch described by p. It fails,
+// leaving the Blame unchanged, if a delta does not fit the document, which
+// means the Blame and the document are out of sync.
+func (b *Blame) Record(diff Diff, p Provenance) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The deltas are applied to copies of the nodes they touch, which replace
+	// the recorded tree only once all of them fit.
+	root, copied := b.root, make(map[*blameNode]bool)
+	for i, d := range diff.Deltas {
+		prov := p
+		prov.Op, prov.Index = d.Op, d.Index
+		var err error
+		if root, err = applyBlame(root, d, &prov, copied); err != nil {
+			return fmt.Errorf("jsonpatch: blame delta %d (%s '%s'): %w", i, d.Op, d.Path, err)
+		}
+	}
+	b.root = root
+	return nil
+}
+
+// applyBlame applies d to the tree at root, copying the nodes it changes that
+// are not in copied yet, and returns the new root.
+func applyBlame(root *blameNode, d Delta, p *Provenance, copied map[*blameNode]bool) (*blameNode, error) {
+	tokens, err := jsonpointer.New(d.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		if d.Op == Remove {
+			return nil, fmt.Errorf("cannot remove the document root")
+		}
+		root = newBlameNode(d.After)
+		root.prov, root.changed = p, p
+		return root, nil
+	}
+
+	root = root.copy(copied)
+	root.changed = p
+	parent := root
+	for _, tok := range tokens[:len(tokens)-1] {
+		child := parent.child(tok)
+		if child == nil {
+			return nil, fmt.Errorf("path not found")
+		}
+		child = child.copy(copied)
+		child.changed = p
+		parent.setChild(tok, child)
+		parent = child
+	}
+
+	last := tokens[len(tokens)-1]
+	var written *blameNode
+	if d.Op != Remove {
+		written = newBlameNode(d.After)
+		written.prov, written.changed = p, p
+	}
+	if !parent.array {
+		if parent.members == nil {
+			return nil, fmt.Errorf("cannot address '%s' in a scalar", last)
+		}
+		if d.Op == Remove {
+			delete(parent.members, last)
+		} else {
+			parent.members[last] = written
+		}
+		return root, nil
+	}
+
+	idx, err := strconv.Atoi(last)
+	if last == "-" {
+		idx, err = len(parent.elems), nil
+	}
+	if err != nil || idx < 0 || idx > len(parent.elems) || (d.Op != Add && idx == len(parent.elems)) {
+		return nil, fmt.Errorf("array index '%s' out of range", last)
+	}
+	switch d.Op {
+	case Add:
+		parent.elems = append(parent.elems, nil)
+		copy(parent.elems[idx+1:], parent.elems[idx:])
+		parent.elems[idx] = written
+	case Replace:
+		parent.elems[idx] = written
+	case Remove:
+		parent.elems = append(parent.elems[:idx], parent.elems[idx+1:]...)
+	}
+	return root, nil
+}
+
+// copy returns n if it is in copied and otherwise a copy of n whose members
+// and elements can be changed without affecting n, adding it to copied.
+func (n *blameNode) copy(copied map[*blameNode]bool) *blameNode {
+	if copied[n] {
+		return n
+	}
+	c := *n
+	c.members = maps.Clone(n.members)
+	c.elems = slices.Clone(n.elems)
+	copied[&c] = true
+	return &c
+}
+
+// setChild replaces the existing child at token.
+func (n *blameNode) setChild(token string, c *blameNode) {
+	if !n.array {
+		n.members[token] = c
+		return
+	}
+	idx, _ := arrayIndex(token, len(n.elems))
+	n.elems[idx] = c
+}
+
+func (n *blameNode) child(token string) *blameNode {
+	if !n.array {
+		return n.members[token]
+	}
+	idx, err := arrayIndex(token, len(n.elems))
+	if err != nil {
+		return nil
+	}
+	return n.elems[idx]
+}
+
+// find returns the node at path and the provenance it inherits or sets.
+func (b *Blame) find(path string) (*blameNode, *Provenance, error) {
+	tokens, err := jsonpointer.New(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, prov := b.root, b.root.prov
+	for _, tok := range tokens {
+		if n = n.child(tok); n == nil {
+			return nil, nil, nil
+		}
+		if n.prov != nil {
+			prov = n.prov
+		}
+	}
+	return n, prov, nil
+}
+
+// Lookup returns the write that set the value at path: the last patch that
+// wrote path itself or one of its ancestors. ok is false if path does not
+// exist in the document.
+func (b *Blame) Lookup(path string) (p Provenance, ok bool, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n, prov, err := b.find(path)
+	if n == nil {
+		return Provenance{}, false, err
+	}
+	return *prov, true, nil
+}
+
+// LastChanged returns the latest write that changed the value at path or
+// anything below it, including removals.
+func (b *Blame) LastChanged(path string) (p Provenance, ok bool, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n, prov, err := b.find(path)
+	if n == nil {
+		return Provenance{}, false, err
+	}
+	if n.changed != nil {
+		prov = n.changed
+	}
+	return *prov, true, nil
+}
+
+// Subtree returns the location path and every location below it that was
+// written as a whole, with their provenance, depth first with array elements
+// in order and object members sorted by name. Locations not listed inherit
+// the provenance of the nearest listed ancestor.
+func (b *Blame) Subtree(path string) ([]BlameEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n, prov, err := b.find(path)
+	if n == nil {
+		if err == nil {
+			err = fmt.Errorf("jsonpatch: path '%s' not found", path)
+		}
+		return nil, err
+	}
+	entries := []BlameEntry{{Path: path, Provenance: *prov}}
+	var walk func(n *blameNode, path string)
+	walk = func(n *blameNode, path string) {
+		visit := func(c *blameNode, p string) {
+			if c.prov != nil {
+				entries = append(entries, BlameEntry{Path: p, Provenance: *c.prov})
+			}
+			walk(c, p)
+		}
+		if n.array {
+			for i, c := range n.elems {
+				visit(c, path+"/"+strconv.Itoa(i))
+			}
+			return
+		}
+		keys := make([]string, 0, len(n.members))
+		for k := range n.members {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			visit(n.members[k], joinPath(path, k))
+		}
+	}
+	walk(n, path)
+	return entries, nil
+}
@@ -0,0 +1,132 @@
+package jsonpatch_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+// blameHistory applies patches in order, recording each as the next revision.
+func blameHistory(t *testing.T, doc any, patches ...jsonpatch.Patch) *jsonpatch.Blame {
+	t.Helper()
+	blame, err := jsonpatch.NewBlame(doc, jsonpatch.Provenance{Actor: "init"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, patch := range patches {
+		diff, err := jsonpatch.Prepare(doc, patch)
+		if err != nil {
+			t.Fatalf("Prepare %d: %v", i+1, err)
+		}
+		if err := blame.Record(diff, jsonpatch.Provenance{Revision: uint64(i + 1), Actor: fmt.Sprint("user", i+1)}); err != nil {
+			t.Fatalf("Record %d: %v", i+1, err)
+		}
+		if doc, err = jsonpatch.Apply(doc, patch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return blame
+}
+
+func TestBlameLookup(t *testing.T) {
+	doc := map[string]any{
+		"spec":     map[string]any{"replicas": 1.0, "image": "v1"},
+		"metadata": map[string]any{"name": "svc"},
+	}
+	blame := blameHistory(t, doc,
+		jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/spec/replicas", Value: 3.0}},
+		jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/metadata/labels", Value: map[string]any{"a": "b"}}},
+		jsonpatch.Patch{
+			{Op: jsonpatch.Test, Path: "/spec/image", Value: "v1"},
+			{Op: jsonpatch.Remove, Path: "/metadata/name"},
+		},
+	)
+
+	for _, tt := range []struct {
+		path, lookup, changed string
+	}{
+		{"/spec/replicas", "user1 replace 0", "user1 replace 0"},
+		{"/spec/image", "init  0", "init  0"},
+		{"/spec", "init  0", "user1 replace 0"},
+		{"/metadata/labels/a", "user2 add 0", "user2 add 0"},
+		{"/metadata", "init  0", "user3 remove 1"},
+		{"", "init  0", "user3 remove 1"},
+	} {
+		p, ok, err := blame.Lookup(tt.path)
+		if got := fmt.Sprintf("%s %s %d", p.Actor, p.Op, p.Index); err != nil || !ok || got != tt.lookup {
+			t.Errorf("Lookup(%q) = %s, %v, %v; want %s", tt.path, got, ok, err, tt.lookup)
+		}
+		p, ok, err = blame.LastChanged(tt.path)
+		if got := fmt.Sprintf("%s %s %d", p.Actor, p.Op, p.Index); err != nil || !ok || got != tt.changed {
+			t.Errorf("LastChanged(%q) = %s, %v, %v; want %s", tt.path, got, ok, err, tt.changed)
+		}
+	}
+	if _, ok, _ := blame.Lookup("/metadata/name"); ok {
+		t.Error("Lookup of a removed member succeeded")
+	}
+}
+
+func TestBlameArrayShifts(t *testing.T) {
+	doc := map[string]any{"items": []any{"a", "b", "c"}}
+	blame := blameHistory(t, doc,
+		jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/items/2", Value: "C"}},
+		jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/items/0", Value: "z"}},
+		jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/items/1"}},
+		jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/items/-", Value: "end"}},
+		jsonpatch.Patch{{Op: jsonpatch.Move, From: "/items/0", Path: "/items/2"}},
+	)
+	// items: [b C z end]
+	want := []string{"init", "user1", "user5", "user4"}
+	for i, w := range want {
+		p, ok, err := blame.Lookup(fmt.Sprintf("/items/%d", i))
+		if err != nil || !ok || p.Actor != w {
+			t.Errorf("Lookup(/items/%d) = %s, %v, %v; want %s", i, p.Actor, ok, err, w)
+		}
+	}
+
+	entries, err := blame.Subtree("/items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Path+"="+e.Actor)
+	}
+	if s := strings.Join(got, " "); s != "/items=init /items/1=user1 /items/2=user5 /items/3=user4" {
+		t.Fatalf("Subtree = %s", s)
+	}
+}
+
+func TestBlameOutOfSync(t *testing.T) {
+	blame, err := jsonpatch.NewBlame(map[string]any{}, jsonpatch.Provenance{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := jsonpatch.Prepare(map[string]any{"a": map[string]any{}}, jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/a/b", Value: 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blame.Record(diff, jsonpatch.Provenance{Revision: 1}); err == nil {
+		t.Fatal("Record of a delta under a missing parent succeeded")
+	}
+
+	// A failing Record leaves the deltas before the failing one unrecorded.
+	diff, err = jsonpatch.Prepare(map[string]any{"a": map[string]any{}}, jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/x", Value: 1.0},
+		{Op: jsonpatch.Add, Path: "/a/b", Value: 1.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blame.Record(diff, jsonpatch.Provenance{Revision: 2}); err == nil {
+		t.Fatal("Record of a delta under a missing parent succeeded")
+	}
+	if _, ok, _ := blame.Lookup("/x"); ok {
+		t.Fatal("failed Record recorded /x")
+	}
+	if p, _, _ := blame.LastChanged(""); p.Revision != 0 {
+		t.Fatalf("failed Record changed the root: %+v", p)
+	}
+}
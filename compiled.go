@@ -0,0 +1,315 @@
+package jsonpatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// CompiledPatch is a validated patch prepared for repeated application: its
+// pointers are parsed and its values decoded once, by Compile. It does not
+// support the extended paths of WithPathExpansion or relative pointers.
+//
+// A CompiledPatch is immutable and safe for concurrent use.
+type CompiledPatch struct {
+	ops   []compiledOp
+	patch Patch
+}
+
+type compiledOp struct {
+	op       Op
+	path     jsonpointer.Pointer
+	from     jsonpointer.Pointer
+	value    any
+	expected []byte // JSON encoding of value, for test
+}
+
+// Compile validates patch and prepares it for repeated application. Errors
+// are reported as *Error identifying the invalid operation.
+func Compile(patch Patch) (*CompiledPatch, error) {
+	c := &CompiledPatch{ops: make([]compiledOp, len(patch)), patch: patch}
+	for i, op := range patch {
+		cop, err := compileOperation(op)
+		if err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Err: err}
+		}
+		c.ops[i] = cop
+	}
+	return c, nil
+}
+
+func compileOperation(op Operation) (compiledOp, error) {
+	c := compiledOp{op: op.Op}
+	var err error
+	if c.path, c.from, err = parseOperation(op.Op, op.Path, op.From); err != nil {
+		return c, err
+	}
+	if op.Op == Add || op.Op == Replace || op.Op == Test {
+		if c.value, err = normalizeJSONInput(op.Value); err != nil {
+			return c, err
+		}
+		if op.Op == Test {
+			if c.expected, err = json.Marshal(c.value); err != nil {
+				return c, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// parseOperation parses the pointers of an operation and rejects operations
+// that can never succeed, whatever the document.
+func parseOperation(op Op, path, from string) (p, f jsonpointer.Pointer, err error) {
+	if p, err = jsonpointer.New(path); err != nil {
+		return nil, nil, err
+	}
+	switch op {
+	case Add, Replace, Test:
+	case Move, Copy:
+		if f, err = jsonpointer.New(from); err != nil {
+			return nil, nil, err
+		}
+		if op == Move && len(p) > len(f) && hasTokenPrefix(p, f) {
+			return nil, nil, fmt.Errorf("cannot move '%s' into its own child '%s'", from, path)
+		}
+	case Remove:
+		if len(p) == 0 {
+			return nil, nil, fmt.Errorf("cannot remove the document root")
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported patch operation: %s", op)
+	}
+	return p, f, nil
+}
+
+// Patch returns the patch p was compiled from.
+func (p *CompiledPatch) Patch() Patch {
+	return p.patch
+}
+
+// Apply applies the patch to a copy of document, which is not changed.
+func (p *CompiledPatch) Apply(document any) (any, error) {
+	return p.apply(context.Background(), document)
+}
+
+func (p *CompiledPatch) apply(ctx context.Context, document any) (any, error) {
+	if isOrderedDocument(document) {
+		return applyOrdered(cloneValue(document), p.patch, &options{ctx: ctx})
+	}
+	doc, ok, err := cloneValueContext(ctx, document)
+	if err != nil {
+		return nil, &Error{Index: -1, Err: err}
+	}
+	if !ok {
+		if doc, err = deepCopyAny(document); err != nil {
+			return nil, fmt.Errorf("failed to copy document: %w", err)
+		}
+	}
+	return p.ApplyInPlace(doc)
+}
+
+// ApplyInPlace applies the patch to document, modifying it. document must be
+// in encoding/json's representation.
+func (p *CompiledPatch) ApplyInPlace(document any) (any, error) {
+	if isOrderedDocument(document) {
+		return applyOrdered(document, p.patch, &options{})
+	}
+	var err error
+	for i := range p.ops {
+		if document, err = p.ops[i].apply(document); err != nil {
+			return nil, &Error{Index: i, Op: p.ops[i].op, Err: err}
+		}
+	}
+	return document, nil
+}
+
+func (c *compiledOp) apply(document any) (any, error) {
+	switch c.op {
+	case Add:
+		return addTokens(document, c.path, cloneValue(c.value))
+	case Remove:
+		return removeTokens(document, c.path)
+	case Replace:
+		if _, err := getTokens(document, c.path); err != nil {
+			return nil, err
+		}
+		return setTokens(document, c.path, cloneValue(c.value))
+	case Move:
+		if len(c.path) == len(c.from) && hasTokenPrefix(c.path, c.from) {
+			return document, nil
+		}
+		v, err := getTokens(document, c.from)
+		if err != nil {
+			return nil, err
+		}
+		if document, err = removeTokens(document, c.from); err != nil {
+			return nil, err
+		}
+		return addTokens(document, c.path, v)
+	case Copy:
+		v, err := getTokens(document, c.from)
+		if err != nil {
+			return nil, err
+		}
+		return addTokens(document, c.path, cloneValue(v))
+	default: // Test
+		actual, err := getTokens(document, c.path)
+		if err != nil {
+			return nil, err
+		}
+		actualBytes, err := json.Marshal(actual)
+		if err != nil {
+			return nil, err
+		}
+		if string(actualBytes) != string(c.expected) {
+			return nil, fmt.Errorf("test failed: expected %v, got %v", c.value, actual)
+		}
+		return document, nil
+	}
+}
+
+func hasTokenPrefix(tokens, prefix []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if tokens[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// getTokens returns the value at the location identified by tokens.
+func getTokens(document any, tokens []string) (any, error) {
+	current := document
+	for i, tok := range tokens {
+		switch c := current.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("path '%s' not found", jsonpointer.Pointer(tokens[:i+1]).String())
+			}
+			current = v
+		case *OrderedObject:
+			v, ok := c.Get(tok)
+			if !ok {
+				return nil, fmt.Errorf("path '%s' not found", jsonpointer.Pointer(tokens[:i+1]).String())
+			}
+			current = v
+		case []any:
+			idx, err := arrayIndex(tok, len(c))
+			if err != nil {
+				return nil, fmt.Errorf("path '%s' not found: %w", jsonpointer.Pointer(tokens[:i+1]).String(), err)
+			}
+			current = c[idx]
+		default:
+			return nil, fmt.Errorf("path '%s' not found: cannot address a %s", jsonpointer.Pointer(tokens[:i+1]).String(), jsonTypeName(current))
+		}
+	}
+	return current, nil
+}
+
+// getPointer returns the value at path, which may pass through ordered objects.
+func getPointer(document any, path string) (any, error) {
+	tokens, err := jsonpointer.New(path)
+	if err != nil {
+		return nil, err
+	}
+	return getTokens(document, tokens)
+}
+
+// setTokens stores value at an existing array element or any object member
+// and returns the possibly replaced document.
+func setTokens(document any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := getTokens(document, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch c := parent.(type) {
+	case map[string]any:
+		c[last] = value
+	case []any:
+		idx, err := arrayIndex(last, len(c))
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = value
+	default:
+		return nil, fmt.Errorf("cannot set '%s' in a %s", last, jsonTypeName(parent))
+	}
+	return document, nil
+}
+
+// addTokens implements add: it sets an object member or inserts into an array.
+func addTokens(document any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentTokens := tokens[:len(tokens)-1]
+	parent, err := getTokens(document, parentTokens)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch c := parent.(type) {
+	case map[string]any:
+		c[last] = value
+		return document, nil
+	case []any:
+		idx := len(c)
+		if last != "-" {
+			i, err := jsonpointer.ParseArrayIndex(last)
+			if err != nil {
+				return nil, err
+			}
+			if i > uint64(len(c)) {
+				return nil, fmt.Errorf("add operation on array index %d is out of bounds for array of length %d", i, len(c))
+			}
+			idx = int(i)
+		}
+		arr := make([]any, 0, len(c)+1)
+		arr = append(arr, c[:idx]...)
+		arr = append(arr, value)
+		arr = append(arr, c[idx:]...)
+		return setTokens(document, parentTokens, arr)
+	}
+	return nil, fmt.Errorf("cannot add '%s' to a %s", last, jsonTypeName(parent))
+}
+
+// removeTokens deletes an object member or array element.
+func removeTokens(document any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("cannot remove the document root")
+	}
+	parentTokens := tokens[:len(tokens)-1]
+	parent, err := getTokens(document, parentTokens)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch c := parent.(type) {
+	case map[string]any:
+		if _, ok := c[last]; !ok {
+			return nil, fmt.Errorf("path '%s' not found", jsonpointer.Pointer(tokens).String())
+		}
+		delete(c, last)
+		return document, nil
+	case []any:
+		idx, err := arrayIndex(last, len(c))
+		if err != nil {
+			return nil, err
+		}
+		arr := make([]any, 0, len(c)-1)
+		arr = append(arr, c[:idx]...)
+		arr = append(arr, c[idx+1:]...)
+		return setTokens(document, parentTokens, arr)
+	}
+	return nil, fmt.Errorf("cannot remove '%s' from a %s", last, jsonTypeName(parent))
+}
@@ -0,0 +1,126 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestCompiledPatchMatchesApply(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+	}{
+		{`{"a":"b"}`, `[{"op":"add","path":"/c","value":{"d":[1]}}]`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"},{"op":"add","path":"/foo/-","value":1}]`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`},
+		{`{"foo":["a","b","c","d"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`},
+		{`{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`},
+		{`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"},{"op":"test","path":"/a","value":{"b":1}}]`},
+		{`[1,{"x":null}]`, `[{"op":"replace","path":"/1/x","value":[true]},{"op":"test","path":"/0","value":1}]`},
+		{`{"a":1}`, `[{"op":"replace","path":"","value":["root"]}]`},
+	}
+	for _, tt := range tests {
+		var doc any
+		var patch jsonpatch.Patch
+		if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		want, err := jsonpatch.Apply(doc, patch)
+		if err != nil {
+			t.Fatalf("Apply(%s, %s): %v", tt.doc, tt.patch, err)
+		}
+		compiled, err := jsonpatch.Compile(patch)
+		if err != nil {
+			t.Fatalf("Compile(%s): %v", tt.patch, err)
+		}
+		got, err := compiled.Apply(doc)
+		if err != nil {
+			t.Fatalf("CompiledPatch.Apply(%s, %s): %v", tt.doc, tt.patch, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("CompiledPatch.Apply(%s, %s) = %v, want %v", tt.doc, tt.patch, got, want)
+		}
+	}
+}
+
+func TestCompiledPatchValuesAreNotShared(t *testing.T) {
+	compiled, err := jsonpatch.Compile(jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/list", Value: []any{1.0}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := compiled.ApplyInPlace(map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.(map[string]any)["list"].([]any)[0] = "changed"
+	second, err := compiled.ApplyInPlace(map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := second.(map[string]any)["list"].([]any)[0]; got != 1.0 {
+		t.Fatalf("second application saw %v, want 1", got)
+	}
+}
+
+func TestCompiledPatchConcurrent(t *testing.T) {
+	compiled, err := jsonpatch.Compile(jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/n/-", Value: 1.0},
+		{Op: jsonpatch.Copy, From: "/n", Path: "/m"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]any{"n": []any{0.0}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := compiled.Apply(doc); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if !reflect.DeepEqual(doc, map[string]any{"n": []any{0.0}}) {
+		t.Fatalf("input modified: %v", doc)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for i, patch := range []jsonpatch.Patch{
+		{{Op: "frobnicate", Path: "/a"}},
+		{{Op: jsonpatch.Add, Path: "a"}},
+		{{Op: jsonpatch.Copy, From: "x", Path: "/a"}},
+		{{Op: jsonpatch.Move, From: "/a", Path: "/a/b"}},
+		{{Op: jsonpatch.Remove, Path: ""}},
+		{{Op: jsonpatch.Add, Path: "/a", Value: make(chan int)}},
+	} {
+		_, err := jsonpatch.Compile(append(jsonpatch.Patch{{Op: jsonpatch.Test, Path: "", Value: nil}}, patch...))
+		var perr *jsonpatch.Error
+		if !errors.As(err, &perr) || perr.Index != 1 {
+			t.Errorf("case %d: error = %v, want *Error at index 1", i, err)
+		}
+	}
+
+	compiled, err := jsonpatch.Compile(jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/missing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var perr *jsonpatch.Error
+	if _, err := compiled.Apply(map[string]any{}); !errors.As(err, &perr) || perr.Index != 0 {
+		t.Fatalf("error = %v, want *Error at index 0", err)
+	}
+}
@@ -0,0 +1,121 @@
+package jsonpatch
+
+import (
+	"context"
+	"io"
+)
+
+// pollInterval is how many loop iterations pass between context checks in hot loops.
+const pollInterval = 1024
+
+// pollContext checks ctx on every pollInterval-th iteration i.
+func pollContext(ctx context.Context, i int) error {
+	if i%pollInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// ApplyContext is like Apply but stops with a *Error wrapping ctx.Err() once ctx
+// is done. The context is checked between operations and while copying the document.
+func ApplyContext(ctx context.Context, document any, patch Patch, opts ...Option) (any, error) {
+	o := newOptions(opts)
+	o.ctx = ctx
+	return apply(document, patch, o)
+}
+
+// NewContext is like New but stops with a *Error wrapping ctx.Err() once ctx is
+// done. The context is checked periodically while diffing objects and arrays.
+func NewContext(ctx context.Context, a, b any) (Patch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &Error{Index: -1, Err: err}
+	}
+	na, err := normalizeJSONInput(a)
+	if err != nil {
+		return nil, err
+	}
+	nb, err := normalizeJSONInput(b)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := diffValue(ctx, "", na, nb)
+	if err != nil {
+		return nil, &Error{Index: -1, Err: err}
+	}
+	return patch, nil
+}
+
+// ApplyStreamContext is like ApplyStream but stops once ctx is done, including
+// while the document is still being read from reader or written to writer.
+func ApplyStreamContext(ctx context.Context, reader io.Reader, writer io.Writer, patch Patch, opts ...Option) error {
+	o := newOptions(opts)
+	o.ctx = ctx
+	return applyStream(&contextReader{ctx: ctx, r: reader}, &contextWriter{ctx: ctx, w: writer}, patch, o)
+}
+
+// contextReader fails reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, &Error{Index: -1, Err: err}
+	}
+	return cr.r.Read(p)
+}
+
+// contextWriter fails writes once its context is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, &Error{Index: -1, Err: err}
+	}
+	return cw.w.Write(p)
+}
+
+// cloneValueContext deep-copies a document in encoding/json's representation,
+// checking ctx periodically. It reports ok=false when it meets a value outside
+// that representation, in which case the caller falls back to a JSON round trip.
+func cloneValueContext(ctx context.Context, value any) (out any, ok bool, err error) {
+	n := 0
+	var clone func(v any) (any, bool, error)
+	clone = func(v any) (any, bool, error) {
+		n++
+		if err := pollContext(ctx, n); err != nil {
+			return nil, false, err
+		}
+		switch tv := v.(type) {
+		case map[string]any:
+			cp := make(map[string]any, len(tv))
+			for k, e := range tv {
+				c, ok, err := clone(e)
+				if !ok || err != nil {
+					return nil, ok, err
+				}
+				cp[k] = c
+			}
+			return cp, true, nil
+		case []any:
+			cp := make([]any, len(tv))
+			for i, e := range tv {
+				c, ok, err := clone(e)
+				if !ok || err != nil {
+					return nil, ok, err
+				}
+				cp[i] = c
+			}
+			return cp, true, nil
+		case nil, bool, float64, string:
+			return tv, true, nil
+		default:
+			return nil, false, nil
+		}
+	}
+	return clone(value)
+}
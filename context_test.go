@@ -0,0 +1,125 @@
+package jsonpatch_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestApplyContext(t *testing.T) {
+	doc := map[string]any{"a": []any{1.0, 2.0}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/a/-", Value: 3.0},
+		{Op: jsonpatch.Remove, Path: "/a/0"},
+	}
+
+	result, err := jsonpatch.ApplyContext(context.Background(), doc, patch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{"a": []any{2.0, 3.0}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+	if !reflect.DeepEqual(doc, map[string]any{"a": []any{1.0, 2.0}}) {
+		t.Errorf("original document was modified: %v", doc)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = jsonpatch.ApplyContext(ctx, doc, patch)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	var patchErr *jsonpatch.Error
+	if !errors.As(err, &patchErr) {
+		t.Fatalf("expected *jsonpatch.Error, got %T", err)
+	}
+}
+
+// countdownContext reports cancellation after its Err method was called n times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	c.n--
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestApplyContextCancelledBetweenOperations(t *testing.T) {
+	patch := make(jsonpatch.Patch, 0, 10)
+	for i := 0; i < 10; i++ {
+		patch = append(patch, jsonpatch.Operation{Op: jsonpatch.Add, Path: "/k", Value: float64(i)})
+	}
+
+	ctx := &countdownContext{Context: context.Background(), n: 3}
+	_, err := jsonpatch.ApplyContext(ctx, map[string]any{}, patch)
+	var patchErr *jsonpatch.Error
+	if !errors.As(err, &patchErr) {
+		t.Fatalf("expected *jsonpatch.Error, got %v", err)
+	}
+	if patchErr.Index != 2 {
+		t.Errorf("expected cancellation before operation 2, got %d", patchErr.Index)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	var a, b []any
+	for i := 0; i < 5000; i++ {
+		a = append(a, float64(i))
+		b = append(b, float64((i+7)%5000))
+	}
+
+	patch, err := jsonpatch.NewContext(context.Background(), a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := jsonpatch.Apply(a, patch)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Error("patch from NewContext does not transform a into b")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := jsonpatch.NewContext(ctx, a, b); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestApplyStreamContext(t *testing.T) {
+	var out bytes.Buffer
+	patch := jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/b", Value: "e"}}
+	if err := jsonpatch.ApplyStreamContext(context.Background(), strings.NewReader(`{"a":"b"}`), &out, patch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != `{"a":"b","b":"e"}` {
+		t.Errorf("unexpected output %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out.Reset()
+	err := jsonpatch.ApplyStreamContext(ctx, strings.NewReader(`{"a":"b"}`), &out, patch)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output after cancellation, got %q", out.String())
+	}
+}
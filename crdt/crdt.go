@@ -0,0 +1,370 @@
+// Package crdt implements a JSON CRDT that converges without a central
+// server. Objects are observed-remove maps, arrays are RGA sequences and
+// every value held by a member or element is a last-writer-wins register.
+//
+// Local changes are made with JSON Patches, which are translated to CRDT
+// operations stamped with the replica's actor and a Lamport counter. Replicas
+// exchange operations with OpsSince and ApplyOps, or Merge, and all replicas
+// that have seen the same operations hold the same document. PatchSince
+// exports the changes since any prior state as a JSON Patch.
+package crdt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrMissingDependency is returned for operations that refer to values the
+// replica has not seen, because operations they depend on were not applied
+// before them.
+var ErrMissingDependency = errors.New("crdt: missing dependency")
+
+// ID identifies an operation and the value or element it creates. IDs are
+// ordered by counter and then by actor.
+type ID struct {
+	Counter uint64 `json:"counter"`
+	Actor   string `json:"actor"`
+}
+
+// Less reports whether id orders before other.
+func (id ID) Less(other ID) bool {
+	if id.Counter != other.Counter {
+		return id.Counter < other.Counter
+	}
+	return id.Actor < other.Actor
+}
+
+func (id ID) String() string {
+	return fmt.Sprintf("%d@%s", id.Counter, id.Actor)
+}
+
+// Root is the ID of the root object of every document.
+var Root = ID{}
+
+// Action is the kind of an Op.
+type Action string
+
+const (
+	// ActionSet assigns a value to an object member or array element.
+	ActionSet Action = "set"
+	// ActionInsert inserts an array element.
+	ActionInsert Action = "insert"
+	// ActionDelete removes an object member or array element.
+	ActionDelete Action = "delete"
+)
+
+// Kind is the kind of container an Op creates.
+type Kind string
+
+const (
+	KindObject Kind = "object"
+	KindArray  Kind = "array"
+)
+
+// Op is one CRDT operation. Operations are plain data and can be encoded as
+// JSON to exchange them between replicas.
+type Op struct {
+	ID     ID     `json:"id"`
+	Action Action `json:"action"`
+	// Obj is the object or array the operation changes.
+	Obj ID `json:"obj"`
+	// Key is the member of an object.
+	Key string `json:"key,omitempty"`
+	// Elem is the element of an array: the element to set or delete, or the
+	// element to insert after, with the zero ID meaning the start.
+	Elem ID `json:"elem,omitzero"`
+	// Make creates an empty object or array with the operation's ID instead
+	// of a scalar Value.
+	Make  Kind `json:"make,omitempty"`
+	Value any  `json:"value,omitempty"`
+	// Pred are the values the operation overwrites or deletes, as observed by
+	// its replica. Values assigned concurrently are not in Pred and survive.
+	Pred []ID `json:"pred,omitempty"`
+}
+
+// Clock records, per actor, the highest counter of the operations a replica
+// has applied. It identifies a state of the document.
+type Clock map[string]uint64
+
+// Includes reports whether the operation id is part of the state c.
+func (c Clock) Includes(id ID) bool {
+	return id.Counter <= c[id.Actor]
+}
+
+// node is a value of the document.
+type node struct {
+	kind    Kind // empty for scalars
+	value   any
+	members map[string]*slot
+	elems   []*elem
+}
+
+// tagged is a value assigned by the operation tag.
+type tagged struct {
+	tag ID
+	n   *node
+}
+
+// slot is a register holding the values assigned to a member or element and
+// not yet overwritten. The value with the highest tag wins; an empty slot is
+// deleted.
+type slot struct {
+	values []tagged
+}
+
+func (s *slot) winner() *tagged {
+	var best *tagged
+	for i := range s.values {
+		if best == nil || best.tag.Less(s.values[i].tag) {
+			best = &s.values[i]
+		}
+	}
+	return best
+}
+
+func (s *slot) tags() []ID {
+	tags := make([]ID, len(s.values))
+	for i, v := range s.values {
+		tags[i] = v.tag
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Less(tags[j]) })
+	return tags
+}
+
+func (s *slot) remove(pred []ID) {
+	kept := s.values[:0]
+	for _, v := range s.values {
+		removed := false
+		for _, p := range pred {
+			if v.tag == p {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, v)
+		}
+	}
+	s.values = kept
+}
+
+// elem is an array element in RGA order; deleted elements stay as tombstones
+// so concurrent inserts after them keep their place.
+type elem struct {
+	id ID
+	slot
+}
+
+// Doc is one replica of a JSON CRDT document. Its root is always an object.
+//
+// A Doc is safe for concurrent use.
+type Doc struct {
+	mu      sync.Mutex
+	actor   string
+	counter uint64
+	nodes   map[ID]*node
+	log     []Op
+	clock   Clock
+}
+
+// NewDoc returns an empty document replica for actor, which must be unique
+// among the replicas of the document.
+func NewDoc(actor string) *Doc {
+	return &Doc{
+		actor: actor,
+		nodes: map[ID]*node{Root: {kind: KindObject, members: make(map[string]*slot)}},
+		clock: make(Clock),
+	}
+}
+
+// Actor returns the actor of the replica.
+func (d *Doc) Actor() string {
+	return d.actor
+}
+
+// Clock returns the state of the replica.
+func (d *Doc) Clock() Clock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := make(Clock, len(d.clock))
+	for a, n := range d.clock {
+		c[a] = n
+	}
+	return c
+}
+
+// OpsSince returns the operations applied by the replica that are not part of
+// state c, in an order that respects their dependencies.
+func (d *Doc) OpsSince(c Clock) []Op {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ops []Op
+	for _, op := range d.log {
+		if !c.Includes(op.ID) {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// ApplyOps applies operations received from other replicas, skipping those
+// already applied. The operations must include everything they depend on
+// that the replica has not seen; otherwise ApplyOps stops with
+// ErrMissingDependency, keeping the operations applied before.
+func (d *Doc) ApplyOps(ops []Op) error {
+	ops = append([]Op(nil), ops...)
+	// Lamport order respects dependencies.
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].ID.Less(ops[j].ID) })
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, op := range ops {
+		if d.clock.Includes(op.ID) {
+			continue
+		}
+		if err := d.apply(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merge applies the operations of other that the replica has not seen.
+func (d *Doc) Merge(other *Doc) error {
+	return d.ApplyOps(other.OpsSince(d.Clock()))
+}
+
+// apply applies op, which must not have been applied before. Callers hold d.mu.
+func (d *Doc) apply(op Op) error {
+	obj, ok := d.nodes[op.Obj]
+	if !ok || obj.kind == "" {
+		return fmt.Errorf("%w: operation %s targets unknown container %s", ErrMissingDependency, op.ID, op.Obj)
+	}
+	var s *slot
+	switch {
+	case op.Action == ActionInsert:
+		if obj.kind != KindArray {
+			return fmt.Errorf("crdt: operation %s inserts into an object", op.ID)
+		}
+		pos := 0
+		if op.Elem != (ID{}) {
+			if pos = obj.find(op.Elem) + 1; pos == 0 {
+				return fmt.Errorf("%w: operation %s inserts after unknown element %s", ErrMissingDependency, op.ID, op.Elem)
+			}
+		}
+		// RGA: elements inserted concurrently after the same element are
+		// ordered by descending ID, and elements inserted after those
+		// have higher IDs still.
+		for pos < len(obj.elems) && op.ID.Less(obj.elems[pos].id) {
+			pos++
+		}
+		e := &elem{id: op.ID}
+		obj.elems = append(obj.elems, nil)
+		copy(obj.elems[pos+1:], obj.elems[pos:])
+		obj.elems[pos] = e
+		s = &e.slot
+	case obj.kind == KindObject:
+		if s = obj.members[op.Key]; s == nil {
+			s = &slot{}
+			obj.members[op.Key] = s
+		}
+	default:
+		i := obj.find(op.Elem)
+		if i < 0 {
+			return fmt.Errorf("%w: operation %s targets unknown element %s", ErrMissingDependency, op.ID, op.Elem)
+		}
+		s = &obj.elems[i].slot
+	}
+
+	s.remove(op.Pred)
+	if op.Action != ActionDelete {
+		n := &node{kind: op.Make, value: op.Value}
+		switch op.Make {
+		case KindObject:
+			n.members = make(map[string]*slot)
+		case KindArray:
+		case "":
+		default:
+			return fmt.Errorf("crdt: operation %s makes unknown kind %q", op.ID, op.Make)
+		}
+		if op.Make != "" {
+			d.nodes[op.ID] = n
+		}
+		s.values = append(s.values, tagged{tag: op.ID, n: n})
+	}
+
+	d.log = append(d.log, op)
+	if op.ID.Counter > d.clock[op.ID.Actor] {
+		d.clock[op.ID.Actor] = op.ID.Counter
+	}
+	if op.ID.Counter > d.counter {
+		d.counter = op.ID.Counter
+	}
+	return nil
+}
+
+// find returns the position of the element id, or -1.
+func (n *node) find(id ID) int {
+	for i, e := range n.elems {
+		if e.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// visible returns the positions of the elements that are not deleted.
+func (n *node) visible() []int {
+	var out []int
+	for i, e := range n.elems {
+		if len(e.values) > 0 {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Value returns a copy of the current document.
+func (d *Doc) Value() any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.nodes[Root].materialize()
+}
+
+// ValueAt returns the document as it was in state c, which must be a state
+// the replica passed through, such as an earlier result of Clock.
+func (d *Doc) ValueAt(c Clock) (any, error) {
+	past := NewDoc(d.actor)
+	for _, op := range d.OpsSince(nil) {
+		if !c.Includes(op.ID) {
+			continue
+		}
+		if err := past.apply(op); err != nil {
+			return nil, err
+		}
+	}
+	return past.nodes[Root].materialize(), nil
+}
+
+func (n *node) materialize() any {
+	switch n.kind {
+	case KindObject:
+		out := make(map[string]any, len(n.members))
+		for k, s := range n.members {
+			if w := s.winner(); w != nil {
+				out[k] = w.n.materialize()
+			}
+		}
+		return out
+	case KindArray:
+		out := make([]any, 0, len(n.elems))
+		for _, e := range n.elems {
+			if w := e.winner(); w != nil {
+				out = append(out, w.n.materialize())
+			}
+		}
+		return out
+	}
+	return n.value
+}
@@ -0,0 +1,137 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+	"github.com/agentflare-ai/go-jsonpatch/crdt"
+)
+
+func applyPatch(t *testing.T, d *crdt.Doc, patch ...jsonpatch.Operation) []crdt.Op {
+	t.Helper()
+	ops, err := d.ApplyPatch(patch)
+	if err != nil {
+		t.Fatalf("%s: ApplyPatch: %v", d.Actor(), err)
+	}
+	return ops
+}
+
+func assertValue(t *testing.T, d *crdt.Doc, want string) {
+	t.Helper()
+	got, err := json.Marshal(d.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("%s: document = %s, want %s", d.Actor(), got, want)
+	}
+}
+
+func TestConcurrentEditsConverge(t *testing.T) {
+	a, b := crdt.NewDoc("A"), crdt.NewDoc("B")
+	applyPatch(t, a, jsonpatch.Operation{Op: jsonpatch.Add, Path: "", Value: map[string]any{"title": "t", "items": []any{"a", "b"}}})
+	if err := b.Merge(a); err != nil {
+		t.Fatal(err)
+	}
+
+	applyPatch(t, a,
+		jsonpatch.Operation{Op: jsonpatch.Add, Path: "/items/1", Value: "x"},
+		jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/title", Value: "A"},
+		jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/items/0", Value: "a2"},
+	)
+	applyPatch(t, b,
+		jsonpatch.Operation{Op: jsonpatch.Add, Path: "/items/1", Value: "y"},
+		jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/title", Value: "B"},
+		jsonpatch.Operation{Op: jsonpatch.Remove, Path: "/items/0"},
+	)
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Merge(a); err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent inserts after the same element are ordered by ID, the
+	// later title wins and the concurrent replace survives the remove.
+	const want = `{"items":["a2","y","x","b"],"title":"B"}`
+	assertValue(t, a, want)
+	assertValue(t, b, want)
+	if !reflect.DeepEqual(a.Clock(), b.Clock()) {
+		t.Fatalf("clocks differ: %v, %v", a.Clock(), b.Clock())
+	}
+}
+
+func TestOpsOverTheWire(t *testing.T) {
+	a := crdt.NewDoc("A")
+	var sent []crdt.Op
+	sent = append(sent, applyPatch(t, a, jsonpatch.Operation{Op: jsonpatch.Add, Path: "/cfg", Value: map[string]any{"ports": []any{80.0, map[string]any{"tls": true}}}})...)
+	sent = append(sent, applyPatch(t, a,
+		jsonpatch.Operation{Op: jsonpatch.Move, From: "/cfg/ports/1", Path: "/tls"},
+		jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/tls/tls", Value: false},
+	)...)
+
+	b, err := json.Marshal(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received []crdt.Op
+	if err := json.Unmarshal(b, &received); err != nil {
+		t.Fatal(err)
+	}
+	// Delivery order does not matter within one batch.
+	for i, j := 0, len(received)-1; i < j; i, j = i+1, j-1 {
+		received[i], received[j] = received[j], received[i]
+	}
+	c := crdt.NewDoc("C")
+	if err := c.ApplyOps(received); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ApplyOps(received); err != nil {
+		t.Fatalf("reapplying ops: %v", err)
+	}
+	assertValue(t, c, `{"cfg":{"ports":[80]},"tls":{"tls":false}}`)
+}
+
+func TestPatchSince(t *testing.T) {
+	a := crdt.NewDoc("A")
+	applyPatch(t, a, jsonpatch.Operation{Op: jsonpatch.Add, Path: "/list", Value: []any{1.0, 2.0, 3.0}})
+	before := a.Clock()
+	applyPatch(t, a,
+		jsonpatch.Operation{Op: jsonpatch.Remove, Path: "/list/0"},
+		jsonpatch.Operation{Op: jsonpatch.Add, Path: "/list/-", Value: 4.0},
+		jsonpatch.Operation{Op: jsonpatch.Add, Path: "/name", Value: "n"},
+	)
+
+	past, err := a.ValueAt(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := a.PatchSince(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jsonpatch.Apply(past, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, a.Value()) {
+		t.Fatalf("patched past = %v, want %v", got, a.Value())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	a := crdt.NewDoc("A")
+	if _, err := a.ApplyPatch(jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "", Value: []any{}}}); err == nil {
+		t.Fatal("replacing the root with an array succeeded")
+	}
+	if _, err := a.ApplyPatch(jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/missing"}}); err == nil {
+		t.Fatal("removing a missing member succeeded")
+	}
+	err := a.ApplyOps([]crdt.Op{{ID: crdt.ID{Counter: 2, Actor: "B"}, Action: crdt.ActionSet, Obj: crdt.ID{Counter: 1, Actor: "B"}, Key: "k", Value: 1.0}})
+	if !errors.Is(err, crdt.ErrMissingDependency) {
+		t.Fatalf("ApplyOps without its dependency = %v, want ErrMissingDependency", err)
+	}
+}
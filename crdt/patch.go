@@ -0,0 +1,218 @@
+package crdt
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// ApplyPatch applies patch to the replica as a local change and returns the
+// operations it was translated to, for sending to other replicas. The patch
+// is prepared against the current document first, so it is applied
+// atomically with the semantics and options of jsonpatch; move and copy
+// become the removes and adds they consist of.
+//
+// The root stays an object: replacing it with another value fails.
+func (d *Doc) ApplyPatch(patch jsonpatch.Patch, opts ...jsonpatch.Option) ([]Op, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	diff, err := jsonpatch.Prepare(d.nodes[Root].materialize(), patch, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, delta := range diff.Deltas {
+		if _, ok := delta.After.(map[string]any); delta.Path == "" && !ok {
+			return nil, fmt.Errorf("crdt: operation %d: the document root must remain an object", delta.Index)
+		}
+	}
+
+	t := translator{d: d}
+	for _, delta := range diff.Deltas {
+		if err := t.delta(delta); err != nil {
+			return t.ops, fmt.Errorf("crdt: operation %d (%s '%s'): %w", delta.Index, delta.Op, delta.Path, err)
+		}
+	}
+	return t.ops, nil
+}
+
+// PatchSince returns a JSON Patch that transforms the document as it was in
+// state c, such as an earlier result of Clock, into the current document.
+func (d *Doc) PatchSince(c Clock) (jsonpatch.Patch, error) {
+	past, err := d.ValueAt(c)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.New(past, d.Value())
+}
+
+// translator turns deltas into operations, applying each operation as it is
+// made so later deltas resolve against the updated document.
+type translator struct {
+	d   *Doc
+	ops []Op
+}
+
+func (t *translator) emit(op Op) error {
+	t.d.counter++
+	op.ID = ID{Counter: t.d.counter, Actor: t.d.actor}
+	if err := t.d.apply(op); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+func (t *translator) delta(delta jsonpatch.Delta) error {
+	tokens, err := jsonpointer.New(delta.Path)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		// Replace the root member by member.
+		root := t.d.nodes[Root]
+		for _, k := range sortedKeys(root.members) {
+			if s := root.members[k]; len(s.values) > 0 {
+				if err := t.emit(Op{Action: ActionDelete, Obj: Root, Key: k, Pred: s.tags()}); err != nil {
+					return err
+				}
+			}
+		}
+		after := delta.After.(map[string]any)
+		for _, k := range sortedKeys(after) {
+			if err := t.set(Op{Obj: Root, Key: k}, after[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	objID, obj, err := t.resolve(tokens[:len(tokens)-1])
+	if err != nil {
+		return err
+	}
+	last := tokens[len(tokens)-1]
+	if obj.kind == KindObject {
+		op := Op{Obj: objID, Key: last}
+		if s := obj.members[last]; s != nil {
+			op.Pred = s.tags()
+		}
+		if delta.Op == jsonpatch.Remove {
+			op.Action = ActionDelete
+			return t.emit(op)
+		}
+		return t.set(op, delta.After)
+	}
+
+	visible := obj.visible()
+	if delta.Op == jsonpatch.Add {
+		idx := len(visible)
+		if last != "-" {
+			if idx, err = strconv.Atoi(last); err != nil || idx < 0 || idx > len(visible) {
+				return fmt.Errorf("array index '%s' out of range", last)
+			}
+		}
+		op := Op{Action: ActionInsert, Obj: objID}
+		if idx > 0 {
+			op.Elem = obj.elems[visible[idx-1]].id
+		}
+		return t.set(op, delta.After)
+	}
+	idx, err := strconv.Atoi(last)
+	if err != nil || idx < 0 || idx >= len(visible) {
+		return fmt.Errorf("array index '%s' out of range", last)
+	}
+	e := obj.elems[visible[idx]]
+	op := Op{Obj: objID, Elem: e.id, Pred: e.tags()}
+	if delta.Op == jsonpatch.Remove {
+		op.Action = ActionDelete
+		return t.emit(op)
+	}
+	return t.set(op, delta.After)
+}
+
+// set emits op, an insert or a set, assigning value. Objects and arrays are
+// created empty and filled by further operations, so their members and
+// elements can be changed independently later.
+func (t *translator) set(op Op, value any) error {
+	if op.Action == "" {
+		op.Action = ActionSet
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		op.Make = KindObject
+		if err := t.emit(op); err != nil {
+			return err
+		}
+		id := t.ops[len(t.ops)-1].ID
+		for _, k := range sortedKeys(v) {
+			if err := t.set(Op{Obj: id, Key: k}, v[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		op.Make = KindArray
+		if err := t.emit(op); err != nil {
+			return err
+		}
+		id := t.ops[len(t.ops)-1].ID
+		var prev ID
+		for _, e := range v {
+			if err := t.set(Op{Action: ActionInsert, Obj: id, Elem: prev}, e); err != nil {
+				return err
+			}
+			prev = t.lastInsert(id)
+		}
+		return nil
+	}
+	op.Value = value
+	return t.emit(op)
+}
+
+// lastInsert returns the ID of the last insert into the array id.
+func (t *translator) lastInsert(id ID) ID {
+	for i := len(t.ops) - 1; i >= 0; i-- {
+		if t.ops[i].Action == ActionInsert && t.ops[i].Obj == id {
+			return t.ops[i].ID
+		}
+	}
+	return ID{}
+}
+
+// resolve returns the container at tokens.
+func (t *translator) resolve(tokens []string) (ID, *node, error) {
+	id, n := Root, t.d.nodes[Root]
+	for _, tok := range tokens {
+		var s *slot
+		switch n.kind {
+		case KindObject:
+			s = n.members[tok]
+		case KindArray:
+			visible := n.visible()
+			if i, err := strconv.Atoi(tok); err == nil && i >= 0 && i < len(visible) {
+				s = &n.elems[visible[i]].slot
+			}
+		}
+		if s == nil || s.winner() == nil {
+			return ID{}, nil, fmt.Errorf("path not found")
+		}
+		w := s.winner()
+		id, n = w.tag, w.n
+	}
+	if n.kind == "" {
+		return ID{}, nil, fmt.Errorf("cannot address a member of a scalar")
+	}
+	return id, n, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
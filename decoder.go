@@ -0,0 +1,119 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// PatchDecoder reads the operations of a JSON Patch document from a stream
+// one at a time, so that a large patch never has to be held in memory.
+type PatchDecoder struct {
+	dec     *json.Decoder
+	started bool
+	done    bool
+	index   int
+	err     error
+}
+
+// NewPatchDecoder returns a decoder reading a JSON array of operations from r.
+func NewPatchDecoder(r io.Reader) *PatchDecoder {
+	return &PatchDecoder{dec: json.NewDecoder(r)}
+}
+
+func (d *PatchDecoder) start() error {
+	if d.started || d.err != nil {
+		return d.err
+	}
+	d.started = true
+	tok, err := d.dec.Token()
+	if err != nil {
+		d.err = fmt.Errorf("jsonpatch: failed to decode patch: %w", err)
+	} else if tok != json.Delim('[') {
+		d.err = fmt.Errorf("jsonpatch: failed to decode patch: expected an array, got %v", tok)
+	}
+	return d.err
+}
+
+// More reports whether Next will return another operation or an error.
+func (d *PatchDecoder) More() bool {
+	if err := d.start(); err != nil {
+		return true
+	}
+	return !d.done && d.dec.More()
+}
+
+// Next decodes the next operation. It returns io.EOF after the last one.
+// Errors are sticky: once Next fails, it keeps returning the same error.
+func (d *PatchDecoder) Next() (Operation, error) {
+	var op Operation
+	if err := d.start(); err != nil {
+		return op, err
+	}
+	if d.done {
+		return op, io.EOF
+	}
+	if !d.dec.More() {
+		if _, err := d.dec.Token(); err != nil {
+			d.err = fmt.Errorf("jsonpatch: failed to decode patch: %w", err)
+			return op, d.err
+		}
+		d.done = true
+		return op, io.EOF
+	}
+	if err := d.dec.Decode(&op); err != nil {
+		d.err = fmt.Errorf("jsonpatch: failed to decode operation %d: %w", d.index, err)
+		return op, d.err
+	}
+	d.index++
+	return op, nil
+}
+
+// Index returns the number of operations decoded so far, which is the index
+// of the operation the next call to Next returns.
+func (d *PatchDecoder) Index() int {
+	return d.index
+}
+
+// ApplyFromReader applies the JSON Patch read from r to a copy of document,
+// applying each operation as soon as it is decoded. The original document is
+// not changed.
+//
+// It stops at the first operation that fails, returning a *Error with the
+// operation's index; the rest of r is not read. Decoding errors are returned
+// as they are.
+func ApplyFromReader(document any, r io.Reader, opts ...Option) (any, error) {
+	o := newOptions(opts)
+	dec := NewPatchDecoder(r)
+
+	apply := applyPatchOperation
+	var doc any
+	if isOrderedDocument(document) {
+		if err := checkOrderedOptions(o); err != nil {
+			return nil, err
+		}
+		apply, doc = applyOrderedOperation, cloneValue(document)
+	} else {
+		var err error
+		if doc, err = copyDocument(document, o); err != nil {
+			return nil, err
+		}
+	}
+	lim, err := newLimiter(o.limits, doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		i := dec.Index()
+		op, err := dec.Next()
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = apply(doc, i, op, o, lim); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package jsonpatch_test
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestPatchDecoder(t *testing.T) {
+	dec := jsonpatch.NewPatchDecoder(strings.NewReader(` [ {"op":"add","path":"/a","value":{"b":[1]}},
+		{"op":"move","from":"/a","path":"/c"} ] `))
+	var got jsonpatch.Patch
+	for dec.More() {
+		op, err := dec.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, op)
+	}
+	want := jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/a", Value: map[string]any{"b": []any{1.0}}},
+		{Op: jsonpatch.Move, From: "/a", Path: "/c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %v, want %v", got, want)
+	}
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("Next after the last operation = %v, want io.EOF", err)
+	}
+}
+
+func TestPatchDecoderErrors(t *testing.T) {
+	for _, in := range []string{
+		``,
+		`{"op":"add"}`,
+		`[{"op":"add","path":"/a"},{"op":`,
+		`[{"op":"add","path":"/a"} {"op":"add"}]`,
+	} {
+		dec := jsonpatch.NewPatchDecoder(strings.NewReader(in))
+		var err error
+		for err == nil {
+			_, err = dec.Next()
+		}
+		if err == io.EOF {
+			t.Errorf("%q: decoded without error", in)
+		}
+	}
+}
+
+func TestApplyFromReader(t *testing.T) {
+	doc := map[string]any{"a": 1.0, "list": []any{}}
+	got, err := jsonpatch.ApplyFromReader(doc, strings.NewReader(`[
+		{"op":"replace","path":"/a","value":2},
+		{"op":"add","path":"/list/-","value":"x"},
+		{"op":"copy","from":"/list","path":"/copy"}
+	]`))
+	if err != nil {
+		t.Fatalf("ApplyFromReader: %v", err)
+	}
+	want := map[string]any{"a": 2.0, "list": []any{"x"}, "copy": []any{"x"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if doc["a"] != 1.0 {
+		t.Fatalf("input modified: %v", doc)
+	}
+
+	// The trailing garbage is never read: the failing operation stops the stream.
+	_, err = jsonpatch.ApplyFromReader(doc, strings.NewReader(`[
+		{"op":"test","path":"/a","value":1},
+		{"op":"remove","path":"/missing"},
+		this is not JSON`))
+	var perr *jsonpatch.Error
+	if !errors.As(err, &perr) || perr.Index != 1 || perr.Op != jsonpatch.Remove {
+		t.Fatalf("error = %v, want *Error for remove at index 1", err)
+	}
+
+	_, err = jsonpatch.ApplyFromReader(doc, strings.NewReader(`[{"op":"remove","path":"/a"},{"op":"add","path":"/b","value":1},{"op":"add"`),
+		jsonpatch.WithLimits(jsonpatch.Limits{MaxOperations: 1}))
+	if !errors.As(err, &perr) || perr.Index != 1 || !errors.Is(err, jsonpatch.ErrLimitExceeded) {
+		t.Fatalf("error = %v, want MaxOperations exceeded at index 1", err)
+	}
+}
+
+func TestApplyFromReaderOrdered(t *testing.T) {
+	doc := mustDecodeOrdered(t, `{"b":1,"a":2}`)
+	got, err := jsonpatch.ApplyFromReader(doc, strings.NewReader(`[{"op":"add","path":"/c","value":3},{"op":"remove","path":"/b"}]`))
+	if err != nil {
+		t.Fatalf("ApplyFromReader: %v", err)
+	}
+	if s := mustMarshal(t, got); s != `{"a":2,"c":3}` {
+		t.Fatalf("got %s", s)
+	}
+}
@@ -0,0 +1,231 @@
+// Package diffsync keeps JSON documents in sync between peers with
+// differential synchronization. Each side of a Session holds a shadow, its
+// last known copy of the other side's document. Local changes are found by
+// diffing the document against the shadow with jsonpatch.New and sent as
+// versioned edits; received edits are applied exactly to the shadow and on a
+// best-effort basis to the document. Unacknowledged edits are resent, and
+// backup shadows kept for them recover from lost messages.
+//
+// A server shares one Document between the sessions of all its clients, while
+// each client has a Document of its own.
+package diffsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+// ErrOutOfSync is returned when a message cannot be reconciled with the
+// session's shadows. The session must be replaced by a new one created from
+// a fresh copy of the other side's document.
+var ErrOutOfSync = errors.New("diffsync: out of sync")
+
+// Edit is a patch against a shadow at known versions.
+type Edit struct {
+	// Version is the sender's version of the shadow the patch applies to.
+	Version uint64 `json:"version"`
+	// Base is the receiver's version the sender's shadow was based on.
+	Base uint64 `json:"base"`
+	// Patch transforms the shadow into the sender's document.
+	Patch jsonpatch.Patch `json:"patch"`
+}
+
+// Message carries the unacknowledged edits of one peer to the other.
+type Message struct {
+	// Ack is the number of the receiver's edits the sender has applied.
+	Ack uint64 `json:"ack"`
+	// Edits are the sender's unacknowledged edits in version order.
+	Edits []Edit `json:"edits,omitempty"`
+}
+
+// Transport exchanges the messages of one session with its peer. Messages
+// may be lost, but must not be reordered.
+type Transport interface {
+	Send(ctx context.Context, msg Message) error
+	Receive(ctx context.Context) (Message, error)
+}
+
+// Document is the working copy that local changes are made to. It is safe for
+// concurrent use and may be shared by several sessions.
+type Document struct {
+	mu    sync.Mutex
+	value any
+}
+
+// NewDocument returns a Document holding a copy of value.
+func NewDocument(value any) (*Document, error) {
+	v, err := jsonpatch.Apply(value, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{value: v}, nil
+}
+
+// Value returns a copy of the current value.
+func (d *Document) Value() any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, _ := jsonpatch.Apply(d.value, nil)
+	return v
+}
+
+// Apply applies patch to the document as a local change.
+func (d *Document) Apply(patch jsonpatch.Patch, opts ...jsonpatch.Option) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, err := jsonpatch.Apply(d.value, patch, opts...)
+	if err != nil {
+		return err
+	}
+	d.value = v
+	return nil
+}
+
+// merge applies the operations of patch that still apply and skips the
+// others, since the document may have diverged from the shadow the patch was
+// made for.
+func (d *Document) merge(patch jsonpatch.Patch) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, op := range patch {
+		if v, err := jsonpatch.Apply(d.value, jsonpatch.Patch{op}); err == nil {
+			d.value = v
+		}
+	}
+}
+
+// Session synchronizes a Document with one peer over a Transport. Both sides
+// of a session must start from equal documents.
+//
+// A Session is safe for concurrent use.
+type Session struct {
+	mu  sync.Mutex
+	doc *Document
+	t   Transport
+
+	shadow  any
+	version uint64 // local version of the shadow
+	remote  uint64 // next expected version of the peer's edits
+
+	pending []pendingEdit
+}
+
+// pendingEdit is an unacknowledged edit and the backup of the shadow it was
+// made from, which the peer may still base its own edits on.
+type pendingEdit struct {
+	Edit
+	backup any
+}
+
+// NewSession returns a session for doc whose shadow is a copy of its current value.
+func NewSession(doc *Document, t Transport) *Session {
+	return &Session{doc: doc, t: t, shadow: doc.Value()}
+}
+
+// Document returns the document the session synchronizes.
+func (s *Session) Document() *Document {
+	return s.doc
+}
+
+// Sync sends the local changes made since the last Sync, together with all
+// unacknowledged edits. It sends a message even without changes, which
+// acknowledges the edits received so far. Calling Sync again after a timeout
+// resends edits whose message or acknowledgement was lost.
+func (s *Session) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	current := s.doc.Value()
+	patch, err := jsonpatch.New(s.shadow, current)
+	if err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("diffsync: diff against shadow: %w", err)
+	}
+	if len(patch) > 0 {
+		e := Edit{Version: s.version, Base: s.remote, Patch: patch}
+		s.pending = append(s.pending, pendingEdit{Edit: e, backup: s.shadow})
+		s.shadow = current
+		s.version++
+	}
+	msg := Message{Ack: s.remote, Edits: make([]Edit, len(s.pending))}
+	for i, p := range s.pending {
+		msg.Edits[i] = p.Edit
+	}
+	s.mu.Unlock()
+	return s.t.Send(ctx, msg)
+}
+
+// Receive waits for the next message from the peer and handles it.
+func (s *Session) Receive(ctx context.Context) error {
+	msg, err := s.t.Receive(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Handle(msg)
+}
+
+// Handle applies the edits of a message received from the peer. Edits seen
+// before are skipped. An edit based on an older version of the shadow means
+// the peer has not seen the local edits since; the shadow is then restored
+// from the backup kept for that version, and the local changes since are
+// diffed and sent again by the next Sync.
+func (s *Session) Handle(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range msg.Edits {
+		if e.Version < s.remote {
+			continue
+		}
+		if e.Version > s.remote {
+			return fmt.Errorf("%w: received edit %d, expected %d", ErrOutOfSync, e.Version, s.remote)
+		}
+		if e.Base != s.version && !s.restore(e.Base) {
+			return fmt.Errorf("%w: edit based on version %d, shadow is at %d", ErrOutOfSync, e.Base, s.version)
+		}
+		shadow, err := jsonpatch.Apply(s.shadow, e.Patch)
+		if err != nil {
+			return fmt.Errorf("%w: edit %d does not apply to the shadow: %v", ErrOutOfSync, e.Version, err)
+		}
+		s.shadow = shadow
+		s.remote++
+		s.doc.merge(e.Patch)
+	}
+
+	// Acknowledgements are processed last: the edits of the message may be
+	// based on versions it acknowledges.
+	acked := 0
+	for acked < len(s.pending) && s.pending[acked].Version < msg.Ack {
+		acked++
+	}
+	s.pending = s.pending[acked:]
+	return nil
+}
+
+// restore rolls the shadow back to version from the backup of the pending
+// edit made at that version, dropping that edit and the later ones.
+func (s *Session) restore(version uint64) bool {
+	for i, p := range s.pending {
+		if p.Version == version {
+			s.shadow, s.version = p.backup, version
+			s.pending = s.pending[:i]
+			return true
+		}
+	}
+	return false
+}
+
+// Serve handles messages from the peer until ctx is done or the transport
+// fails, answering each one with Sync. This is how the server side of a
+// session is run; clients call Sync and Receive themselves.
+func (s *Session) Serve(ctx context.Context) error {
+	for {
+		if err := s.Receive(ctx); err != nil {
+			return err
+		}
+		if err := s.Sync(ctx); err != nil {
+			return err
+		}
+	}
+}
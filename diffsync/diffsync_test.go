@@ -0,0 +1,124 @@
+package diffsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+	"github.com/agentflare-ai/go-jsonpatch/diffsync"
+)
+
+type peer struct {
+	session *diffsync.Session
+	end     *diffsync.PipeEnd
+}
+
+// connect returns a client with its own copy of the server document and the
+// server's session for it.
+func connect(t *testing.T, server *diffsync.Document) (client, serverSide peer) {
+	t.Helper()
+	a, b := diffsync.Pipe(8)
+	doc, err := diffsync.NewDocument(server.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer{diffsync.NewSession(doc, a), a}, peer{diffsync.NewSession(server, b), b}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// roundTrip runs one synchronization cycle started by the client.
+func roundTrip(t *testing.T, client, server peer) {
+	t.Helper()
+	ctx := context.Background()
+	must(t, client.session.Sync(ctx))
+	must(t, server.session.Receive(ctx))
+	must(t, server.session.Sync(ctx))
+	must(t, client.session.Receive(ctx))
+}
+
+func edit(t *testing.T, s peer, patch ...jsonpatch.Operation) {
+	t.Helper()
+	must(t, s.session.Document().Apply(patch))
+}
+
+func assertJSON(t *testing.T, d *diffsync.Document, want string) {
+	t.Helper()
+	got, err := json.Marshal(d.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("document = %s, want %s", got, want)
+	}
+}
+
+func TestSessionConverges(t *testing.T) {
+	server, err := diffsync.NewDocument(map[string]any{"title": "draft", "tags": []any{}})
+	must(t, err)
+	alice, aliceServer := connect(t, server)
+	bob, bobServer := connect(t, server)
+
+	// Concurrent edits of different members merge.
+	edit(t, alice, jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/title", Value: "final"})
+	edit(t, bob, jsonpatch.Operation{Op: jsonpatch.Add, Path: "/tags/-", Value: "go"})
+	roundTrip(t, alice, aliceServer)
+	roundTrip(t, bob, bobServer)
+	roundTrip(t, alice, aliceServer)
+
+	const want = `{"tags":["go"],"title":"final"}`
+	assertJSON(t, server, want)
+	assertJSON(t, alice.session.Document(), want)
+	assertJSON(t, bob.session.Document(), want)
+}
+
+func TestSessionLostMessages(t *testing.T) {
+	ctx := context.Background()
+	server, err := diffsync.NewDocument(map[string]any{"n": 0.0})
+	must(t, err)
+	client, serverSide := connect(t, server)
+
+	// The client's first message is lost; the edit is resent with the next one.
+	edit(t, client, jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/n", Value: 1.0})
+	client.end.DropIf(func(diffsync.Message) bool { return true })
+	must(t, client.session.Sync(ctx))
+	client.end.DropIf(nil)
+	edit(t, client, jsonpatch.Operation{Op: jsonpatch.Add, Path: "/a", Value: true})
+	roundTrip(t, client, serverSide)
+	assertJSON(t, server, `{"a":true,"n":1}`)
+
+	// The server's answer carrying its own edit is lost. The client edits
+	// again meanwhile, so the server's next edit is based on a version the
+	// server shadow has moved past, and the server restores its backup.
+	must(t, server.Apply(jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/b", Value: "s"}}))
+	serverSide.end.DropIf(func(diffsync.Message) bool { return true })
+	must(t, client.session.Sync(ctx))
+	must(t, serverSide.session.Receive(ctx))
+	must(t, serverSide.session.Sync(ctx))
+	serverSide.end.DropIf(nil)
+
+	edit(t, client, jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/n", Value: 2.0})
+	roundTrip(t, client, serverSide)
+	roundTrip(t, client, serverSide)
+
+	const want = `{"a":true,"b":"s","n":2}`
+	assertJSON(t, server, want)
+	assertJSON(t, client.session.Document(), want)
+}
+
+func TestSessionOutOfSync(t *testing.T) {
+	server, err := diffsync.NewDocument(map[string]any{})
+	must(t, err)
+	_, serverSide := connect(t, server)
+	err = serverSide.session.Handle(diffsync.Message{Edits: []diffsync.Edit{{Version: 3}}})
+	if !errors.Is(err, diffsync.ErrOutOfSync) {
+		t.Fatalf("Handle of an edit from the future = %v, want ErrOutOfSync", err)
+	}
+}
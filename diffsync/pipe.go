@@ -0,0 +1,62 @@
+package diffsync
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// PipeEnd is one end of an in-memory transport created by Pipe.
+type PipeEnd struct {
+	in, out chan []byte
+	mu      sync.Mutex
+	drop    func(Message) bool
+}
+
+// Pipe returns the two connected ends of an in-memory transport. Messages are
+// encoded as JSON, as they would be on the wire, and buffered up to size
+// messages in each direction; Send blocks while the buffer is full.
+func Pipe(size int) (*PipeEnd, *PipeEnd) {
+	ab, ba := make(chan []byte, size), make(chan []byte, size)
+	return &PipeEnd{in: ba, out: ab}, &PipeEnd{in: ab, out: ba}
+}
+
+// DropIf makes Send silently discard the messages for which drop returns
+// true, simulating lost packets. A nil drop delivers every message.
+func (p *PipeEnd) DropIf(drop func(Message) bool) {
+	p.mu.Lock()
+	p.drop = drop
+	p.mu.Unlock()
+}
+
+// Send sends msg to the other end.
+func (p *PipeEnd) Send(ctx context.Context, msg Message) error {
+	p.mu.Lock()
+	drop := p.drop
+	p.mu.Unlock()
+	if drop != nil && drop(msg) {
+		return nil
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case p.out <- b:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Receive returns the next message sent by the other end.
+func (p *PipeEnd) Receive(ctx context.Context) (Message, error) {
+	select {
+	case b := <-p.in:
+		var msg Message
+		err := json.Unmarshal(b, &msg)
+		return msg, err
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
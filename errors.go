@@ -0,0 +1,23 @@
+package jsonpatch
+
+import "fmt"
+
+// Error reports a failure while applying a patch. Index is the position of the
+// failing operation in the patch, or -1 when the failure is not tied to one.
+type Error struct {
+	Index int
+	Op    Op
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("jsonpatch: %v", e.Err)
+	}
+	return fmt.Sprintf("patch operation %s failed: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,177 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// isExtendedPath reports whether path is a JSONPath expression or a JSON Pointer
+// containing a "*" wildcard token.
+func isExtendedPath(path string) bool {
+	if strings.HasPrefix(path, "$") {
+		return true
+	}
+	return strings.Contains(path+"/", "/*/")
+}
+
+// expandOperation expands op, whose path is extended, into concrete operations
+// evaluated against the current state of document.
+//
+// The paths of add, copy and move operations must end in a member name (or,
+// for JSON Pointers, a token other than "*"), which is appended to every
+// matched parent, so that members can be created where they do not exist yet.
+// All other operations target matched locations only. A location matched
+// more than once is patched once, and removals are emitted in reverse
+// document order so array indices stay valid. An expansion that matches
+// nothing yields no operations. Unless max is negative, matching stops after
+// max+1 locations.
+func expandOperation(document any, op Operation, max int) (Patch, error) {
+	creates := op.Op == Add || op.Op == Copy || op.Op == Move
+	pointers, err := expandPath(document, op.Path, creates, max)
+	if err != nil {
+		return nil, err
+	}
+	pointers = uniquePointers(pointers)
+	if op.Op == Move && len(pointers) > 1 {
+		return nil, fmt.Errorf("jsonpatch: move path '%s' expands to %d locations", op.Path, len(pointers))
+	}
+	if op.Op == Remove {
+		reverseDocumentOrder(pointers)
+	}
+	out := make(Patch, len(pointers))
+	for i, ptr := range pointers {
+		expanded := op
+		expanded.Path = ptr
+		if i > 0 && (op.Op == Add || op.Op == Replace) {
+			// Every target receives its own copy so later edits do not alias.
+			expanded.Value = cloneValue(op.Value)
+		}
+		out[i] = expanded
+	}
+	return out, nil
+}
+
+// uniquePointers drops repeated pointers, keeping the first of each.
+func uniquePointers(pointers []string) []string {
+	seen := make(map[string]bool, len(pointers))
+	out := pointers[:0]
+	for _, ptr := range pointers {
+		if !seen[ptr] {
+			seen[ptr] = true
+			out = append(out, ptr)
+		}
+	}
+	return out
+}
+
+// reverseDocumentOrder sorts pointers so that later array elements come
+// before earlier ones of the same array and descendants before their
+// ancestors, whatever order the selectors matched them in.
+func reverseDocumentOrder(pointers []string) {
+	tokens := make(map[string][]string, len(pointers))
+	for _, ptr := range pointers {
+		tokens[ptr], _ = jsonpointer.New(ptr)
+	}
+	slices.SortFunc(pointers, func(a, b string) int {
+		return -compareLocations(tokens[a], tokens[b])
+	})
+}
+
+// compareLocations orders token paths in document order, comparing array
+// indices numerically. A path comes before its descendants.
+func compareLocations(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		x, errX := jsonpointer.ParseArrayIndex(a[i])
+		y, errY := jsonpointer.ParseArrayIndex(b[i])
+		if errX == nil && errY == nil {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return len(a) - len(b)
+}
+
+// expandPath resolves an extended path into concrete JSON Pointers. When
+// allowMissingLeaf is set, a trailing member name is appended to each matched
+// parent instead of being matched itself. Unless max is negative, it stops
+// after max+1 matches, before the document is walked any further.
+func expandPath(document any, path string, allowMissingLeaf bool, max int) ([]string, error) {
+	var out []string
+	var leaf string
+	var hasLeaf bool
+	collect := func(n jpNode) bool {
+		ptr := n.pointer()
+		if hasLeaf {
+			ptr = joinPath(ptr, leaf)
+		}
+		out = append(out, ptr)
+		return max < 0 || len(out) <= max
+	}
+
+	if strings.HasPrefix(path, "$") {
+		q, err := parseJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if allowMissingLeaf {
+			parent, name, ok := q.selectParent()
+			if !ok {
+				return nil, fmt.Errorf("jsonpatch: path '%s' must end in a member name to add at", path)
+			}
+			q, leaf, hasLeaf = parent, name, true
+		}
+		q.visit(document, jpNode{value: document}, collect)
+		return out, nil
+	}
+
+	tokens, err := jsonpointer.New(path)
+	if err != nil {
+		return nil, err
+	}
+	hasLeaf = allowMissingLeaf && len(tokens) > 0
+	if hasLeaf && tokens[len(tokens)-1] == "*" {
+		return nil, fmt.Errorf("jsonpatch: path '%s' must end in a member name to add at", path)
+	}
+	if hasLeaf {
+		leaf = tokens[len(tokens)-1]
+		tokens = tokens[:len(tokens)-1]
+	}
+	// Walk depth first, like jsonPath.visit, so that collect can stop early.
+	var walk func(n jpNode, tokens []string) bool
+	walk = func(n jpNode, tokens []string) bool {
+		if len(tokens) == 0 {
+			return collect(n)
+		}
+		tok := tokens[0]
+		if tok == "*" {
+			for _, c := range children(n) {
+				if !walk(c, tokens[1:]) {
+					return false
+				}
+			}
+			return true
+		}
+		switch c := n.value.(type) {
+		case map[string]any:
+			if v, ok := c[tok]; ok {
+				return walk(n.child(tok, v), tokens[1:])
+			}
+		case []any:
+			if idx, err := jsonpointer.ParseArrayIndex(tok); err == nil && idx < uint64(len(c)) {
+				return walk(n.child(tok, c[idx]), tokens[1:])
+			}
+		}
+		return true
+	}
+	walk(jpNode{value: document}, tokens)
+	return out, nil
+}
@@ -0,0 +1,154 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestApplyPathExpansion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "wildcard add creates missing members",
+			doc:      `{"items":[{"id":1},{"id":2,"status":"open"}]}`,
+			patch:    `[{"op":"add","path":"/items/*/status","value":"archived"}]`,
+			expected: `{"items":[{"id":1,"status":"archived"},{"id":2,"status":"archived"}]}`,
+		},
+		{
+			name:     "wildcard replace on object members",
+			doc:      `{"limits":{"cpu":1,"mem":2}}`,
+			patch:    `[{"op":"replace","path":"/limits/*","value":0}]`,
+			expected: `{"limits":{"cpu":0,"mem":0}}`,
+		},
+		{
+			name:     "jsonpath filter remove",
+			doc:      `{"users":[{"n":"a","role":"guest"},{"n":"b","role":"admin"},{"n":"c","role":"guest"}]}`,
+			patch:    `[{"op":"remove","path":"$.users[?@.role=='guest']"}]`,
+			expected: `{"users":[{"n":"b","role":"admin"}]}`,
+		},
+		{
+			name:     "jsonpath add member to matched objects",
+			doc:      `{"users":[{"n":"a","age":10},{"n":"b","age":30}]}`,
+			patch:    `[{"op":"add","path":"$.users[?@.age >= 18].adult","value":true}]`,
+			expected: `{"users":[{"n":"a","age":10},{"n":"b","age":30,"adult":true}]}`,
+		},
+		{
+			name:     "no matches is a no-op",
+			doc:      `{"users":[]}`,
+			patch:    `[{"op":"remove","path":"$.users[*]"}]`,
+			expected: `{"users":[]}`,
+		},
+		{
+			name:     "copy into every element",
+			doc:      `{"default":"x","items":[{},{}]}`,
+			patch:    `[{"op":"copy","from":"/default","path":"/items/*/v"}]`,
+			expected: `{"default":"x","items":[{"v":"x"},{"v":"x"}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc, expected any
+			json.Unmarshal([]byte(tc.doc), &doc)
+			json.Unmarshal([]byte(tc.expected), &expected)
+			var patch jsonpatch.Patch
+			json.Unmarshal([]byte(tc.patch), &patch)
+
+			result, err := jsonpatch.Apply(doc, patch, jsonpatch.WithPathExpansion())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, expected) {
+				resBytes, _ := json.Marshal(result)
+				t.Errorf("unexpected result\n\tgot: %s\n\twant: %s", resBytes, tc.expected)
+			}
+
+			diff, err := jsonpatch.Prepare(doc, patch, jsonpatch.WithPathExpansion())
+			if err != nil {
+				t.Fatalf("Prepare failed: %v", err)
+			}
+			for _, d := range diff.Deltas {
+				if d.Path != "" && d.Path[0] != '/' {
+					t.Errorf("delta path %q is not a concrete pointer", d.Path)
+				}
+			}
+			restored, err := diff.Revert(result)
+			if err != nil {
+				t.Fatalf("Revert failed: %v", err)
+			}
+			if !reflect.DeepEqual(restored, doc) {
+				resBytes, _ := json.Marshal(restored)
+				t.Errorf("Revert did not restore original\n\tgot: %s\n\twant: %s", resBytes, tc.doc)
+			}
+		})
+	}
+}
+
+func TestApplyPathExpansionDisabled(t *testing.T) {
+	doc := map[string]any{"*": 1.0}
+	patch := jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/*", Value: 2.0}}
+
+	result, err := jsonpatch.Apply(doc, patch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result, map[string]any{"*": 2.0}) {
+		t.Errorf("expected literal '*' member to be replaced, got %v", result)
+	}
+
+	if _, err := jsonpatch.Apply(doc, jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "$.a"}}); err == nil {
+		t.Error("expected JSONPath to be rejected without WithPathExpansion")
+	}
+}
+
+func TestApplyPathExpansionMoveMultiple(t *testing.T) {
+	doc := map[string]any{"a": []any{1.0, 2.0}, "b": map[string]any{}}
+	patch := jsonpatch.Patch{{Op: jsonpatch.Move, From: "/b", Path: "/a/*"}}
+	if _, err := jsonpatch.Apply(doc, patch, jsonpatch.WithPathExpansion()); err == nil {
+		t.Error("expected move to multiple locations to fail")
+	}
+}
+
+func TestApplyPathExpansionRemoveOrder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "reversed slice", path: "$.arr[::-1]", expected: `[]`},
+		{name: "unordered selectors", path: "$.arr[2,0]", expected: `["b","d"]`},
+		{name: "duplicate selectors", path: "$.arr[0,0]", expected: `["b","c","d"]`},
+		{name: "nested matches", path: "$..[0]", expected: `["b","c","d"]`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := map[string]any{"arr": []any{"a", "b", "c", "d"}}
+			patch := jsonpatch.Patch{{Op: jsonpatch.Remove, Path: tc.path}}
+			result, err := jsonpatch.Apply(doc, patch, jsonpatch.WithPathExpansion())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, _ := json.Marshal(result.(map[string]any)["arr"])
+			if string(got) != tc.expected {
+				t.Errorf("arr = %s, want %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestApplyPathExpansionAddAtMatches(t *testing.T) {
+	doc := map[string]any{"arr": []any{"a", "b"}}
+	for _, path := range []string{"/arr/*", "$.arr[*]", "$.arr[0]", "$.arr[?@ == 'a']"} {
+		patch := jsonpatch.Patch{{Op: jsonpatch.Add, Path: path, Value: "x"}}
+		if _, err := jsonpatch.Apply(doc, patch, jsonpatch.WithPathExpansion()); err == nil {
+			t.Errorf("add at %s succeeded, want an error", path)
+		}
+	}
+}
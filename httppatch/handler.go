@@ -0,0 +1,230 @@
+// Package httppatch serves HTTP PATCH requests carrying JSON Patch (RFC 6902)
+// or JSON Merge Patch (RFC 7396) documents. It negotiates the patch format,
+// enforces If-Match preconditions against entity tags, applies the patch with
+// the options of package jsonpatch and reports failures as RFC 9457 problem
+// details.
+package httppatch
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+// Media types of the supported patch formats.
+const (
+	MediaTypeJSONPatch  = "application/json-patch+json"
+	MediaTypeMergePatch = "application/merge-patch+json"
+)
+
+// ErrNotFound is returned by a Resource when the requested resource does not
+// exist; the handler responds with 404.
+var ErrNotFound = errors.New("httppatch: resource not found")
+
+// ErrPreconditionFailed is returned by Resource.Save when the stored resource
+// no longer carries the entity tag it was loaded with; the handler responds
+// with 412.
+var ErrPreconditionFailed = errors.New("httppatch: precondition failed")
+
+// Resource loads and stores the documents a Handler patches.
+//
+// Entity tags are passed as they appear in the ETag header, quotes included,
+// e.g. `"v7"` or `W/"v7"`.
+type Resource interface {
+	// Load returns the document addressed by r and its current entity tag.
+	Load(r *http.Request) (document any, etag string, err error)
+	// Save stores the patched document if the resource still has the entity
+	// tag etag it was loaded with, and returns its new entity tag. It returns
+	// ErrPreconditionFailed if the resource changed in the meantime.
+	Save(r *http.Request, document any, etag string) (newETag string, err error)
+}
+
+// Handler applies the patch in the body of PATCH requests to a Resource and
+// responds with the patched document.
+type Handler struct {
+	// Resource loads and stores the patched documents.
+	Resource Resource
+	// MergePatch also accepts application/merge-patch+json bodies. Merge
+	// patches are translated to JSON Patch operations against the loaded
+	// document, so Options and Schema apply to them as well.
+	MergePatch bool
+	// RequireIfMatch rejects requests without an If-Match header with 428.
+	RequireIfMatch bool
+	// Options are used whenever the handler applies a patch, e.g.
+	// jsonpatch.WithLimits or jsonpatch.WithObserver(policy.Observer()).
+	Options []jsonpatch.Option
+	// Schema, if set, validates the patched document before it is saved.
+	Schema *jsonpatch.Schema
+	// MaxBodyBytes caps the size of request bodies; the default is 1 MiB.
+	MaxBodyBytes int64
+}
+
+// AcceptPatch returns the value of the Accept-Patch header advertising the
+// patch formats h accepts.
+func (h *Handler) AcceptPatch() string {
+	if h.MergePatch {
+		return MediaTypeJSONPatch + ", " + MediaTypeMergePatch
+	}
+	return MediaTypeJSONPatch
+}
+
+// Wrap returns a handler that serves PATCH requests with h and passes all
+// other requests to next, advertising the accepted patch formats with an
+// Accept-Patch header on every response.
+func (h *Handler) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Accept-Patch", h.AcceptPatch())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP handles a PATCH request. It responds with 200 and the patched
+// document, with the problem details of RFC 9457 on failure:
+//
+//   - 405 for methods other than PATCH,
+//   - 415 for unsupported content types,
+//   - 400 and 413 for malformed and oversized bodies, including JSON Patch
+//     operations with an unknown op or without a required value,
+//   - 404 if the resource does not exist,
+//   - 428 and 412 for missing and failed If-Match preconditions,
+//   - 403 for patches rejected by a jsonpatch.Policy,
+//   - 422 for exceeded limits and schema violations,
+//   - 409 for patches that cannot be applied to the document, e.g. a failed test.
+//
+// Problems caused by an operation carry its index, op and path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", h.AcceptPatch())
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", http.MethodPatch)
+		writeProblem(w, &Problem{Status: http.StatusMethodNotAllowed})
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != MediaTypeJSONPatch && (mediaType != MediaTypeMergePatch || !h.MergePatch)) {
+		writeProblem(w, &Problem{
+			Status: http.StatusUnsupportedMediaType,
+			Detail: "patch documents must be sent as " + strings.Join(strings.Split(h.AcceptPatch(), ", "), " or "),
+		})
+		return
+	}
+
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	var body any
+	if mediaType == MediaTypeJSONPatch {
+		body = new(jsonpatch.RawPatch)
+	} else {
+		body = new(any)
+	}
+	if p := decodeBody(http.MaxBytesReader(w, r.Body, limit), body); p != nil {
+		writeProblem(w, p)
+		return
+	}
+	var patch jsonpatch.Patch
+	if raw, ok := body.(*jsonpatch.RawPatch); ok {
+		if patch, err = decodePatch(*raw); err != nil {
+			writeProblem(w, malformedProblem(err, *raw))
+			return
+		}
+	}
+
+	if h.RequireIfMatch && r.Header.Get("If-Match") == "" {
+		writeProblem(w, &Problem{Status: http.StatusPreconditionRequired, Detail: "the request must be conditional on If-Match"})
+		return
+	}
+	doc, etag, err := h.Resource.Load(r)
+	if err != nil {
+		writeProblem(w, loadProblem(err))
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, etag) {
+		writeProblem(w, &Problem{Status: http.StatusPreconditionFailed, Detail: "the resource does not match If-Match"})
+		return
+	}
+
+	if mediaType == MediaTypeMergePatch {
+		if doc, err = mergeTarget(doc); err != nil {
+			writeProblem(w, &Problem{Status: http.StatusInternalServerError})
+			return
+		}
+		patch = mergeOperations(doc, *body.(*any))
+	}
+	var result any
+	if h.Schema != nil {
+		result, err = jsonpatch.ApplyValidated(doc, patch, h.Schema, h.Options...)
+	} else {
+		result, err = jsonpatch.Apply(doc, patch, h.Options...)
+	}
+	if err != nil {
+		writeProblem(w, patchProblem(err, patch, mediaType == MediaTypeJSONPatch))
+		return
+	}
+
+	newETag, err := h.Resource.Save(r, result, etag)
+	if err != nil {
+		writeProblem(w, loadProblem(err))
+		return
+	}
+	out, err := json.Marshal(result)
+	if err != nil {
+		writeProblem(w, &Problem{Status: http.StatusInternalServerError})
+		return
+	}
+	if newETag != "" {
+		w.Header().Set("ETag", newETag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+func decodeBody(r io.Reader, v any) *Problem {
+	dec := json.NewDecoder(r)
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		err = errors.New("more than one JSON value in the body")
+	}
+	if err == nil {
+		return nil
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &Problem{Status: http.StatusRequestEntityTooLarge, Detail: err.Error()}
+	}
+	return &Problem{Status: http.StatusBadRequest, Detail: "malformed patch document: " + err.Error()}
+}
+
+// loadProblem maps the errors of a Resource.
+func loadProblem(err error) *Problem {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return &Problem{Status: http.StatusNotFound}
+	case errors.Is(err, ErrPreconditionFailed):
+		return &Problem{Status: http.StatusPreconditionFailed, Detail: "the resource was modified concurrently"}
+	}
+	return &Problem{Status: http.StatusInternalServerError}
+}
+
+// etagMatches reports whether the If-Match header value matches etag, using
+// the strong comparison RFC 9110 requires for If-Match.
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || (tag == etag && !strings.HasPrefix(tag, "W/")) {
+			return true
+		}
+	}
+	return false
+}
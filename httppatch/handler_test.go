@@ -0,0 +1,226 @@
+package httppatch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+	"github.com/agentflare-ai/go-jsonpatch/httppatch"
+)
+
+// memResource is a single document with a version-based entity tag.
+type memResource struct {
+	mu      sync.Mutex
+	doc     any
+	version int
+}
+
+func (m *memResource) etag() string { return fmt.Sprintf(`"v%d"`, m.version) }
+
+func (m *memResource) Load(r *http.Request) (any, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.URL.Path != "/doc" {
+		return nil, "", httppatch.ErrNotFound
+	}
+	return m.doc, m.etag(), nil
+}
+
+func (m *memResource) Save(r *http.Request, doc any, etag string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if etag != m.etag() {
+		return "", httppatch.ErrPreconditionFailed
+	}
+	m.doc = doc
+	m.version++
+	return m.etag(), nil
+}
+
+func newResource() *memResource {
+	return &memResource{doc: map[string]any{"name": "svc", "spec": map[string]any{"replicas": 1.0, "image": "v1"}}}
+}
+
+func patchRequest(t *testing.T, h http.Handler, path, contentType, ifMatch, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) httppatch.Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+	}
+	var p httppatch.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != rec.Code {
+		t.Fatalf("problem status %d, response status %d", p.Status, rec.Code)
+	}
+	return p
+}
+
+func TestHandlerJSONPatch(t *testing.T) {
+	res := newResource()
+	h := &httppatch.Handler{Resource: res}
+	rec := patchRequest(t, h, "/doc", "application/json-patch+json; charset=utf-8", `"v0"`,
+		`[{"op":"replace","path":"/spec/replicas","value":3}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("ETag"); got != `"v1"` {
+		t.Fatalf("ETag = %s", got)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["spec"].(map[string]any)["replicas"] != 3.0 {
+		t.Fatalf("response document = %v", doc)
+	}
+
+	// The old entity tag no longer matches.
+	rec = patchRequest(t, h, "/doc", "application/json-patch+json", `"v0"`, `[]`)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match: status %d", rec.Code)
+	}
+	decodeProblem(t, rec)
+}
+
+func TestHandlerMergePatch(t *testing.T) {
+	res := newResource()
+	h := &httppatch.Handler{Resource: res, MergePatch: true}
+	rec := patchRequest(t, h, "/doc", "application/merge-patch+json", "",
+		`{"name":null,"spec":{"image":"v2","ports":{"http":80,"debug":null}}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	got, _ := json.Marshal(res.doc)
+	if want := `{"spec":{"image":"v2","ports":{"http":80},"replicas":1}}`; string(got) != want {
+		t.Fatalf("document = %s, want %s", got, want)
+	}
+}
+
+func TestHandlerMergePatchDocumentTypes(t *testing.T) {
+	type spec struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+	ordered, err := jsonpatch.DecodeOrdered(strings.NewReader(`{"a":1,"b":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		doc  any
+	}{
+		{"raw message", json.RawMessage(`{"a":1,"b":2}`)},
+		{"bytes", []byte(`{"a":1,"b":2}`)},
+		{"struct", spec{A: 1, B: 2}},
+		{"ordered", ordered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &memResource{doc: tt.doc}
+			h := &httppatch.Handler{Resource: res, MergePatch: true}
+			rec := patchRequest(t, h, "/doc", "application/merge-patch+json", "", `{"a":5}`)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			got, _ := json.Marshal(res.doc)
+			if want := `{"a":5,"b":2}`; string(got) != want {
+				t.Fatalf("document = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	policy := &jsonpatch.Policy{DefaultAllow: true, Rules: []jsonpatch.Rule{{Effect: jsonpatch.Deny, Path: "/name"}}}
+	h := &httppatch.Handler{
+		Resource:       newResource(),
+		RequireIfMatch: true,
+		Options: []jsonpatch.Option{
+			jsonpatch.WithObserver(policy.Observer()),
+			jsonpatch.WithLimits(jsonpatch.Limits{MaxOperations: 3}),
+		},
+		MaxBodyBytes: 256,
+	}
+	for _, tt := range []struct {
+		name, path, contentType, ifMatch, body string
+		status                                 int
+		index                                  int
+	}{
+		{"media type", "/doc", "application/json", "*", `[]`, http.StatusUnsupportedMediaType, -1},
+		{"merge disabled", "/doc", "application/merge-patch+json", "*", `{}`, http.StatusUnsupportedMediaType, -1},
+		{"malformed", "/doc", "application/json-patch+json", "*", `[{"op":`, http.StatusBadRequest, -1},
+		{"unknown op", "/doc", "application/json-patch+json", "*", `[{"op":"test","path":"/name","value":"svc"},{"op":"bogus","path":"/name"}]`, http.StatusBadRequest, 1},
+		{"missing value", "/doc", "application/json-patch+json", "*", `[{"op":"add","path":"/x"}]`, http.StatusBadRequest, 0},
+		{"too large", "/doc", "application/json-patch+json", "*", `[` + strings.Repeat(`{"op":"test","path":""},`, 20) + `]`, http.StatusRequestEntityTooLarge, -1},
+		{"no If-Match", "/doc", "application/json-patch+json", "", `[]`, http.StatusPreconditionRequired, -1},
+		{"not found", "/other", "application/json-patch+json", "*", `[]`, http.StatusNotFound, -1},
+		{"weak etag", "/doc", "application/json-patch+json", `W/"v0"`, `[]`, http.StatusPreconditionFailed, -1},
+		{"test failed", "/doc", "application/json-patch+json", `"x", "v0"`,
+			`[{"op":"replace","path":"/spec/replicas","value":2},{"op":"test","path":"/spec/image","value":"v9"}]`, http.StatusConflict, 1},
+		{"policy", "/doc", "application/json-patch+json", "*", `[{"op":"replace","path":"/name","value":"x"}]`, http.StatusForbidden, 0},
+		{"limits", "/doc", "application/json-patch+json", "*", `[` + strings.Repeat(`{"op":"test","path":"/name","value":"svc"},`, 3) + `{"op":"test","path":"/name","value":"svc"}]`, http.StatusUnprocessableEntity, -1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := patchRequest(t, h, tt.path, tt.contentType, tt.ifMatch, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			p := decodeProblem(t, rec)
+			if tt.index < 0 && p.Index != nil || tt.index >= 0 && (p.Index == nil || *p.Index != tt.index) {
+				t.Fatalf("problem = %s", rec.Body)
+			}
+			if got := rec.Header().Get("Accept-Patch"); got != "application/json-patch+json" {
+				t.Fatalf("Accept-Patch = %q", got)
+			}
+		})
+	}
+}
+
+func TestHandlerWrap(t *testing.T) {
+	h := &httppatch.Handler{Resource: newResource(), MergePatch: true}
+	srv := httptest.NewServer(h.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("GET status %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Accept-Patch"); got != "application/json-patch+json, application/merge-patch+json" {
+		t.Fatalf("Accept-Patch = %q", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/doc", strings.NewReader(`{"name":"api"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"v1"` {
+		t.Fatalf("PATCH status %d, ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+}
@@ -0,0 +1,100 @@
+package httppatch
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+var tokenEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// mergeOperations translates the RFC 7396 merge patch into JSON Patch
+// operations against document: null members remove, objects merge
+// recursively and any other value replaces the target as a whole. The
+// document must be normalized by mergeTarget.
+func mergeOperations(document, merge any) jsonpatch.Patch {
+	var patch jsonpatch.Patch
+	var walk func(target, merge any, path string)
+	walk = func(target, merge any, path string) {
+		m, ok := merge.(map[string]any)
+		var get func(key string) (any, bool)
+		switch t := target.(type) {
+		case map[string]any:
+			get = func(key string) (any, bool) {
+				v, ok := t[key]
+				return v, ok
+			}
+		case *jsonpatch.OrderedObject:
+			get = t.Get
+		}
+		if !ok || get == nil {
+			patch = append(patch, jsonpatch.Operation{Op: jsonpatch.Replace, Path: path, Value: withoutNulls(merge)})
+			return
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := m[k]
+			p := path + "/" + tokenEscaper.Replace(k)
+			cur, exists := get(k)
+			switch {
+			case v == nil:
+				if exists {
+					patch = append(patch, jsonpatch.Operation{Op: jsonpatch.Remove, Path: p})
+				}
+			case exists:
+				walk(cur, v, p)
+			default:
+				patch = append(patch, jsonpatch.Operation{Op: jsonpatch.Add, Path: p, Value: withoutNulls(v)})
+			}
+		}
+	}
+	walk(document, merge, "")
+	return patch
+}
+
+// mergeTarget returns the loaded document as encoding/json decodes it, as
+// Apply sees it, so that the members of raw JSON and structs are merged
+// instead of replaced. Ordered documents are kept as they are.
+func mergeTarget(document any) (any, error) {
+	var data []byte
+	switch d := document.(type) {
+	case *jsonpatch.OrderedObject:
+		return d, nil
+	case []byte:
+		data = d
+	case json.RawMessage:
+		data = d
+	default:
+		var err error
+		if data, err = json.Marshal(d); err != nil {
+			return nil, err
+		}
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// withoutNulls returns v with null object members removed, as a merge patch
+// applied to a missing or non-object target would leave them.
+func withoutNulls(v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	out := make(map[string]any, len(m))
+	for k, e := range m {
+		if e != nil {
+			out[k] = withoutNulls(e)
+		}
+	}
+	return out
+}
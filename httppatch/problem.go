@@ -0,0 +1,107 @@
+package httppatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+// Problem is the RFC 9457 problem details object written for failed requests.
+type Problem struct {
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Index is the position of the failing operation in the patch, for JSON
+	// Patch documents only.
+	Index *int `json:"index,omitempty"`
+	// Op and Path are the kind and path of the failing operation.
+	Op   jsonpatch.Op `json:"op,omitempty"`
+	Path string       `json:"path,omitempty"`
+	// Violations lists the policy or schema violations that rejected the patch.
+	Violations []string `json:"violations,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) {
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// decodePatch decodes a JSON Patch document, rejecting operations that are
+// malformed whatever the document: unknown ops and add, replace and test
+// operations without a value. Errors are reported as *jsonpatch.Error.
+func decodePatch(raw jsonpatch.RawPatch) (jsonpatch.Patch, error) {
+	for i, op := range raw {
+		var err error
+		switch op.Op {
+		case jsonpatch.Add, jsonpatch.Replace, jsonpatch.Test:
+			if len(op.Value) == 0 {
+				err = errors.New("missing value")
+			}
+		case jsonpatch.Remove, jsonpatch.Move, jsonpatch.Copy:
+		default:
+			err = fmt.Errorf("unsupported patch operation: %s", op.Op)
+		}
+		if err != nil {
+			return nil, &jsonpatch.Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return raw.Patch()
+}
+
+// malformedProblem maps an error of decodePatch.
+func malformedProblem(err error, raw jsonpatch.RawPatch) *Problem {
+	p := &Problem{Status: http.StatusBadRequest, Detail: "malformed patch document: " + err.Error()}
+	var opErr *jsonpatch.Error
+	if errors.As(err, &opErr) && opErr.Index >= 0 && opErr.Index < len(raw) {
+		index := opErr.Index
+		p.Index, p.Op, p.Path = &index, opErr.Op, raw[index].Path
+	}
+	return p
+}
+
+// patchProblem maps an error returned while applying patch. withIndex is
+// false for patches translated from a merge patch, whose operation indices
+// mean nothing to the client.
+func patchProblem(err error, patch jsonpatch.Patch, withIndex bool) *Problem {
+	p := &Problem{Status: http.StatusConflict, Detail: err.Error()}
+	var (
+		policyErr     *jsonpatch.PolicyError
+		validationErr *jsonpatch.ValidationError
+		opErr         *jsonpatch.Error
+	)
+	switch {
+	case errors.As(err, &policyErr):
+		p.Status = http.StatusForbidden
+		for _, v := range policyErr.Violations {
+			p.Violations = append(p.Violations, v.String())
+		}
+	case errors.As(err, &validationErr):
+		p.Status = http.StatusUnprocessableEntity
+		p.Detail = "the patched document does not satisfy the schema"
+		for _, v := range validationErr.Violations {
+			if !withIndex {
+				v.Index = -1
+			}
+			p.Violations = append(p.Violations, v.String())
+		}
+		return p
+	case errors.Is(err, jsonpatch.ErrLimitExceeded):
+		p.Status = http.StatusUnprocessableEntity
+	}
+	if errors.As(err, &opErr) && opErr.Index >= 0 && opErr.Index < len(patch) {
+		p.Op, p.Path = opErr.Op, patch[opErr.Index].Path
+		if withIndex {
+			index := opErr.Index
+			p.Index = &index
+		}
+	}
+	return p
+}
@@ -0,0 +1,60 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// A frame is a 4-byte big-endian payload length, the CRC-32C of the payload,
+// and the payload, a JSON-encoded Record.
+const frameHeaderSize = 8
+
+// maxFrameSize bounds the length read from a frame header, so that a corrupt
+// header cannot trigger a huge allocation.
+const maxFrameSize = 1 << 30
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errTorn reports an incomplete or corrupt frame.
+var errTorn = errors.New("incomplete or corrupt frame")
+
+func appendFrame(buf, payload []byte) []byte {
+	var hdr [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(hdr[4:8], crc32.Checksum(payload, castagnoli))
+	buf = append(buf, hdr[:]...)
+	return append(buf, payload...)
+}
+
+// readFrame reads the next frame's payload. It returns io.EOF at a clean end
+// of r and errTorn for a partial or damaged frame.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	var hdr [frameHeaderSize]byte
+	switch _, err := io.ReadFull(r, hdr[:]); err {
+	case nil:
+	case io.EOF:
+		return nil, io.EOF
+	case io.ErrUnexpectedEOF:
+		return nil, errTorn
+	default:
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[0:4])
+	if size > maxFrameSize {
+		return nil, errTorn
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+		return nil, err
+	}
+	if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return nil, errTorn
+	}
+	return payload, nil
+}
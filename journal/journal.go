@@ -0,0 +1,553 @@
+// Package journal persists JSON Patch history in a directory on local disk.
+//
+// Patches are appended as checksummed frames to segment files, which are
+// rotated by size. Snapshots of the document are written atomically, and
+// Compact folds closed segments into a new snapshot. On Open, a frame torn by
+// a crash at the end of the last segment is detected and truncated away.
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+const (
+	segmentExt  = ".seg"
+	snapshotExt = ".snap"
+)
+
+// ErrCorrupt reports journal data that cannot be recovered automatically.
+var ErrCorrupt = errors.New("journal: corrupt journal")
+
+// ErrCompacted is returned by Records for versions folded into a snapshot.
+var ErrCompacted = errors.New("journal: version compacted")
+
+// Record is one appended patch.
+type Record struct {
+	// Version is the document version the patch produced.
+	Version uint64 `json:"version"`
+	// Time is when the patch was applied.
+	Time time.Time `json:"time"`
+	// Actor identifies who applied the patch.
+	Actor string `json:"actor,omitempty"`
+	// Meta holds arbitrary metadata such as a request ID.
+	Meta  map[string]string `json:"meta,omitempty"`
+	Patch jsonpatch.Patch   `json:"patch"`
+}
+
+// SyncPolicy controls when appended records are flushed to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the segment after every Append.
+	SyncAlways SyncPolicy = iota
+	// SyncNever leaves flushing to the operating system and to Sync; a crash
+	// may lose the most recent records.
+	SyncNever
+)
+
+// Options configures a Journal.
+type Options struct {
+	// SegmentSize is the size in bytes after which a new segment is started.
+	// Zero means 64 MiB.
+	SegmentSize int64
+	// Sync is the sync policy. The default is SyncAlways.
+	Sync SyncPolicy
+}
+
+// Journal is a durable, append-only log of patches with snapshots. Version 0
+// is the empty document (null) unless a snapshot says otherwise. A Journal is
+// safe for concurrent use.
+type Journal struct {
+	mu         sync.Mutex
+	dir        string
+	opts       Options
+	segments   []uint64 // first version of each segment, ascending
+	active     *os.File // last segment, opened for appending
+	activeSize int64
+	last       uint64
+	closed     bool
+	failed     error // a failed append that could not be undone
+}
+
+// Open opens the journal in dir, creating the directory if needed. It checks
+// every segment, truncating a torn frame at the end of the last one, and
+// returns an error wrapping ErrCorrupt for damage anywhere else, including a
+// damaged frame of the last segment that is followed by more data.
+func Open(dir string, opts Options) (*Journal, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 64 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	j := &Journal{dir: dir, opts: opts}
+	snaps, err := listVersions(dir, snapshotExt)
+	if err != nil {
+		return nil, err
+	}
+	if len(snaps) > 0 {
+		j.last = snaps[len(snaps)-1]
+	}
+	if j.segments, err = listVersions(dir, segmentExt); err != nil {
+		return nil, err
+	}
+
+	snapshotVersion := j.last
+	var prev uint64
+	for i, first := range j.segments {
+		name := j.segmentPath(first)
+		good, err := scanSegment(name, func(rec Record) error {
+			switch {
+			case prev != 0 && rec.Version <= prev:
+				return fmt.Errorf("%w: %s: version %d follows %d", ErrCorrupt, name, rec.Version, prev)
+			case rec.Version > snapshotVersion && rec.Version != j.last+1:
+				return fmt.Errorf("%w: %s: version %d follows %d", ErrCorrupt, name, rec.Version, j.last)
+			}
+			prev = rec.Version
+			j.last = max(j.last, rec.Version)
+			return nil
+		})
+		if errors.Is(err, errTorn) {
+			tail := false
+			if i == len(j.segments)-1 {
+				if tail, err = tornTail(name, good); err != nil {
+					return nil, err
+				}
+			}
+			if !tail {
+				return nil, fmt.Errorf("%w: %s: %v at offset %d", ErrCorrupt, name, errTorn, good)
+			}
+			if err := truncate(name, good); err != nil {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		if i == len(j.segments)-1 {
+			if j.active, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+				return nil, err
+			}
+			j.activeSize = good
+		}
+	}
+	return j, nil
+}
+
+// Version returns the version of the last appended record or snapshot.
+func (j *Journal) Version() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
+
+// Append writes rec and returns its version. A zero rec.Version is set to the
+// next version, and any other value must be the next version. A zero rec.Time
+// is set to the current time.
+func (j *Journal) Append(rec Record) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return 0, errors.New("journal: append to closed journal")
+	}
+	if j.failed != nil {
+		return 0, fmt.Errorf("journal: append after unrecovered failure: %w", j.failed)
+	}
+	if rec.Version == 0 {
+		rec.Version = j.last + 1
+	} else if rec.Version != j.last+1 {
+		return 0, fmt.Errorf("journal: record version %d does not follow version %d", rec.Version, j.last)
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return 0, fmt.Errorf("journal: encoding record: %w", err)
+	}
+	if j.active == nil || j.activeSize >= j.opts.SegmentSize {
+		if err := j.rotate(rec.Version); err != nil {
+			return 0, err
+		}
+	}
+	frame := appendFrame(nil, payload)
+	if _, err := j.active.Write(frame); err != nil {
+		return 0, j.undo(err)
+	}
+	if j.opts.Sync == SyncAlways {
+		if err := j.active.Sync(); err != nil {
+			return 0, j.undo(err)
+		}
+	}
+	j.activeSize += int64(len(frame))
+	j.last = rec.Version
+	return rec.Version, nil
+}
+
+// undo drops a frame whose write or sync failed, so the record is not
+// replayed after it was reported as failed and later appends stay readable.
+// If the frame cannot be dropped, the journal refuses further appends.
+func (j *Journal) undo(err error) error {
+	if terr := j.active.Truncate(j.activeSize); terr != nil {
+		j.failed = err
+	}
+	return err
+}
+
+// rotate closes the active segment and starts a new one at version first.
+func (j *Journal) rotate(first uint64) error {
+	if j.active != nil {
+		if err := j.active.Sync(); err != nil {
+			return err
+		}
+		if err := j.active.Close(); err != nil {
+			return err
+		}
+		j.active = nil
+	}
+	f, err := os.OpenFile(j.segmentPath(first), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(j.dir); err != nil {
+		f.Close()
+		return err
+	}
+	j.active, j.activeSize = f, 0
+	j.segments = append(j.segments, first)
+	return nil
+}
+
+// Sync flushes appended records to stable storage.
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.active == nil {
+		return nil
+	}
+	return j.active.Sync()
+}
+
+// Close syncs and closes the journal.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	if j.active == nil {
+		return nil
+	}
+	err := j.active.Sync()
+	if cerr := j.active.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Snapshot atomically writes document as the state at version, which must not
+// be older than the latest snapshot. A version newer than the last record
+// moves the journal forward, so the next record must follow it.
+func (j *Journal) Snapshot(document any, version uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	snaps, err := listVersions(j.dir, snapshotExt)
+	if err != nil {
+		return err
+	}
+	if len(snaps) > 0 && version < snaps[len(snaps)-1] {
+		return fmt.Errorf("journal: snapshot version %d is older than snapshot %d", version, snaps[len(snaps)-1])
+	}
+	if err := j.writeSnapshot(document, version); err != nil {
+		return err
+	}
+	j.last = max(j.last, version)
+	return nil
+}
+
+func (j *Journal) writeSnapshot(document any, version uint64) error {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("journal: encoding snapshot: %w", err)
+	}
+	tmp, err := os.CreateTemp(j.dir, "snapshot-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), j.snapshotPath(version)); err != nil {
+		return err
+	}
+	return syncDir(j.dir)
+}
+
+// Replay reconstructs the current document by applying the records after the
+// latest snapshot to it, and returns it with its version.
+func (j *Journal) Replay() (any, uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	doc, base, err := j.loadSnapshot()
+	if err != nil {
+		return nil, 0, err
+	}
+	doc, err = j.fold(doc, base, j.segments)
+	if err != nil {
+		return nil, 0, err
+	}
+	return doc, j.last, nil
+}
+
+// Records calls fn for each record after version since, oldest first, until
+// fn returns an error. It returns ErrCompacted if some of those records were
+// folded into a snapshot.
+func (j *Journal) Records(since uint64, fn func(Record) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	next := since + 1
+	for _, first := range j.segments {
+		_, err := scanSegment(j.segmentPath(first), func(rec Record) error {
+			if rec.Version < next {
+				return nil
+			}
+			if rec.Version > next {
+				return fmt.Errorf("%w: records before version %d are only in a snapshot", ErrCompacted, rec.Version)
+			}
+			next++
+			return fn(rec)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if next <= j.last {
+		return fmt.Errorf("%w: records up to version %d are only in a snapshot", ErrCompacted, j.last)
+	}
+	return nil
+}
+
+// Compact folds every segment except the active one into a new snapshot with
+// jsonpatch.ApplyInPlace, then removes those segments and older snapshots.
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.segments) < 2 {
+		return nil
+	}
+	closed := j.segments[:len(j.segments)-1]
+	doc, base, err := j.loadSnapshot()
+	if err != nil {
+		return err
+	}
+	version := base
+	for _, first := range closed {
+		_, err := scanSegment(j.segmentPath(first), func(rec Record) error {
+			version = max(version, rec.Version)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if version > base {
+		if doc, err = j.fold(doc, base, closed); err != nil {
+			return err
+		}
+		if err := j.writeSnapshot(doc, version); err != nil {
+			return err
+		}
+	}
+	for _, first := range closed {
+		if err := os.Remove(j.segmentPath(first)); err != nil {
+			return err
+		}
+	}
+	j.segments = append([]uint64(nil), j.segments[len(closed):]...)
+	snaps, err := listVersions(j.dir, snapshotExt)
+	if err != nil {
+		return err
+	}
+	for _, v := range snaps {
+		if v < version {
+			if err := os.Remove(j.snapshotPath(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return syncDir(j.dir)
+}
+
+// fold applies the records of segments newer than version base to doc.
+func (j *Journal) fold(doc any, base uint64, segments []uint64) (any, error) {
+	for _, first := range segments {
+		_, err := scanSegment(j.segmentPath(first), func(rec Record) error {
+			if rec.Version <= base {
+				return nil
+			}
+			var err error
+			if doc, err = jsonpatch.ApplyInPlace(doc, rec.Patch); err != nil {
+				return fmt.Errorf("journal: replaying version %d: %w", rec.Version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// loadSnapshot reads the latest snapshot, or returns a null document at
+// version 0 if there is none.
+func (j *Journal) loadSnapshot() (any, uint64, error) {
+	snaps, err := listVersions(j.dir, snapshotExt)
+	if err != nil || len(snaps) == 0 {
+		return nil, 0, err
+	}
+	version := snaps[len(snaps)-1]
+	data, err := os.ReadFile(j.snapshotPath(version))
+	if err != nil {
+		return nil, 0, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("%w: snapshot %d: %v", ErrCorrupt, version, err)
+	}
+	return doc, version, nil
+}
+
+func (j *Journal) segmentPath(first uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", first, segmentExt))
+}
+
+func (j *Journal) snapshotPath(version uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", version, snapshotExt))
+}
+
+// scanSegment calls fn for each record of the segment at name. It returns the
+// offset after the last intact frame and errTorn if a damaged frame follows.
+// The segment is read up to a torn frame even if fn never fails.
+func scanSegment(name string, fn func(Record) error) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		payload, err := readFrame(r)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		var rec Record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return offset, fmt.Errorf("%w: %s: record at offset %d: %v", ErrCorrupt, name, offset, err)
+		}
+		if err := fn(rec); err != nil {
+			return offset, err
+		}
+		offset += int64(frameHeaderSize + len(payload))
+	}
+}
+
+// listVersions returns the versions encoded in the names of the files in dir
+// with extension ext, in ascending order.
+func listVersions(dir, ext string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var versions []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ext)
+		if !ok || e.IsDir() {
+			continue
+		}
+		v, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(a, b int) bool { return versions[a] < versions[b] })
+	return versions, nil
+}
+
+// tornTail reports whether the damaged frame at offset of the segment name
+// extends to the end of the file, as a frame torn by a crash does.
+func tornTail(name string, offset int64) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	var hdr [frameHeaderSize]byte
+	if _, err := f.ReadAt(hdr[:], offset); err != nil {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+	end := offset + frameHeaderSize + int64(binary.BigEndian.Uint32(hdr[0:4]))
+	return end >= info.Size(), nil
+}
+
+func truncate(name string, size int64) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
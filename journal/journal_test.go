@@ -0,0 +1,202 @@
+package journal_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+	"github.com/agentflare-ai/go-jsonpatch/journal"
+)
+
+func appendCounter(t *testing.T, j *journal.Journal, from, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		_, err := j.Append(journal.Record{
+			Actor: "tester",
+			Patch: jsonpatch.Patch{
+				{Op: jsonpatch.Replace, Path: "/n", Value: float64(i)},
+				{Op: jsonpatch.Add, Path: "/log/-", Value: float64(i)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+}
+
+func wantCounter(n int) any {
+	log := []any{}
+	for i := 1; i <= n; i++ {
+		log = append(log, float64(i))
+	}
+	return map[string]any{"n": float64(n), "log": log}
+}
+
+func openJournal(t *testing.T, dir string, opts journal.Options) *journal.Journal {
+	t.Helper()
+	j, err := journal.Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+func replay(t *testing.T, j *journal.Journal) (any, uint64) {
+	t.Helper()
+	doc, v, err := j.Replay()
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return doc, v
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	j := openJournal(t, dir, journal.Options{SegmentSize: 200})
+	if err := j.Snapshot(wantCounter(0), 0); err != nil {
+		t.Fatal(err)
+	}
+	appendCounter(t, j, 1, 12)
+	if _, err := j.Append(journal.Record{Version: 20}); err == nil {
+		t.Fatal("Append with a version gap succeeded")
+	}
+	j.Close()
+
+	j = openJournal(t, dir, journal.Options{SegmentSize: 200})
+	doc, v := replay(t, j)
+	if v != 12 || !reflect.DeepEqual(doc, wantCounter(12)) {
+		t.Fatalf("Replay = %v at %d", doc, v)
+	}
+
+	var actors []string
+	if err := j.Records(10, func(rec journal.Record) error {
+		actors = append(actors, rec.Actor)
+		if rec.Time.IsZero() {
+			t.Errorf("record %d has no time", rec.Version)
+		}
+		return nil
+	}); err != nil || len(actors) != 2 {
+		t.Fatalf("Records(10) returned %v, %v", actors, err)
+	}
+}
+
+func TestJournalTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	j := openJournal(t, dir, journal.Options{})
+	if err := j.Snapshot(wantCounter(0), 0); err != nil {
+		t.Fatal(err)
+	}
+	appendCounter(t, j, 1, 3)
+	j.Close()
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segs) != 1 {
+		t.Fatalf("segments: %v", segs)
+	}
+	info, err := os.Stat(segs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a crash in the middle of writing the third record.
+	if err := os.Truncate(segs[0], info.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+
+	j = openJournal(t, dir, journal.Options{})
+	doc, v := replay(t, j)
+	if v != 2 || !reflect.DeepEqual(doc, wantCounter(2)) {
+		t.Fatalf("after torn write: %v at %d", doc, v)
+	}
+	appendCounter(t, j, 3, 4)
+	j.Close()
+
+	j = openJournal(t, dir, journal.Options{})
+	if doc, v := replay(t, j); v != 4 || !reflect.DeepEqual(doc, wantCounter(4)) {
+		t.Fatalf("after recovery: %v at %d", doc, v)
+	}
+}
+
+func TestJournalCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	j := openJournal(t, dir, journal.Options{SegmentSize: 100})
+	appendCounter(t, j, 1, 6)
+	j.Close()
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segs) < 2 {
+		t.Fatalf("segments: %v", segs)
+	}
+	data, err := os.ReadFile(segs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-2] ^= 0xff
+	if err := os.WriteFile(segs[0], data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Open(dir, journal.Options{}); !errors.Is(err, journal.ErrCorrupt) {
+		t.Fatalf("Open error = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestJournalCorruptLastSegment(t *testing.T) {
+	dir := t.TempDir()
+	j := openJournal(t, dir, journal.Options{})
+	appendCounter(t, j, 1, 3)
+	j.Close()
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segs) != 1 {
+		t.Fatalf("segments: %v", segs)
+	}
+	data, err := os.ReadFile(segs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Damage the first record; the intact records after it must not be
+	// truncated away as if they were a torn write.
+	data[10] ^= 0xff
+	if err := os.WriteFile(segs[0], data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Open(dir, journal.Options{}); !errors.Is(err, journal.ErrCorrupt) {
+		t.Fatalf("Open error = %v, want ErrCorrupt", err)
+	}
+	if info, err := os.Stat(segs[0]); err != nil || info.Size() != int64(len(data)) {
+		t.Fatalf("segment was modified: %v, %v", info, err)
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	dir := t.TempDir()
+	j := openJournal(t, dir, journal.Options{SegmentSize: 150, Sync: journal.SyncNever})
+	if err := j.Snapshot(wantCounter(0), 0); err != nil {
+		t.Fatal(err)
+	}
+	appendCounter(t, j, 1, 10)
+	if err := j.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	snaps, _ := filepath.Glob(filepath.Join(dir, "*.snap"))
+	if len(segs) != 1 || len(snaps) != 1 {
+		t.Fatalf("after Compact: segments %v, snapshots %v", segs, snaps)
+	}
+	if err := j.Records(0, func(journal.Record) error { return nil }); !errors.Is(err, journal.ErrCompacted) {
+		t.Fatalf("Records(0) error = %v, want ErrCompacted", err)
+	}
+	appendCounter(t, j, 11, 12)
+	if err := j.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j = openJournal(t, dir, journal.Options{})
+	if doc, v := replay(t, j); v != 12 || !reflect.DeepEqual(doc, wantCounter(12)) {
+		t.Fatalf("after Compact: %v at %d", doc, v)
+	}
+}
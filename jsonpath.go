@@ -0,0 +1,1033 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonPath is a parsed RFC 9535 JSONPath query.
+type jsonPath struct {
+	segments []jpSegment
+}
+
+// jpSegment is a child ("[...]", ".name") or descendant ("..[...]", "..name") segment.
+type jpSegment struct {
+	descendant bool
+	selectors  []jpSelector
+}
+
+type jpSelectorKind int
+
+const (
+	jpName jpSelectorKind = iota
+	jpWildcard
+	jpIndex
+	jpSlice
+	jpFilter
+)
+
+type jpSelector struct {
+	kind   jpSelectorKind
+	name   string
+	index  int
+	start  *int
+	end    *int
+	step   *int
+	filter jpExpr
+}
+
+// jpNode is a value selected by a query together with its location.
+type jpNode struct {
+	value any
+	path  []string
+}
+
+// pointer renders the node location as an RFC 6901 JSON Pointer.
+func (n jpNode) pointer() string {
+	var b strings.Builder
+	for _, tok := range n.path {
+		b.WriteByte('/')
+		b.WriteString(escapeToken(tok))
+	}
+	return b.String()
+}
+
+// parseJSONPath parses an RFC 9535 JSONPath query such as "$.items[*].status".
+func parseJSONPath(s string) (*jsonPath, error) {
+	p := &jpParser{src: s}
+	q, err := p.parseQuery('$')
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return q, nil
+}
+
+// singular reports whether the query selects at most one node (name and index selectors only).
+func (q *jsonPath) singular() bool {
+	for _, seg := range q.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return false
+		}
+		if k := seg.selectors[0].kind; k != jpName && k != jpIndex {
+			return false
+		}
+	}
+	return true
+}
+
+// selectParent splits off a trailing single-name segment so that add operations
+// can target members that do not exist yet. It returns the parent query and the
+// member name, or ok=false when the last segment is not a single name selector.
+func (q *jsonPath) selectParent() (parent *jsonPath, name string, ok bool) {
+	if len(q.segments) == 0 {
+		return nil, "", false
+	}
+	last := q.segments[len(q.segments)-1]
+	if last.descendant || len(last.selectors) != 1 || last.selectors[0].kind != jpName {
+		return nil, "", false
+	}
+	return &jsonPath{segments: q.segments[:len(q.segments)-1]}, last.selectors[0].name, true
+}
+
+// eval evaluates the query against root, returning nodes in document order.
+func (q *jsonPath) eval(root any) []jpNode {
+	return q.evalFrom(root, jpNode{value: root})
+}
+
+func (q *jsonPath) evalFrom(root any, start jpNode) []jpNode {
+	var nodes []jpNode
+	q.visit(root, start, func(n jpNode) bool {
+		nodes = append(nodes, n)
+		return true
+	})
+	return nodes
+}
+
+// visit calls f with the nodes selected from start in document order, until
+// f returns false. Each node is carried through all segments before the next
+// is selected, so no intermediate node list is built and a caller can stop
+// early.
+func (q *jsonPath) visit(root any, start jpNode, f func(jpNode) bool) bool {
+	var walk func(n jpNode, segments []jpSegment) bool
+	walk = func(n jpNode, segments []jpSegment) bool {
+		if len(segments) == 0 {
+			return f(n)
+		}
+		seg := segments[0]
+		step := func(d jpNode) bool {
+			for _, c := range seg.apply(root, d, nil) {
+				if !walk(c, segments[1:]) {
+					return false
+				}
+			}
+			return true
+		}
+		if seg.descendant {
+			return visitDescendants(n, step)
+		}
+		return step(n)
+	}
+	return walk(start, q.segments)
+}
+
+func (seg jpSegment) apply(root any, n jpNode, out []jpNode) []jpNode {
+	for _, sel := range seg.selectors {
+		out = sel.apply(root, n, out)
+	}
+	return out
+}
+
+// visitDescendants calls f with n and all of its descendants in pre-order,
+// until f returns false.
+func visitDescendants(n jpNode, f func(jpNode) bool) bool {
+	if !f(n) {
+		return false
+	}
+	for _, c := range children(n) {
+		if !visitDescendants(c, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// children returns the direct children of n. Object members are ordered by key
+// so that expansion is deterministic.
+func children(n jpNode) []jpNode {
+	switch v := n.value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]jpNode, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, n.child(k, v[k]))
+		}
+		return out
+	case []any:
+		out := make([]jpNode, 0, len(v))
+		for i, e := range v {
+			out = append(out, n.child(strconv.Itoa(i), e))
+		}
+		return out
+	}
+	return nil
+}
+
+func (n jpNode) child(tok string, value any) jpNode {
+	path := make([]string, len(n.path)+1)
+	copy(path, n.path)
+	path[len(n.path)] = tok
+	return jpNode{value: value, path: path}
+}
+
+func (sel jpSelector) apply(root any, n jpNode, out []jpNode) []jpNode {
+	switch sel.kind {
+	case jpName:
+		if m, ok := n.value.(map[string]any); ok {
+			if v, ok := m[sel.name]; ok {
+				out = append(out, n.child(sel.name, v))
+			}
+		}
+	case jpWildcard:
+		out = append(out, children(n)...)
+	case jpIndex:
+		if arr, ok := n.value.([]any); ok {
+			i := sel.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				out = append(out, n.child(strconv.Itoa(i), arr[i]))
+			}
+		}
+	case jpSlice:
+		if arr, ok := n.value.([]any); ok {
+			for _, i := range sliceIndices(len(arr), sel.start, sel.end, sel.step) {
+				out = append(out, n.child(strconv.Itoa(i), arr[i]))
+			}
+		}
+	case jpFilter:
+		for _, c := range children(n) {
+			if sel.filter.test(root, c.value) {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// sliceIndices implements the RFC 9535 array slice selector semantics.
+func sliceIndices(length int, startPtr, endPtr, stepPtr *int) []int {
+	step := 1
+	if stepPtr != nil {
+		step = *stepPtr
+	}
+	if step == 0 {
+		return nil
+	}
+	normalize := func(i int) int {
+		if i < 0 {
+			return length + i
+		}
+		return i
+	}
+	var start, end int
+	if step > 0 {
+		start, end = 0, length
+	} else {
+		start, end = length-1, -length-1
+	}
+	if startPtr != nil {
+		start = normalize(*startPtr)
+	}
+	if endPtr != nil {
+		end = normalize(*endPtr)
+	}
+	var out []int
+	if step > 0 {
+		lower := max(min(start, length), 0)
+		upper := max(min(end, length), 0)
+		for i := lower; i < upper; i += step {
+			out = append(out, i)
+		}
+		return out
+	}
+	upper := max(min(start, length-1), -1)
+	lower := max(min(end, length-1), -1)
+	for i := upper; lower < i; i += step {
+		out = append(out, i)
+	}
+	return out
+}
+
+// Filter expressions.
+
+type jpExpr interface {
+	test(root, current any) bool
+}
+
+type jpOr []jpExpr
+
+func (e jpOr) test(root, current any) bool {
+	for _, x := range e {
+		if x.test(root, current) {
+			return true
+		}
+	}
+	return false
+}
+
+type jpAnd []jpExpr
+
+func (e jpAnd) test(root, current any) bool {
+	for _, x := range e {
+		if !x.test(root, current) {
+			return false
+		}
+	}
+	return true
+}
+
+type jpNot struct{ expr jpExpr }
+
+func (e jpNot) test(root, current any) bool { return !e.expr.test(root, current) }
+
+// jpExists is a test expression on a filter query: true when it selects any node.
+type jpExists struct{ query *jpQuery }
+
+func (e jpExists) test(root, current any) bool {
+	return len(e.query.eval(root, current)) > 0
+}
+
+// jpFuncTest is a test expression on a function returning a logical value.
+type jpFuncTest struct{ fn *jpFunc }
+
+func (e jpFuncTest) test(root, current any) bool {
+	v, ok := e.fn.eval(root, current)
+	b, isBool := v.(bool)
+	return ok && isBool && b
+}
+
+type jpCompare struct {
+	op          string
+	left, right jpOperand
+}
+
+func (e jpCompare) test(root, current any) bool {
+	l, lok := e.left.value(root, current)
+	r, rok := e.right.value(root, current)
+	switch e.op {
+	case "==":
+		return jpEqual(l, lok, r, rok)
+	case "!=":
+		return !jpEqual(l, lok, r, rok)
+	case "<":
+		return jpLess(l, lok, r, rok)
+	case ">":
+		return jpLess(r, rok, l, lok)
+	case "<=":
+		return jpLess(l, lok, r, rok) || jpEqual(l, lok, r, rok)
+	case ">=":
+		return jpLess(r, rok, l, lok) || jpEqual(l, lok, r, rok)
+	}
+	return false
+}
+
+func jpEqual(l any, lok bool, r any, rok bool) bool {
+	if !lok || !rok {
+		return !lok && !rok
+	}
+	if lf, ok := toFloat(l); ok {
+		rf, ok := toFloat(r)
+		return ok && lf == rf
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+func jpLess(l any, lok bool, r any, rok bool) bool {
+	if !lok || !rok {
+		return false
+	}
+	if lf, ok := toFloat(l); ok {
+		rf, ok := toFloat(r)
+		return ok && lf < rf
+	}
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		return ok && ls < rs
+	}
+	return false
+}
+
+// toFloat reports numeric values as float64 regardless of their Go type.
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// jpOperand is a comparable: a literal, a singular query or a function call.
+// value returns ok=false for the special result Nothing.
+type jpOperand interface {
+	value(root, current any) (any, bool)
+}
+
+type jpLiteral struct{ v any }
+
+func (l jpLiteral) value(root, current any) (any, bool) { return l.v, true }
+
+// jpQuery is a filter query relative to the current node ("@") or the root ("$").
+type jpQuery struct {
+	relative bool
+	path     *jsonPath
+}
+
+func (q *jpQuery) eval(root, current any) []jpNode {
+	start := root
+	if q.relative {
+		start = current
+	}
+	return q.path.evalFrom(root, jpNode{value: start})
+}
+
+func (q *jpQuery) value(root, current any) (any, bool) {
+	nodes := q.eval(root, current)
+	if len(nodes) != 1 {
+		return nil, false
+	}
+	return nodes[0].value, true
+}
+
+type jpFunc struct {
+	name string
+	args []any // jpOperand, *jpQuery or jpExpr
+	// re is the compiled pattern of match or search when it is a literal;
+	// invalid marks a literal pattern that does not compile.
+	re      *regexp.Regexp
+	invalid bool
+}
+
+func (f *jpFunc) eval(root, current any) (any, bool) {
+	switch f.name {
+	case "length":
+		v, ok := f.valueArg(0, root, current)
+		if !ok {
+			return nil, false
+		}
+		switch t := v.(type) {
+		case string:
+			return float64(utf8.RuneCountInString(t)), true
+		case []any:
+			return float64(len(t)), true
+		case map[string]any:
+			return float64(len(t)), true
+		}
+		return nil, false
+	case "count":
+		q := f.args[0].(*jpQuery)
+		return float64(len(q.eval(root, current))), true
+	case "value":
+		q := f.args[0].(*jpQuery)
+		nodes := q.eval(root, current)
+		if len(nodes) != 1 {
+			return nil, false
+		}
+		return nodes[0].value, true
+	case "match", "search":
+		s, ok := f.valueArg(0, root, current)
+		if !ok {
+			return false, true
+		}
+		p, ok := f.valueArg(1, root, current)
+		if !ok {
+			return false, true
+		}
+		str, sok := s.(string)
+		pat, pok := p.(string)
+		if !sok || !pok || f.invalid {
+			return false, true
+		}
+		re := f.re
+		if re == nil {
+			var err error
+			if re, err = compileFuncPattern(f.name, pat); err != nil {
+				return false, true
+			}
+		}
+		return re.MatchString(str), true
+	}
+	return nil, false
+}
+
+func (f *jpFunc) value(root, current any) (any, bool) { return f.eval(root, current) }
+
+// compileFuncPattern compiles the pattern of match, which must match the
+// whole string, or search.
+func compileFuncPattern(name, pat string) (*regexp.Regexp, error) {
+	if name == "match" {
+		pat = "^(?:" + pat + ")$"
+	}
+	return regexp.Compile(pat)
+}
+
+func (f *jpFunc) valueArg(i int, root, current any) (any, bool) {
+	switch a := f.args[i].(type) {
+	case jpOperand:
+		return a.value(root, current)
+	case *jpQuery:
+		return a.value(root, current)
+	}
+	return nil, false
+}
+
+// jpFunctions lists the RFC 9535 function extensions: the number of arguments
+// and whether the result is a logical (test) or a value (comparable).
+var jpFunctions = map[string]struct {
+	arity   int
+	logical bool
+}{
+	"length": {1, false},
+	"count":  {1, false},
+	"value":  {1, false},
+	"match":  {2, true},
+	"search": {2, true},
+}
+
+// Parser.
+
+type jpParser struct {
+	src string
+	pos int
+}
+
+func (p *jpParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("jsonpatch: invalid JSONPath %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jpParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *jpParser) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *jpParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// parseQuery parses identifier ('$' or '@') followed by segments.
+func (p *jpParser) parseQuery(identifier byte) (*jsonPath, error) {
+	if p.peek() != identifier {
+		return nil, p.errorf("expected %q", identifier)
+	}
+	p.pos++
+	q := &jsonPath{}
+	for {
+		// Whitespace may precede a segment, but only if a segment follows.
+		save := p.pos
+		p.skipSpace()
+		switch {
+		case p.consume(".."):
+			seg, err := p.parseSegmentBody(true)
+			if err != nil {
+				return nil, err
+			}
+			q.segments = append(q.segments, seg)
+		case p.peek() == '.':
+			p.pos++
+			seg, err := p.parseSegmentBody(false)
+			if err != nil {
+				return nil, err
+			}
+			q.segments = append(q.segments, seg)
+		case p.peek() == '[':
+			sels, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			q.segments = append(q.segments, jpSegment{selectors: sels})
+		default:
+			p.pos = save
+			return q, nil
+		}
+	}
+}
+
+// parseSegmentBody parses what follows "." or "..": a wildcard, a member name
+// shorthand or (for descendants only) a bracketed selection.
+func (p *jpParser) parseSegmentBody(descendant bool) (jpSegment, error) {
+	if p.peek() == '*' {
+		p.pos++
+		return jpSegment{descendant: descendant, selectors: []jpSelector{{kind: jpWildcard}}}, nil
+	}
+	if descendant && p.peek() == '[' {
+		sels, err := p.parseBracket()
+		if err != nil {
+			return jpSegment{}, err
+		}
+		return jpSegment{descendant: true, selectors: sels}, nil
+	}
+	name := p.parseMemberName()
+	if name == "" {
+		return jpSegment{}, p.errorf("expected member name")
+	}
+	return jpSegment{descendant: descendant, selectors: []jpSelector{{kind: jpName, name: name}}}, nil
+}
+
+func (p *jpParser) parseMemberName() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		isFirst := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r >= 0x80
+		isDigit := r >= '0' && r <= '9'
+		if !isFirst && !(isDigit && p.pos > start) {
+			break
+		}
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+// parseBracket parses "[" selector *("," selector) "]".
+func (p *jpParser) parseBracket() ([]jpSelector, error) {
+	p.pos++ // '['
+	var sels []jpSelector
+	for {
+		p.skipSpace()
+		sel, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+		p.skipSpace()
+		if p.consume(",") {
+			continue
+		}
+		if p.consume("]") {
+			return sels, nil
+		}
+		return nil, p.errorf("expected ',' or ']'")
+	}
+}
+
+func (p *jpParser) parseSelector() (jpSelector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return jpSelector{}, err
+		}
+		return jpSelector{kind: jpName, name: s}, nil
+	case c == '*':
+		p.pos++
+		return jpSelector{kind: jpWildcard}, nil
+	case c == '?':
+		p.pos++
+		p.skipSpace()
+		expr, err := p.parseLogicalOr()
+		if err != nil {
+			return jpSelector{}, err
+		}
+		return jpSelector{kind: jpFilter, filter: expr}, nil
+	case c == ':' || c == '-' || (c >= '0' && c <= '9'):
+		return p.parseIndexOrSlice()
+	}
+	return jpSelector{}, p.errorf("invalid selector")
+}
+
+func (p *jpParser) parseIndexOrSlice() (jpSelector, error) {
+	var parts [3]*int
+	n := 0
+	for {
+		p.skipSpace()
+		if c := p.peek(); c == '-' || (c >= '0' && c <= '9') {
+			v, err := p.parseInt()
+			if err != nil {
+				return jpSelector{}, err
+			}
+			parts[n] = &v
+		}
+		p.skipSpace()
+		if p.peek() != ':' || n == 2 {
+			break
+		}
+		p.pos++
+		n++
+	}
+	if n == 0 {
+		if parts[0] == nil {
+			return jpSelector{}, p.errorf("expected index")
+		}
+		return jpSelector{kind: jpIndex, index: *parts[0]}, nil
+	}
+	return jpSelector{kind: jpSlice, start: parts[0], end: parts[1], step: parts[2]}, nil
+}
+
+func (p *jpParser) parseInt() (int, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	digits := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	lit := p.src[start:p.pos]
+	if p.pos == digits || (p.src[digits] == '0' && (p.pos-digits > 1 || digits > start)) {
+		return 0, p.errorf("invalid integer %q", lit)
+	}
+	v, err := strconv.Atoi(lit)
+	if err != nil {
+		return 0, p.errorf("invalid integer %q", lit)
+	}
+	return v, nil
+}
+
+// parseString parses a single- or double-quoted string literal.
+func (p *jpParser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\':
+			p.pos++
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated escape")
+			}
+			esc := p.src[p.pos]
+			p.pos++
+			switch esc {
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '/', '\\', '\'', '"':
+				if (esc == '\'' || esc == '"') && esc != quote {
+					return "", p.errorf("invalid escape \\%c", esc)
+				}
+				b.WriteByte(esc)
+			case 'u':
+				r, err := p.parseHex4()
+				if err != nil {
+					return "", err
+				}
+				if r >= 0xD800 && r <= 0xDBFF && p.consume(`\u`) {
+					lo, err := p.parseHex4()
+					if err != nil {
+						return "", err
+					}
+					r = 0x10000 + (r-0xD800)<<10 + (lo - 0xDC00)
+				}
+				b.WriteRune(r)
+			default:
+				return "", p.errorf("invalid escape \\%c", esc)
+			}
+		case c < 0x20:
+			return "", p.errorf("control character in string")
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *jpParser) parseHex4() (rune, error) {
+	if p.pos+4 > len(p.src) {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	v, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	p.pos += 4
+	return rune(v), nil
+}
+
+func (p *jpParser) parseLogicalOr() (jpExpr, error) {
+	var or jpOr
+	for {
+		and, err := p.parseLogicalAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, and)
+		p.skipSpace()
+		if !p.consume("||") {
+			break
+		}
+		p.skipSpace()
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *jpParser) parseLogicalAnd() (jpExpr, error) {
+	var and jpAnd
+	for {
+		basic, err := p.parseBasic()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, basic)
+		p.skipSpace()
+		if !p.consume("&&") {
+			break
+		}
+		p.skipSpace()
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *jpParser) parseBasic() (jpExpr, error) {
+	negate := false
+	if p.peek() == '!' && !strings.HasPrefix(p.src[p.pos:], "!=") {
+		p.pos++
+		p.skipSpace()
+		negate = true
+	}
+	var expr jpExpr
+	if p.consume("(") {
+		p.skipSpace()
+		inner, err := p.parseLogicalOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		expr = inner
+	} else {
+		left, err := p.parseComparable()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		op := p.parseCompareOp()
+		switch {
+		case op != "":
+			if negate {
+				return nil, p.errorf("'!' cannot negate a comparison")
+			}
+			p.skipSpace()
+			right, err := p.parseComparable()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.checkComparable(left); err != nil {
+				return nil, err
+			}
+			if err := p.checkComparable(right); err != nil {
+				return nil, err
+			}
+			return jpCompare{op: op, left: toOperand(left), right: toOperand(right)}, nil
+		default:
+			switch t := left.(type) {
+			case *jpQuery:
+				expr = jpExists{query: t}
+			case *jpFunc:
+				if !jpFunctions[t.name].logical {
+					return nil, p.errorf("function %s() is not a test", t.name)
+				}
+				expr = jpFuncTest{fn: t}
+			default:
+				return nil, p.errorf("literal is not a test expression")
+			}
+		}
+	}
+	if negate {
+		return jpNot{expr: expr}, nil
+	}
+	return expr, nil
+}
+
+func (p *jpParser) parseCompareOp() string {
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// checkComparable enforces that queries used in comparisons are singular and
+// that functions used in comparisons return values.
+func (p *jpParser) checkComparable(v any) error {
+	switch t := v.(type) {
+	case *jpQuery:
+		if !t.path.singular() {
+			return p.errorf("non-singular query in comparison")
+		}
+	case *jpFunc:
+		if jpFunctions[t.name].logical {
+			return p.errorf("function %s() cannot be compared", t.name)
+		}
+	}
+	return nil
+}
+
+func toOperand(v any) jpOperand {
+	switch t := v.(type) {
+	case *jpQuery:
+		return t
+	case *jpFunc:
+		return t
+	case jpLiteral:
+		return t
+	}
+	return jpLiteral{}
+}
+
+// parseComparable parses a literal, a filter query or a function call.
+// It returns jpLiteral, *jpQuery or *jpFunc.
+func (p *jpParser) parseComparable() (any, error) {
+	c := p.peek()
+	switch {
+	case c == '@' || c == '$':
+		path, err := p.parseQuery(c)
+		if err != nil {
+			return nil, err
+		}
+		return &jpQuery{relative: c == '@', path: path}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return jpLiteral{v: s}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case p.consume("true"):
+		return jpLiteral{v: true}, nil
+	case p.consume("false"):
+		return jpLiteral{v: false}, nil
+	case p.consume("null"):
+		return jpLiteral{v: nil}, nil
+	case c >= 'a' && c <= 'z':
+		return p.parseFunction()
+	}
+	return nil, p.errorf("expected comparable")
+}
+
+func (p *jpParser) parseNumber() (any, error) {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("+-0123456789.eE", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	f, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil || math.IsInf(f, 0) {
+		return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+	}
+	return jpLiteral{v: f}, nil
+}
+
+func (p *jpParser) parseFunction() (any, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '_' || (p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z') || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	spec, ok := jpFunctions[name]
+	if !ok {
+		return nil, p.errorf("unknown function %q", name)
+	}
+	if !p.consume("(") {
+		return nil, p.errorf("expected '(' after %s", name)
+	}
+	fn := &jpFunc{name: name}
+	for {
+		p.skipSpace()
+		if p.consume(")") {
+			break
+		}
+		if len(fn.args) > 0 {
+			if !p.consume(",") {
+				return nil, p.errorf("expected ',' or ')'")
+			}
+			p.skipSpace()
+		}
+		arg, err := p.parseComparable()
+		if err != nil {
+			return nil, err
+		}
+		fn.args = append(fn.args, arg)
+	}
+	if len(fn.args) != spec.arity {
+		return nil, p.errorf("%s() takes %d argument(s)", name, spec.arity)
+	}
+	if name == "count" || name == "value" {
+		if _, ok := fn.args[0].(*jpQuery); !ok {
+			return nil, p.errorf("%s() requires a query argument", name)
+		}
+	}
+	if name == "match" || name == "search" {
+		// Compile literal patterns once instead of on every evaluation.
+		if lit, ok := fn.args[1].(jpLiteral); ok {
+			if pat, ok := lit.v.(string); ok {
+				re, err := compileFuncPattern(name, pat)
+				fn.re, fn.invalid = re, err != nil
+			}
+		}
+	}
+	return fn, nil
+}
@@ -0,0 +1,106 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONPathEval(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{
+		"store": {
+			"book": [
+				{"category": "reference", "author": "Nigel Rees", "title": "Sayings", "price": 8.95},
+				{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword", "price": 12.99},
+				{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553", "price": 8.99},
+				{"category": "fiction", "author": "J. R. R. Tolkien", "title": "Rings", "isbn": "0-395", "price": 22.99}
+			],
+			"bicycle": {"color": "red", "price": 399}
+		}
+	}`), &doc)
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{`$`, []string{""}},
+		{`$.store.bicycle.color`, []string{"/store/bicycle/color"}},
+		{`$['store']["bicycle"]`, []string{"/store/bicycle"}},
+		{`$.store.book[*].author`, []string{"/store/book/0/author", "/store/book/1/author", "/store/book/2/author", "/store/book/3/author"}},
+		{`$..author`, []string{"/store/book/0/author", "/store/book/1/author", "/store/book/2/author", "/store/book/3/author"}},
+		{`$.store.*`, []string{"/store/bicycle", "/store/book"}},
+		{`$.store.book[-1]`, []string{"/store/book/3"}},
+		{`$.store.book[0,1]`, []string{"/store/book/0", "/store/book/1"}},
+		{`$.store.book[:2]`, []string{"/store/book/0", "/store/book/1"}},
+		{`$.store.book[::-2]`, []string{"/store/book/3", "/store/book/1"}},
+		{`$.store.book[?@.isbn]`, []string{"/store/book/2", "/store/book/3"}},
+		{`$.store.book[?@.price < 10]`, []string{"/store/book/0", "/store/book/2"}},
+		{`$.store.book[?@.price < 10 && @.category == 'fiction']`, []string{"/store/book/2"}},
+		{`$.store.book[?!(@.category == 'fiction') || @.price > 20]`, []string{"/store/book/0", "/store/book/3"}},
+		{`$.store.book[?@.price > $.store.bicycle.price]`, nil},
+		{`$.store.book[?length(@.title) == 5]`, []string{"/store/book/1", "/store/book/3"}},
+		{`$.store.book[?match(@.author, 'J.*')]`, []string{"/store/book/3"}},
+		{`$.store.book[?search(@.author, 'Mel')]`, []string{"/store/book/2"}},
+		{`$.store.book[?search(@.author, '(')]`, nil},
+		{`$.store.book[?match(@.category, @.category)]`, []string{"/store/book/0", "/store/book/1", "/store/book/2", "/store/book/3"}},
+		{`$.store[?count(@[*]) == 4]`, []string{"/store/book"}},
+		{`$..[?@.color]`, []string{"/store/bicycle"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := parseJSONPath(tc.query)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			var got []string
+			for _, n := range q.eval(doc) {
+				got = append(got, n.pointer())
+			}
+			if len(got) == 0 && len(tc.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestExpandPathStopsEarly(t *testing.T) {
+	items := make([]any, 1000)
+	for i := range items {
+		items[i] = map[string]any{"v": float64(i)}
+	}
+	doc := map[string]any{"items": items}
+	for _, path := range []string{"$..*", "$.items[*].v", "/items/*/v"} {
+		got, err := expandPath(doc, path, false, 3)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if len(got) != 4 {
+			t.Errorf("%s: got %d matches, want expansion to stop after 4", path, len(got))
+		}
+	}
+}
+
+func TestJSONPathParseErrors(t *testing.T) {
+	for _, query := range []string{
+		``,
+		`store`,
+		`$.`,
+		`$[`,
+		`$[01]`,
+		`$['a`,
+		`$[?@.a == ]`,
+		`$[?@.* == 1]`,
+		`$[?length(@.a)]`,
+		`$[?nope(@)]`,
+		`$.a b`,
+	} {
+		if _, err := parseJSONPath(query); err == nil {
+			t.Errorf("expected parse error for %q", query)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// Limits bounds the resources a patch may consume, making it safe to apply
+// patches from untrusted sources. A zero field means no limit.
+type Limits struct {
+	// MaxOperations caps the number of operations, counting each operation
+	// produced by path expansion.
+	MaxOperations int
+	// MaxPointerDepth caps the number of reference tokens in path and from.
+	MaxPointerDepth int
+	// MaxDocumentNodes caps the number of values (objects, arrays and scalars)
+	// in the resulting document.
+	MaxDocumentNodes int
+	// MaxCopyNodes caps the number of values in a subtree copied by a copy operation.
+	MaxCopyNodes int
+	// MaxArrayIndex caps array indices addressed by path and from.
+	MaxArrayIndex int
+}
+
+// ErrLimitExceeded is matched by errors.Is for every *LimitError.
+var ErrLimitExceeded = errors.New("jsonpatch: limit exceeded")
+
+// LimitError reports that applying a patch would exceed one of its Limits.
+// It is returned before the offending operation is applied.
+type LimitError struct {
+	// Limit is the name of the exceeded Limits field, e.g. "MaxOperations".
+	Limit string
+	// Max is the configured limit.
+	Max int
+	// Actual is the value that exceeded it. Node counts and path expansion
+	// stop early, so for them it is a lower bound.
+	Actual int
+	// Path is the pointer involved, if any.
+	Path string
+}
+
+func (e *LimitError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("jsonpatch: %s exceeded at '%s': %d > %d", e.Limit, e.Path, e.Actual, e.Max)
+	}
+	return fmt.Sprintf("jsonpatch: %s exceeded: %d > %d", e.Limit, e.Actual, e.Max)
+}
+
+// Is makes errors.Is(err, ErrLimitExceeded) report true.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// WithLimits enforces limits while applying or preparing a patch.
+func WithLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = &limits
+	}
+}
+
+// limiter tracks the running operation and node counts of one patch application.
+type limiter struct {
+	Limits
+	ops   int
+	nodes int
+}
+
+// newLimiter returns nil when no limits are configured. It rejects oversized
+// patches and documents up front.
+func newLimiter(limits *Limits, document any, patch Patch) (*limiter, error) {
+	if limits == nil {
+		return nil, nil
+	}
+	if limits.MaxOperations > 0 && len(patch) > limits.MaxOperations {
+		return nil, &LimitError{Limit: "MaxOperations", Max: limits.MaxOperations, Actual: len(patch)}
+	}
+	l := &limiter{Limits: *limits}
+	if l.MaxDocumentNodes > 0 {
+		l.nodes = countNodes(document, l.MaxDocumentNodes)
+		if l.nodes > l.MaxDocumentNodes {
+			return nil, &LimitError{Limit: "MaxDocumentNodes", Max: l.MaxDocumentNodes, Actual: l.nodes}
+		}
+	}
+	return l, nil
+}
+
+// remaining returns how many more operations may be applied, or -1 if there
+// is no limit.
+func (l *limiter) remaining() int {
+	if l == nil || l.MaxOperations == 0 {
+		return -1
+	}
+	return max(l.MaxOperations-l.ops, 0)
+}
+
+// checkExpansion rejects op if the n operations it expands to would exceed
+// MaxOperations, before any of them is applied.
+func (l *limiter) checkExpansion(op Operation, n int) error {
+	if l == nil || l.MaxOperations == 0 || l.ops+n <= l.MaxOperations {
+		return nil
+	}
+	return &LimitError{Limit: "MaxOperations", Max: l.MaxOperations, Actual: l.ops + n, Path: op.Path}
+}
+
+// check validates a concrete operation against the limits before it is applied
+// to document and accounts for its effect on the document size.
+func (l *limiter) check(document any, op Operation) error {
+	l.ops++
+	if l.MaxOperations > 0 && l.ops > l.MaxOperations {
+		return &LimitError{Limit: "MaxOperations", Max: l.MaxOperations, Actual: l.ops}
+	}
+	if err := l.checkPointer(document, op.Path); err != nil {
+		return err
+	}
+	if op.Op == Move || op.Op == Copy {
+		if err := l.checkPointer(document, op.From); err != nil {
+			return err
+		}
+	}
+
+	var added int
+	if op.Op == Copy && l.MaxCopyNodes > 0 {
+		src, err := getPointer(document, op.From)
+		if err != nil {
+			return err
+		}
+		if n := countNodes(src, l.MaxCopyNodes); n > l.MaxCopyNodes {
+			return &LimitError{Limit: "MaxCopyNodes", Max: l.MaxCopyNodes, Actual: n, Path: op.From}
+		}
+	}
+	if l.MaxDocumentNodes == 0 {
+		return nil
+	}
+
+	var removed int
+	switch op.Op {
+	case Add, Copy, Move:
+		if v, ok := addTarget(document, op.Path); ok {
+			removed = countNodes(v, l.MaxDocumentNodes)
+		}
+	case Remove, Replace:
+		if v, err := getPointer(document, op.Path); err == nil {
+			removed = countNodes(v, l.MaxDocumentNodes)
+		}
+	}
+	budget := l.MaxDocumentNodes - l.nodes + removed
+	switch op.Op {
+	case Add, Replace:
+		added = countNodes(op.Value, budget)
+	case Copy:
+		if src, err := getPointer(document, op.From); err == nil {
+			added = countNodes(src, budget)
+		}
+	}
+	if added > budget {
+		return &LimitError{Limit: "MaxDocumentNodes", Max: l.MaxDocumentNodes, Actual: l.nodes - removed + added, Path: op.Path}
+	}
+	l.nodes += added - removed
+	return nil
+}
+
+// checkPointer enforces MaxPointerDepth and MaxArrayIndex on path.
+func (l *limiter) checkPointer(document any, path string) error {
+	if l.MaxPointerDepth > 0 {
+		// Count separators first so oversized pointers are never parsed.
+		if depth := strings.Count(path, "/"); depth > l.MaxPointerDepth {
+			return &LimitError{Limit: "MaxPointerDepth", Max: l.MaxPointerDepth, Actual: depth, Path: path}
+		}
+	}
+	if l.MaxArrayIndex == 0 {
+		return nil
+	}
+	tokens, err := jsonpointer.New(path)
+	if err != nil {
+		return err
+	}
+	current := document
+	for _, tok := range tokens {
+		switch c := current.(type) {
+		case map[string]any:
+			current = c[tok]
+		case *OrderedObject:
+			current, _ = c.Get(tok)
+		case []any:
+			idx, err := jsonpointer.ParseArrayIndex(tok)
+			if err != nil {
+				return nil
+			}
+			if idx > uint64(l.MaxArrayIndex) {
+				actual := math.MaxInt
+				if idx < math.MaxInt {
+					actual = int(idx)
+				}
+				return &LimitError{Limit: "MaxArrayIndex", Max: l.MaxArrayIndex, Actual: actual, Path: path}
+			}
+			if idx >= uint64(len(c)) {
+				return nil
+			}
+			current = c[idx]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// addTarget returns the value an add-like operation at path would overwrite.
+// Adding into an array inserts, so it overwrites nothing.
+func addTarget(document any, path string) (any, bool) {
+	p, err := jsonpointer.New(path)
+	if err != nil {
+		return nil, false
+	}
+	if len(p) == 0 {
+		return document, true
+	}
+	parent, err := getTokens(document, p[:len(p)-1])
+	if err != nil {
+		return nil, false
+	}
+	switch c := parent.(type) {
+	case map[string]any:
+		v, ok := c[p[len(p)-1]]
+		return v, ok
+	case *OrderedObject:
+		return c.Get(p[len(p)-1])
+	}
+	return nil, false
+}
+
+// countNodes counts value and all of its descendants. Counting stops once the
+// count exceeds limit, so shared subtrees cannot make it run unbounded.
+func countNodes(value any, limit int) int {
+	n := 0
+	var walk func(v any) bool
+	walk = func(v any) bool {
+		n++
+		if n > limit {
+			return false
+		}
+		switch c := v.(type) {
+		case map[string]any:
+			for _, e := range c {
+				if !walk(e) {
+					return false
+				}
+			}
+		case *OrderedObject:
+			for _, e := range c.values {
+				if !walk(e) {
+					return false
+				}
+			}
+		case []any:
+			for _, e := range c {
+				if !walk(e) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	walk(value)
+	return n
+}
@@ -0,0 +1,136 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestApplyLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		doc    string
+		patch  string
+		limits jsonpatch.Limits
+		limit  string
+	}{
+		{
+			name:   "within limits",
+			doc:    `{"a":[1,2]}`,
+			patch:  `[{"op":"add","path":"/a/-","value":3},{"op":"copy","from":"/a","path":"/b"}]`,
+			limits: jsonpatch.Limits{MaxOperations: 2, MaxPointerDepth: 2, MaxDocumentNodes: 9, MaxCopyNodes: 4, MaxArrayIndex: 3},
+		},
+		{
+			name:   "too many operations",
+			doc:    `{}`,
+			patch:  `[{"op":"add","path":"/a","value":1},{"op":"add","path":"/b","value":2}]`,
+			limits: jsonpatch.Limits{MaxOperations: 1},
+			limit:  "MaxOperations",
+		},
+		{
+			name:   "too many expanded operations",
+			doc:    `{"a":[{},{},{}]}`,
+			patch:  `[{"op":"add","path":"/a/*/x","value":1}]`,
+			limits: jsonpatch.Limits{MaxOperations: 2},
+			limit:  "MaxOperations",
+		},
+		{
+			name:   "too many descendants",
+			doc:    `{"a":[{"b":1},{"b":2}]}`,
+			patch:  `[{"op":"replace","path":"$..*","value":0}]`,
+			limits: jsonpatch.Limits{MaxOperations: 3},
+			limit:  "MaxOperations",
+		},
+		{
+			name:   "pointer too deep",
+			doc:    `{}`,
+			patch:  `[{"op":"add","path":"/a/b/c/d","value":1}]`,
+			limits: jsonpatch.Limits{MaxPointerDepth: 3},
+			limit:  "MaxPointerDepth",
+		},
+		{
+			name:   "from pointer too deep",
+			doc:    `{"a":{"b":{"c":1}}}`,
+			patch:  `[{"op":"move","from":"/a/b/c","path":"/d"}]`,
+			limits: jsonpatch.Limits{MaxPointerDepth: 2},
+			limit:  "MaxPointerDepth",
+		},
+		{
+			name:   "value too large",
+			doc:    `{}`,
+			patch:  `[{"op":"add","path":"/a","value":[1,2,3,4,5]}]`,
+			limits: jsonpatch.Limits{MaxDocumentNodes: 5},
+			limit:  "MaxDocumentNodes",
+		},
+		{
+			name:   "replace frees its old value",
+			doc:    `{"a":[1,2,3,4]}`,
+			patch:  `[{"op":"replace","path":"/a","value":[5,6,7,8]}]`,
+			limits: jsonpatch.Limits{MaxDocumentNodes: 6},
+		},
+		{
+			name:   "copy loop",
+			doc:    `{"a":[1]}`,
+			patch:  `[{"op":"copy","from":"/a","path":"/a/-"},{"op":"copy","from":"/a","path":"/a/-"},{"op":"copy","from":"/a","path":"/a/-"},{"op":"copy","from":"/a","path":"/a/-"}]`,
+			limits: jsonpatch.Limits{MaxDocumentNodes: 20},
+			limit:  "MaxDocumentNodes",
+		},
+		{
+			name:   "copied subtree too large",
+			doc:    `{"a":{"b":1,"c":2}}`,
+			patch:  `[{"op":"copy","from":"/a","path":"/d"}]`,
+			limits: jsonpatch.Limits{MaxCopyNodes: 2},
+			limit:  "MaxCopyNodes",
+		},
+		{
+			name:   "array index too large",
+			doc:    `{"a":[1,2,3]}`,
+			patch:  `[{"op":"remove","path":"/a/2"}]`,
+			limits: jsonpatch.Limits{MaxArrayIndex: 1},
+			limit:  "MaxArrayIndex",
+		},
+		{
+			name:   "numeric object keys are not array indices",
+			doc:    `{"a":{"99":1}}`,
+			patch:  `[{"op":"remove","path":"/a/99"}]`,
+			limits: jsonpatch.Limits{MaxArrayIndex: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc any
+			json.Unmarshal([]byte(tc.doc), &doc)
+			var patch jsonpatch.Patch
+			json.Unmarshal([]byte(tc.patch), &patch)
+			opts := []jsonpatch.Option{jsonpatch.WithLimits(tc.limits), jsonpatch.WithPathExpansion()}
+
+			_, applyErr := jsonpatch.Apply(doc, patch, opts...)
+			_, prepareErr := jsonpatch.Prepare(doc, patch, opts...)
+			for _, err := range []error{applyErr, prepareErr} {
+				if tc.limit == "" {
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					continue
+				}
+				var limitErr *jsonpatch.LimitError
+				if !errors.As(err, &limitErr) {
+					t.Fatalf("expected *LimitError, got %v", err)
+				}
+				if limitErr.Limit != tc.limit {
+					t.Errorf("expected %s, got %s", tc.limit, limitErr.Limit)
+				}
+				if !errors.Is(err, jsonpatch.ErrLimitExceeded) {
+					t.Error("expected errors.Is(err, ErrLimitExceeded)")
+				}
+				if !strings.Contains(err.Error(), tc.limit) {
+					t.Errorf("error %q does not name the limit", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package jsonpatch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// LineError reports a line of a JSON Lines stream that could not be patched.
+type LineError struct {
+	// Line is the 1-based line number.
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("jsonpatch: line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// LineErrors lists the failed lines of a JSON Lines stream in line order.
+type LineErrors []*LineError
+
+func (e LineErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("jsonpatch: %d lines failed, first at line %d: %v", len(e), e[0].Line, e[0].Err)
+}
+
+// Unwrap returns the errors of the individual lines.
+func (e LineErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, le := range e {
+		errs[i] = le
+	}
+	return errs
+}
+
+// ApplyStreamLines applies patch to each document of a JSON Lines (NDJSON)
+// stream read from reader and writes the results to writer, one per line.
+// Only one line is held in memory at a time.
+//
+// A line that cannot be decoded or patched is written unchanged and
+// processing continues; such failures are returned together as LineErrors
+// once the stream is done. Blank lines are copied as is. Other errors, such
+// as a failing reader or writer or an invalid patch, stop the stream.
+func ApplyStreamLines(reader io.Reader, writer io.Writer, patch Patch, opts ...Option) error {
+	o := newOptions(opts)
+	applyLine, err := lineApplier(patch, o)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(writer)
+	enc := json.NewEncoder(bw)
+	var failed LineErrors
+	err = eachLine(reader, func(n int, line []byte) error {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return writeLine(bw, line)
+		}
+		doc, err := decodeLine(line, o.ordered)
+		if err == nil {
+			doc, err = applyLine(doc)
+		}
+		if err != nil {
+			failed = append(failed, &LineError{Line: n, Err: err})
+			return writeLine(bw, line)
+		}
+		return enc.Encode(doc)
+	})
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// lineApplier returns a function that patches freshly decoded documents in
+// place. Unless options require the general engine, the patch is compiled so
+// its pointers are parsed once for the whole stream.
+func lineApplier(patch Patch, o *options) (func(any) (any, error), error) {
+	if o.expand || o.relative || o.limits != nil || len(o.observers) > 0 || o.anchor != nil {
+		return func(doc any) (any, error) {
+			return applyInPlace(doc, clonePatch(patch), o)
+		}, nil
+	}
+	compiled, err := Compile(patch)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.ApplyInPlace, nil
+}
+
+// KeyedLines describes a JSON Lines stream for ApplyStreamKeyed, in which
+// documents are interleaved with patch records such as
+//
+//	{"id": "user-7", "patch": [{"op": "replace", "path": "/name", "value": "Ann"}]}
+//
+// A line is a patch record if it is an object with a PatchField member;
+// every other line is a document. Patch records must precede their document:
+// a record only applies to the next document with its ID.
+type KeyedLines struct {
+	// IDField is the member holding the ID of documents and patch records.
+	// It defaults to "id".
+	IDField string
+	// PatchField is the member holding the patch of a patch record. It
+	// defaults to "patch".
+	PatchField string
+	// MaxPending limits the patch records held until their document. Records
+	// beyond it are reported as failed instead of being held. Zero means no
+	// limit.
+	MaxPending int
+}
+
+type pendingPatch struct {
+	line  int
+	patch Patch
+}
+
+// ApplyStreamKeyed reads a JSON Lines stream of documents and patch records
+// laid out as described by keys. Patch records are not written; they are held
+// until the next document with the same ID, which is written with all of
+// them applied in order. Other documents are written unchanged.
+//
+// Failures are reported per line as with ApplyStreamLines. If one of a
+// document's patches fails, the document is written unchanged, the error is
+// reported at the line of the failing patch record and the document's later
+// patch records are reported as not applied. Patch records for which no
+// document follows are reported at the end of the stream. Memory use grows
+// with the longest line and the patch records not yet matched, which
+// keys.MaxPending can bound.
+func ApplyStreamKeyed(reader io.Reader, writer io.Writer, keys KeyedLines, opts ...Option) error {
+	if keys.IDField == "" {
+		keys.IDField = "id"
+	}
+	if keys.PatchField == "" {
+		keys.PatchField = "patch"
+	}
+	o := newOptions(opts)
+	bw := bufio.NewWriter(writer)
+	enc := json.NewEncoder(bw)
+	pending := make(map[string][]pendingPatch)
+	held := 0
+	var failed LineErrors
+	err := eachLine(reader, func(n int, line []byte) error {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return writeLine(bw, line)
+		}
+		doc, err := decodeLine(line, o.ordered)
+		if err != nil {
+			failed = append(failed, &LineError{Line: n, Err: err})
+			return writeLine(bw, line)
+		}
+		id, hasID := member(doc, keys.IDField)
+		if raw, ok := member(doc, keys.PatchField); ok {
+			if keys.MaxPending > 0 && held >= keys.MaxPending {
+				failed = append(failed, &LineError{Line: n, Err: fmt.Errorf("more than %d patch records are waiting for their document", keys.MaxPending)})
+				return nil
+			}
+			if err := queuePatch(pending, n, id, hasID, raw); err != nil {
+				failed = append(failed, &LineError{Line: n, Err: err})
+				return nil
+			}
+			held++
+			return nil
+		}
+		if !hasID {
+			return writeLine(bw, line)
+		}
+		key, err := json.Marshal(id)
+		if err != nil {
+			failed = append(failed, &LineError{Line: n, Err: err})
+			return writeLine(bw, line)
+		}
+		queued := pending[string(key)]
+		if len(queued) == 0 {
+			return writeLine(bw, line)
+		}
+		delete(pending, string(key))
+		held -= len(queued)
+		for i, p := range queued {
+			if doc, err = applyInPlace(doc, p.patch, o); err != nil {
+				failed = append(failed, &LineError{Line: p.line, Err: err})
+				for _, skipped := range queued[i+1:] {
+					failed = append(failed, &LineError{Line: skipped.line, Err: fmt.Errorf("not applied: the patch at line %d failed", p.line)})
+				}
+				return writeLine(bw, line)
+			}
+		}
+		return enc.Encode(doc)
+	})
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	for key, queued := range pending {
+		for _, p := range queued {
+			failed = append(failed, &LineError{Line: p.line, Err: fmt.Errorf("no document with %s %s follows the patch", keys.IDField, key)})
+		}
+	}
+	if len(failed) > 0 {
+		sort.SliceStable(failed, func(i, j int) bool { return failed[i].Line < failed[j].Line })
+		return failed
+	}
+	return nil
+}
+
+// queuePatch decodes the patch of a patch record and queues it for its ID.
+func queuePatch(pending map[string][]pendingPatch, line int, id any, hasID bool, raw any) error {
+	if !hasID {
+		return errors.New("patch record has no ID")
+	}
+	key, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	var patch Patch
+	if err := json.Unmarshal(b, &patch); err != nil {
+		return fmt.Errorf("invalid patch: %w", err)
+	}
+	pending[string(key)] = append(pending[string(key)], pendingPatch{line: line, patch: patch})
+	return nil
+}
+
+// member returns the member name of doc if doc is an object.
+func member(doc any, name string) (any, bool) {
+	switch v := doc.(type) {
+	case map[string]any:
+		m, ok := v[name]
+		return m, ok
+	case *OrderedObject:
+		return v.Get(name)
+	}
+	return nil, false
+}
+
+// eachLine calls fn with the number and content of each line of r, without
+// the line terminator, until fn or r fails.
+func eachLine(r io.Reader, fn func(n int, line []byte) error) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+			if ferr := fn(n, line); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read line %d: %w", n, err)
+		}
+	}
+}
+
+// decodeLine decodes the single JSON value on line.
+func decodeLine(line []byte, ordered bool) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	var doc any
+	var err error
+	if ordered {
+		doc, err = decodeOrdered(dec)
+	} else {
+		err = dec.Decode(&doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("failed to decode document: more than one value on the line")
+	}
+	return doc, nil
+}
+
+func writeLine(w *bufio.Writer, line []byte) error {
+	if _, err := w.Write(line); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
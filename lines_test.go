@@ -0,0 +1,106 @@
+package jsonpatch_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestApplyStreamLines(t *testing.T) {
+	in := `{"level":"info","msg":"a"}
+{"msg":"no level"}
+
+not json
+{"level":"warn","msg":"b"}`
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/level", Value: "INFO"},
+		{Op: jsonpatch.Add, Path: "/seen", Value: true},
+	}
+	var out bytes.Buffer
+	err := jsonpatch.ApplyStreamLines(strings.NewReader(in), &out, patch)
+	want := `{"level":"INFO","msg":"a","seen":true}
+{"msg":"no level"}
+
+not json
+{"level":"INFO","msg":"b","seen":true}
+`
+	if out.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", out.String(), want)
+	}
+	var lerrs jsonpatch.LineErrors
+	if !errors.As(err, &lerrs) || len(lerrs) != 2 || lerrs[0].Line != 2 || lerrs[1].Line != 4 {
+		t.Fatalf("error = %v, want failures on lines 2 and 4", err)
+	}
+	var perr *jsonpatch.Error
+	if !errors.As(lerrs[0], &perr) || perr.Index != 0 {
+		t.Fatalf("line 2 error = %v, want *Error at index 0", lerrs[0])
+	}
+}
+
+func TestApplyStreamLinesOrdered(t *testing.T) {
+	var out bytes.Buffer
+	err := jsonpatch.ApplyStreamLines(strings.NewReader("{\"b\":1,\"a\":2}\r\n{\"z\":0}\n"), &out,
+		jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/c", Value: 3.0}}, jsonpatch.WithOrderedObjects())
+	if err != nil {
+		t.Fatalf("ApplyStreamLines: %v", err)
+	}
+	if got, want := out.String(), "{\"b\":1,\"a\":2,\"c\":3}\n{\"z\":0,\"c\":3}\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestApplyStreamKeyed(t *testing.T) {
+	in := `{"id":1,"patch":[{"op":"replace","path":"/name","value":"Ann"}]}
+{"id":2,"name":"Bob"}
+{"id":1,"patch":[{"op":"add","path":"/age","value":30}]}
+{"id":1,"name":"ann"}
+{"id":3,"patch":[{"op":"remove","path":"/missing"}]}
+{"id":3,"patch":[{"op":"add","path":"/x","value":1}]}
+{"id":3,"name":"Cy"}
+{"id":9,"patch":[]}`
+	var out bytes.Buffer
+	err := jsonpatch.ApplyStreamKeyed(strings.NewReader(in), &out, jsonpatch.KeyedLines{})
+	want := `{"id":2,"name":"Bob"}
+{"age":30,"id":1,"name":"Ann"}
+{"id":3,"name":"Cy"}
+`
+	if out.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", out.String(), want)
+	}
+	var lerrs jsonpatch.LineErrors
+	if !errors.As(err, &lerrs) || len(lerrs) != 3 || lerrs[0].Line != 5 || lerrs[1].Line != 6 || lerrs[2].Line != 8 {
+		t.Fatalf("error = %v, want failures on lines 5, 6 and 8", err)
+	}
+}
+
+func TestApplyStreamKeyedMaxPending(t *testing.T) {
+	in := `{"id":1,"patch":[{"op":"add","path":"/a","value":1}]}
+{"id":2,"patch":[{"op":"add","path":"/a","value":2}]}
+{"id":1}
+{"id":2,"patch":[{"op":"add","path":"/a","value":2}]}
+{"id":2}`
+	var out bytes.Buffer
+	err := jsonpatch.ApplyStreamKeyed(strings.NewReader(in), &out, jsonpatch.KeyedLines{MaxPending: 1})
+	want := `{"a":1,"id":1}
+{"a":2,"id":2}
+`
+	if out.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", out.String(), want)
+	}
+	var lerrs jsonpatch.LineErrors
+	if !errors.As(err, &lerrs) || len(lerrs) != 1 || lerrs[0].Line != 2 {
+		t.Fatalf("error = %v, want a failure on line 2", err)
+	}
+}
+
+func TestApplyStreamLinesInvalidPatch(t *testing.T) {
+	var out bytes.Buffer
+	err := jsonpatch.ApplyStreamLines(strings.NewReader("{}\n"), &out, jsonpatch.Patch{{Op: "bogus", Path: "/a"}})
+	var lerrs jsonpatch.LineErrors
+	if err == nil || errors.As(err, &lerrs) || out.Len() != 0 {
+		t.Fatalf("error = %v, output %q; want an error before any line", err, out.String())
+	}
+}
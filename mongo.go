@@ -0,0 +1,572 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// UnsupportedOperation is an operation that cannot be translated to a
+// database update.
+type UnsupportedOperation struct {
+	Index  int
+	Op     Operation
+	Reason string
+}
+
+func (u UnsupportedOperation) String() string {
+	return fmt.Sprintf("operation %d (%s '%s'): %s", u.Index, u.Op.Op, u.Op.Path, u.Reason)
+}
+
+// TranslationError is returned when a patch contains operations a database
+// update cannot express. The patch has to be applied by reading, patching
+// and writing the document instead.
+type TranslationError struct {
+	// Target names the database, e.g. "MongoDB".
+	Target string
+	Ops    []UnsupportedOperation
+}
+
+func (e *TranslationError) Error() string {
+	parts := make([]string, len(e.Ops))
+	for i, u := range e.Ops {
+		parts[i] = u.String()
+	}
+	return fmt.Sprintf("jsonpatch: cannot translate to %s: %s", e.Target, strings.Join(parts, "; "))
+}
+
+// MongoUpdate is a patch translated to MongoDB update operators.
+type MongoUpdate struct {
+	// Filter holds the conditions the document must meet: the test
+	// operations, the existence of the values replaced, removed and moved,
+	// and the existence of the parents of added values. It is nil when there
+	// are none; combine it with the filter selecting the document.
+	Filter map[string]any
+	// Updates are update documents using $set, $unset, $push (with $each and
+	// $position), $pull and $rename. Operations on overlapping paths cannot
+	// share an update document, so there can be several; run them in order,
+	// in a transaction if they must be atomic, applying Filter to the first.
+	Updates []map[string]any
+	// ArrayFilters holds the arrayFilters option of each update document,
+	// indexed like Updates, with the conditions of the filtered positional
+	// operators "$[fN]" used by the update; an entry is nil if there are
+	// none. ArrayFilters is nil when no update needs it.
+	ArrayFilters [][]any
+}
+
+// mongoRemoved marks an array element removed by index until it is pulled.
+const mongoRemoved = "\x00jsonpatch:removed"
+
+// ToMongoUpdate translates patch to MongoDB update documents, so it can be
+// applied by the database without reading the document.
+//
+// Reference tokens become the segments of dotted field paths, and "*"
+// becomes the all-positional operator "$[]". As MongoDB field paths do not
+// tell arrays from objects, numeric tokens are taken to be array indices:
+// adding at an index becomes a $push at $position, and removing an index
+// becomes a $set of a marker followed by a $pull of it. Test operations of
+// scalar values become conditions of the Filter that, unlike $eq alone, do
+// not match arrays containing the value.
+//
+// Replace and remove operations may also address values with JSONPath
+// expressions, as with WithPathExpansion, made of name, index and wildcard
+// selectors and filter selectors that compare members of the element with
+// literals, joined by &&, or test for their existence. A filter selector
+// becomes a filtered positional operator "$[fN]" with its condition in
+// ArrayFilters, or a $pull condition if it selects the elements to remove.
+// As in all MongoDB queries, a condition on a member holding an array
+// matches if any of its elements does.
+//
+// Values written earlier in the patch are not guarded by the Filter, and
+// as $set creates missing parents, operations on values removed earlier in
+// the patch, other than adding them again, would not fail as they must.
+//
+// Copy operations, moves of array elements, adding at or removing a "*"
+// wildcard, replacing the root, tests of objects and arrays and of values
+// changed earlier in the patch, operations on values removed earlier, other
+// JSONPath expressions and tokens that are not valid field names (empty,
+// containing "." or starting with "$") cannot be expressed; they are
+// reported together in a *TranslationError.
+func ToMongoUpdate(patch Patch) (*MongoUpdate, error) {
+	b := mongoBuilder{}
+	var unsupported []UnsupportedOperation
+	for i, op := range patch {
+		if reason := b.operation(op); reason != "" {
+			unsupported = append(unsupported, UnsupportedOperation{Index: i, Op: op, Reason: reason})
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, &TranslationError{Target: "MongoDB", Ops: unsupported}
+	}
+	u := &MongoUpdate{Updates: b.stages}
+	for _, f := range b.filters {
+		if f != nil {
+			u.ArrayFilters = b.filters
+			break
+		}
+	}
+	switch len(b.conditions) {
+	case 0:
+	case 1:
+		u.Filter = b.conditions[0]
+	default:
+		conds := make([]any, len(b.conditions))
+		for i, c := range b.conditions {
+			conds[i] = c
+		}
+		u.Filter = map[string]any{"$and": conds}
+	}
+	return u, nil
+}
+
+type mongoBuilder struct {
+	conditions []map[string]any
+	stages     []map[string]any
+	filters    [][]any  // array filters of each stage
+	fields     []string // fields written by the last stage
+	touched    []string // fields written by the patch so far
+	removed    []string // fields removed by the patch and not added since
+	ids        int      // array filter identifiers used so far
+}
+
+// operation translates op, returning why it cannot be expressed, if so.
+func (b *mongoBuilder) operation(op Operation) string {
+	if strings.HasPrefix(op.Path, "$") {
+		return b.jsonPathOperation(op)
+	}
+	path, err := jsonpointer.New(op.Path)
+	if err != nil {
+		return err.Error()
+	}
+	if len(path) == 0 {
+		return "MongoDB updates cannot replace the document root"
+	}
+	field, reason := mongoField(path)
+	if reason != "" {
+		return reason
+	}
+	parent, last := mongoParent(field), path[len(path)-1]
+	// Top-level tokens are member names, as the root is always a document.
+	inArray := len(path) > 1 && (last == "-" || isArrayIndex(last))
+
+	if last == "*" && (op.Op == Add || op.Op == Remove) {
+		return "adding at or removing a wildcard cannot be expressed"
+	}
+
+	switch op.Op {
+	case Add:
+		if b.removedBefore(field, true) {
+			return mongoRemovedReason
+		}
+		if len(path) > 1 {
+			b.guard(parent)
+		}
+		if inArray && last != "-" && last != "0" {
+			// Inserting at an index requires the element before it.
+			pos, _ := strconv.Atoi(last)
+			b.guard(parent + "." + strconv.Itoa(pos-1))
+		}
+		switch {
+		case inArray && last == "-":
+			b.write("$push", parent, map[string]any{"$each": []any{op.Value}})
+		case inArray:
+			pos, _ := strconv.Atoi(last)
+			b.write("$push", parent, map[string]any{"$each": []any{op.Value}, "$position": pos})
+		default:
+			b.write("$set", field, op.Value)
+			b.added(field)
+		}
+	case Replace:
+		if b.removedBefore(field, false) {
+			return mongoRemovedReason
+		}
+		b.guard(field)
+		b.write("$set", field, op.Value)
+	case Remove:
+		if b.removedBefore(field, false) {
+			return mongoRemovedReason
+		}
+		b.guard(field)
+		if inArray {
+			b.write("$set", field, mongoRemoved)
+			b.write("$pull", parent, mongoRemoved)
+		} else {
+			b.write("$unset", field, "")
+			b.removed = append(b.removed, field)
+		}
+	case Move:
+		from, err := jsonpointer.New(op.From)
+		if err != nil {
+			return err.Error()
+		}
+		fromField, reason := mongoField(from)
+		if reason != "" {
+			return reason
+		}
+		if len(from) == 0 {
+			return "MongoDB updates cannot move the document root"
+		}
+		if mongoThroughArray(from) || mongoThroughArray(path) {
+			return "$rename cannot move array elements"
+		}
+		if b.removedBefore(fromField, false) || b.removedBefore(field, true) {
+			return mongoRemovedReason
+		}
+		b.guard(fromField)
+		if len(path) > 1 {
+			// $rename creates missing parents of the destination.
+			b.guard(parent)
+		}
+		b.write("$rename", fromField, field)
+		b.added(field)
+		b.removed = append(b.removed, fromField)
+	case Copy:
+		return "MongoDB update operators cannot copy values"
+	case Test:
+		if strings.Contains(field, "$[]") {
+			return "wildcard tests cannot be expressed as a filter"
+		}
+		for _, t := range b.touched {
+			if mongoOverlap(t, field) {
+				return "the tested value is changed by an earlier operation"
+			}
+		}
+		cond, reason := mongoEquals(op.Value)
+		if reason != "" {
+			return reason
+		}
+		b.conditions = append(b.conditions, map[string]any{field: cond})
+	default:
+		return fmt.Sprintf("unknown operation %q", op.Op)
+	}
+	return ""
+}
+
+const mongoRemovedReason = "the value was removed by an earlier operation"
+
+// removedBefore reports whether field is at or below a field removed earlier
+// in the patch. Adding a removed field again is allowed.
+func (b *mongoBuilder) removedBefore(field string, add bool) bool {
+	for _, r := range b.removed {
+		if add && field == r {
+			continue
+		}
+		if strings.Count(field, ".") >= strings.Count(r, ".") && mongoOverlap(field, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// added records that the value at field exists again.
+func (b *mongoBuilder) added(field string) {
+	b.removed = slices.DeleteFunc(b.removed, func(r string) bool { return r == field })
+}
+
+// guard requires the value at field to exist, unless the patch wrote it.
+func (b *mongoBuilder) guard(field string) {
+	if strings.Contains(field, "$[") {
+		return
+	}
+	for _, t := range b.touched {
+		if mongoOverlap(t, field) {
+			return
+		}
+	}
+	b.conditions = append(b.conditions, map[string]any{field: map[string]any{"$exists": true}})
+}
+
+// write adds field to the update operator op, starting a new update document
+// if the last one already writes an overlapping field.
+func (b *mongoBuilder) write(op, field string, value any) {
+	written := []string{field}
+	if op == "$rename" {
+		written = append(written, value.(string))
+	}
+	conflict := len(b.stages) == 0
+	for _, f := range b.fields {
+		for _, w := range written {
+			conflict = conflict || mongoOverlap(f, w)
+		}
+	}
+	if conflict {
+		b.stages = append(b.stages, map[string]any{})
+		b.filters = append(b.filters, nil)
+		b.fields = nil
+	}
+	stage := b.stages[len(b.stages)-1]
+	fields, _ := stage[op].(map[string]any)
+	if fields == nil {
+		fields = make(map[string]any)
+		stage[op] = fields
+	}
+	fields[field] = value
+	b.fields = append(b.fields, written...)
+	b.touched = append(b.touched, written...)
+}
+
+// mongoField returns the dotted field path of tokens, or why there is none.
+func mongoField(tokens []string) (string, string) {
+	parts := make([]string, len(tokens))
+	for i, tok := range tokens {
+		switch {
+		case tok == "*":
+			parts[i] = "$[]"
+		case tok == "" || strings.Contains(tok, ".") || strings.HasPrefix(tok, "$"):
+			return "", fmt.Sprintf("reference token '%s' is not a MongoDB field name", tok)
+		default:
+			parts[i] = tok
+		}
+	}
+	return strings.Join(parts, "."), ""
+}
+
+func mongoParent(field string) string {
+	if i := strings.LastIndexByte(field, '.'); i >= 0 {
+		return field[:i]
+	}
+	return ""
+}
+
+// mongoThroughArray reports whether tokens below the root may address an
+// array element.
+func mongoThroughArray(tokens []string) bool {
+	for _, tok := range tokens[1:] {
+		if tok == "*" || tok == "-" || isArrayIndex(tok) {
+			return true
+		}
+	}
+	return false
+}
+
+// mongoOverlap reports whether one field path is a prefix of the other,
+// taking positional operators to match any array index.
+func mongoOverlap(a, b string) bool {
+	if a == "" || b == "" {
+		return true
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range min(len(as), len(bs)) {
+		if as[i] != bs[i] && !strings.HasPrefix(as[i], "$[") && !strings.HasPrefix(bs[i], "$[") {
+			return false
+		}
+	}
+	return true
+}
+
+// mongoEquals returns the condition matching a field equal to the scalar
+// value. $eq alone also matches arrays containing the value, and null
+// matches missing fields.
+func mongoEquals(value any) (map[string]any, string) {
+	switch value.(type) {
+	case map[string]any, []any, *OrderedObject:
+		return nil, "tests of objects and arrays cannot be expressed as a filter"
+	}
+	cond := map[string]any{"$eq": value, "$not": map[string]any{"$type": "array"}}
+	if value == nil {
+		cond["$exists"] = true
+	}
+	return cond, ""
+}
+
+// jsonPathOperation translates a replace or remove operation whose path is
+// a JSONPath expression.
+func (b *mongoBuilder) jsonPathOperation(op Operation) string {
+	q, err := parseJSONPath(op.Path)
+	if err != nil {
+		return err.Error()
+	}
+	if op.Op != Replace && op.Op != Remove {
+		return "only replace and remove operations can address JSONPath locations"
+	}
+	var parts []string
+	var filters []any
+	for i, seg := range q.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return "JSONPath descendant segments and selector lists cannot be expressed"
+		}
+		sel := seg.selectors[0]
+		last := i == len(q.segments)-1
+		switch sel.kind {
+		case jpName:
+			if _, reason := mongoField([]string{sel.name}); reason != "" {
+				return reason
+			}
+			parts = append(parts, sel.name)
+		case jpIndex:
+			if sel.index < 0 {
+				return "negative JSONPath indices cannot be expressed"
+			}
+			parts = append(parts, strconv.Itoa(sel.index))
+		case jpWildcard:
+			if i == 0 {
+				return "the document root is not an array"
+			}
+			parts = append(parts, "$[]")
+		case jpFilter:
+			if i == 0 {
+				return "the document root is not an array"
+			}
+			if last && op.Op == Remove {
+				cond, reason := mongoFilter("", sel.filter)
+				if reason != "" {
+					return reason
+				}
+				if b.removedBefore(strings.Join(parts, "."), false) {
+					return mongoRemovedReason
+				}
+				b.write("$pull", strings.Join(parts, "."), cond)
+				b.addFilters(filters)
+				return ""
+			}
+			id := "f" + strconv.Itoa(b.ids)
+			b.ids++
+			cond, reason := mongoFilter(id, sel.filter)
+			if reason != "" {
+				return reason
+			}
+			parts = append(parts, "$["+id+"]")
+			filters = append(filters, cond)
+		default:
+			return "JSONPath slices cannot be expressed"
+		}
+	}
+	if len(parts) == 0 {
+		return "MongoDB updates cannot replace the document root"
+	}
+	field := strings.Join(parts, ".")
+	if b.removedBefore(field, false) {
+		return mongoRemovedReason
+	}
+	if op.Op == Replace {
+		b.write("$set", field, op.Value)
+	} else if k := q.segments[len(q.segments)-1].selectors[0].kind; k != jpName {
+		return "removing array elements by JSONPath index or wildcard cannot be expressed"
+	} else {
+		b.write("$unset", field, "")
+		b.removed = append(b.removed, field)
+	}
+	b.addFilters(filters)
+	return ""
+}
+
+// addFilters adds array filters to the last stage.
+func (b *mongoBuilder) addFilters(filters []any) {
+	last := len(b.filters) - 1
+	b.filters[last] = append(b.filters[last], filters...)
+}
+
+// mongoOperators maps JSONPath comparison operators to query operators.
+var mongoOperators = map[string]string{"==": "$eq", "!=": "$ne", "<": "$lt", "<=": "$lte", ">": "$gt", ">=": "$gte"}
+
+// mongoFilter returns the query condition of a JSONPath filter expression,
+// on fields below id, or on the element itself if id is empty.
+func mongoFilter(id string, expr jpExpr) (map[string]any, string) {
+	const unsupported = "only filters comparing members with literals, joined by &&, or testing for members can be expressed"
+	cond := make(map[string]any)
+	var add func(e jpExpr) string
+	add = func(e jpExpr) string {
+		var q *jpQuery
+		var operator string
+		var operand any
+		switch x := e.(type) {
+		case jpAnd:
+			for _, y := range x {
+				if reason := add(y); reason != "" {
+					return reason
+				}
+			}
+			return ""
+		case jpExists:
+			q, operator, operand = x.query, "$exists", true
+		case jpCompare:
+			op := x.op
+			left, right := x.left, x.right
+			if _, ok := left.(jpLiteral); ok {
+				left, right = right, left
+				op = map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}[op]
+				if op == "" {
+					op = x.op
+				}
+			}
+			lq, lok := left.(*jpQuery)
+			lit, rok := right.(jpLiteral)
+			if !lok || !rok {
+				return unsupported
+			}
+			switch lit.v.(type) {
+			case map[string]any, []any:
+				return unsupported
+			}
+			q, operator, operand = lq, mongoOperators[op], lit.v
+		default:
+			return unsupported
+		}
+		if !q.relative {
+			return unsupported
+		}
+		names := []string{}
+		if id != "" {
+			names = append(names, id)
+		}
+		for _, seg := range q.path.segments {
+			if seg.descendant || len(seg.selectors) != 1 || seg.selectors[0].kind != jpName {
+				return unsupported
+			}
+			name := seg.selectors[0].name
+			if _, reason := mongoField([]string{name}); reason != "" {
+				return reason
+			}
+			names = append(names, name)
+		}
+		target := cond
+		if len(names) > 0 {
+			key := strings.Join(names, ".")
+			target, _ = cond[key].(map[string]any)
+			if target == nil {
+				target = make(map[string]any)
+				cond[key] = target
+			}
+		}
+		if _, dup := target[operator]; dup {
+			return "repeated comparisons of a member cannot be expressed"
+		}
+		target[operator] = operand
+		if operator == "$eq" && operand == nil {
+			target["$exists"] = true
+		}
+		return ""
+	}
+	if reason := add(expr); reason != "" {
+		return nil, reason
+	}
+	// Conditions on the element itself and on its members cannot be mixed.
+	var self, members bool
+	for k := range cond {
+		if strings.HasPrefix(k, "$") {
+			self = true
+		} else {
+			members = true
+		}
+	}
+	if self && members {
+		return nil, unsupported
+	}
+	return cond, ""
+}
+
+// isArrayIndex reports whether tok is an RFC 6901 array index.
+func isArrayIndex(tok string) bool {
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return false
+	}
+	for _, c := range tok {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
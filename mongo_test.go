@@ -0,0 +1,150 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestToMongoUpdate(t *testing.T) {
+	tests := []struct {
+		name         string
+		patch        string
+		filter       string
+		updates      string
+		arrayFilters string
+	}{
+		{
+			name:    "set and unset",
+			patch:   `[{"op":"add","path":"/a/b","value":1},{"op":"replace","path":"/c","value":"x"},{"op":"remove","path":"/d"}]`,
+			filter:  `{"$and":[{"a":{"$exists":true}},{"c":{"$exists":true}},{"d":{"$exists":true}}]}`,
+			updates: `[{"$set":{"a.b":1,"c":"x"},"$unset":{"d":""}}]`,
+		},
+		{
+			name:    "push",
+			patch:   `[{"op":"add","path":"/tags/-","value":"go"},{"op":"add","path":"/items/0","value":{"id":1}},{"op":"add","path":"/items/2","value":{"id":2}}]`,
+			filter:  `{"$and":[{"tags":{"$exists":true}},{"items":{"$exists":true}}]}`,
+			updates: `[{"$push":{"items":{"$each":[{"id":1}],"$position":0},"tags":{"$each":["go"]}}},{"$push":{"items":{"$each":[{"id":2}],"$position":2}}}]`,
+		},
+		{
+			name:    "remove by index",
+			patch:   `[{"op":"remove","path":"/items/2"}]`,
+			filter:  `{"items.2":{"$exists":true}}`,
+			updates: `[{"$set":{"items.2":"\u0000jsonpatch:removed"}},{"$pull":{"items":"\u0000jsonpatch:removed"}}]`,
+		},
+		{
+			name:    "test and rename",
+			patch:   `[{"op":"test","path":"/v","value":3},{"op":"move","from":"/old","path":"/meta/new"},{"op":"replace","path":"/meta/new/x","value":true}]`,
+			filter:  `{"$and":[{"v":{"$eq":3,"$not":{"$type":"array"}}},{"old":{"$exists":true}},{"meta":{"$exists":true}}]}`,
+			updates: `[{"$rename":{"old":"meta.new"}},{"$set":{"meta.new.x":true}}]`,
+		},
+		{
+			name:    "remove and add again",
+			patch:   `[{"op":"remove","path":"/a"},{"op":"add","path":"/a","value":{"b":1}},{"op":"add","path":"/a/c","value":2}]`,
+			filter:  `{"a":{"$exists":true}}`,
+			updates: `[{"$unset":{"a":""}},{"$set":{"a":{"b":1}}},{"$set":{"a.c":2}}]`,
+		},
+		{
+			name:    "wildcard",
+			patch:   `[{"op":"replace","path":"/items/*/done","value":false}]`,
+			filter:  `null`,
+			updates: `[{"$set":{"items.$[].done":false}}]`,
+		},
+		{
+			name:    "add at index",
+			patch:   `[{"op":"add","path":"/items/3","value":"d"}]`,
+			filter:  `{"$and":[{"items":{"$exists":true}},{"items.2":{"$exists":true}}]}`,
+			updates: `[{"$push":{"items":{"$each":["d"],"$position":3}}}]`,
+		},
+		{
+			name:    "test null",
+			patch:   `[{"op":"test","path":"/a","value":null}]`,
+			filter:  `{"a":{"$eq":null,"$exists":true,"$not":{"$type":"array"}}}`,
+			updates: `null`,
+		},
+		{
+			name:         "array filters",
+			patch:        `[{"op":"replace","path":"$.items[?@.id == 2 && @.n > 1].done","value":true},{"op":"remove","path":"$.items[?@.tmp].note"}]`,
+			filter:       `null`,
+			updates:      `[{"$set":{"items.$[f0].done":true},"$unset":{"items.$[f1].note":""}}]`,
+			arrayFilters: `[[{"f0.id":{"$eq":2},"f0.n":{"$gt":1}},{"f1.tmp":{"$exists":true}}]]`,
+		},
+		{
+			name:    "pull by filter",
+			patch:   `[{"op":"remove","path":"$.tags[?@ == 'old']"},{"op":"remove","path":"$.items[?@.done == true]"}]`,
+			filter:  `null`,
+			updates: `[{"$pull":{"items":{"done":{"$eq":true}},"tags":{"$eq":"old"}}}]`,
+		},
+		{
+			name:    "top-level numeric member",
+			patch:   `[{"op":"add","path":"/0","value":1}]`,
+			filter:  `null`,
+			updates: `[{"$set":{"0":1}}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch jsonpatch.Patch
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+			u, err := jsonpatch.ToMongoUpdate(patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, _ := json.Marshal(u.Filter)
+			updates, _ := json.Marshal(u.Updates)
+			arrayFilters, _ := json.Marshal(u.ArrayFilters)
+			if tt.arrayFilters == "" {
+				tt.arrayFilters = "null"
+			}
+			if string(arrayFilters) != tt.arrayFilters {
+				t.Errorf("ArrayFilters = %s, want %s", arrayFilters, tt.arrayFilters)
+			}
+			if string(filter) != tt.filter {
+				t.Errorf("Filter = %s, want %s", filter, tt.filter)
+			}
+			if string(updates) != tt.updates {
+				t.Errorf("Updates = %s, want %s", updates, tt.updates)
+			}
+		})
+	}
+}
+
+func TestToMongoUpdateUnsupported(t *testing.T) {
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Copy, From: "/a", Path: "/b"},
+		{Op: jsonpatch.Replace, Path: "/c", Value: 1.0},
+		{Op: jsonpatch.Test, Path: "/c", Value: 1.0},
+		{Op: jsonpatch.Move, From: "/items/0", Path: "/first"},
+		{Op: jsonpatch.Add, Path: "/a.b", Value: 1.0},
+		{Op: jsonpatch.Replace, Path: "", Value: map[string]any{}},
+		{Op: jsonpatch.Test, Path: "/obj", Value: map[string]any{"a": 1.0}},
+		{Op: jsonpatch.Replace, Path: "$..id", Value: 1.0},
+		{Op: jsonpatch.Replace, Path: "$.items[?@.a == @.b].c", Value: 1.0},
+		{Op: jsonpatch.Remove, Path: "/arr/*"},
+		{Op: jsonpatch.Add, Path: "/arr/*", Value: 1.0},
+		{Op: jsonpatch.Remove, Path: "/gone"},
+		{Op: jsonpatch.Add, Path: "/gone/x", Value: 1.0},
+		{Op: jsonpatch.Replace, Path: "/gone", Value: 1.0},
+		{Op: jsonpatch.Move, From: "/gone", Path: "/moved"},
+	}
+	_, err := jsonpatch.ToMongoUpdate(patch)
+	var te *jsonpatch.TranslationError
+	if !errors.As(err, &te) {
+		t.Fatalf("err = %v, want *TranslationError", err)
+	}
+	var indices []int
+	for _, u := range te.Ops {
+		indices = append(indices, u.Index)
+	}
+	if got, _ := json.Marshal(indices); string(got) != "[0,2,3,4,5,6,7,8,9,10,12,13,14]" {
+		t.Fatalf("unsupported operations %s: %v", got, err)
+	}
+	if !strings.Contains(err.Error(), "MongoDB") {
+		t.Fatalf("error %q does not name the target", err)
+	}
+}
@@ -0,0 +1,386 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// NodeKind classifies a location of a document tree.
+type NodeKind int
+
+const (
+	// ScalarNode is a string, number, boolean or null.
+	ScalarNode NodeKind = iota
+	ObjectNode
+	ArrayNode
+)
+
+// Node adapts a mutable document tree to the patch engine, so patches can be
+// applied to representations other than map[string]any and []any, such as
+// ordered maps or custom node types. A Node is a location in the tree: Set
+// must store the new value in the node's parent.
+//
+// Tokens are unescaped JSON Pointer reference tokens. Values passed to Add and
+// Set are in encoding/json's representation or were returned by Value; adapters
+// convert them as needed. Errors returned by a Node are wrapped in an *Error.
+type Node interface {
+	// Kind reports whether the node is an object, an array or anything else.
+	Kind() NodeKind
+	// Len returns the number of members or elements.
+	Len() int
+	// Keys returns the member names of an object in document order.
+	Keys() []string
+	// Child returns the member or element at token, or an error if there is none.
+	Child(token string) (Node, error)
+	// Add sets an object member, or inserts into an array before the element
+	// at token, where "-" appends.
+	Add(token string, value any) error
+	// Remove deletes an object member or array element.
+	Remove(token string) error
+	// Set replaces the node's own value.
+	Set(value any) error
+	// Value returns the node's value.
+	Value() (any, error)
+}
+
+// ApplyNode applies patch in place to the tree rooted at root. Like
+// ApplyInPlace, the tree may be partially modified when an operation fails.
+func ApplyNode(root Node, patch Patch) error {
+	return applyNodePatch(root, patch)
+}
+
+// applyNodePatch applies patch to the tree rooted at root.
+func applyNodePatch(root Node, patch Patch) error {
+	for i, op := range patch {
+		if err := applyNodeOperation(root, op); err != nil {
+			return &Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return nil
+}
+
+func applyNodeOperation(root Node, op Operation) error {
+	switch op.Op {
+	case Add:
+		return nodeAdd(root, op.Path, op.Value)
+	case Remove:
+		parent, token, err := nodeParent(root, op.Path)
+		if err != nil {
+			return err
+		}
+		return parent.Remove(token)
+	case Replace:
+		target, err := nodeAt(root, op.Path)
+		if err != nil {
+			return err
+		}
+		return target.Set(op.Value)
+	case Move:
+		if op.From == op.Path {
+			return nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return fmt.Errorf("cannot move '%s' into its own child '%s'", op.From, op.Path)
+		}
+		source, err := nodeAt(root, op.From)
+		if err != nil {
+			return err
+		}
+		value, err := source.Value()
+		if err != nil {
+			return err
+		}
+		parent, token, err := nodeParent(root, op.From)
+		if err != nil {
+			return err
+		}
+		if err := parent.Remove(token); err != nil {
+			return err
+		}
+		return nodeAdd(root, op.Path, value)
+	case Copy:
+		source, err := nodeAt(root, op.From)
+		if err != nil {
+			return err
+		}
+		value, err := source.Value()
+		if err != nil {
+			return err
+		}
+		return nodeAdd(root, op.Path, cloneValue(value))
+	case Test:
+		target, err := nodeAt(root, op.Path)
+		if err != nil {
+			return err
+		}
+		actual, err := target.Value()
+		if err != nil {
+			return err
+		}
+		// Member order is not significant, so ordered objects compare as maps.
+		actualBytes, err := json.Marshal(toPlain(actual))
+		if err != nil {
+			return err
+		}
+		expectedBytes, err := json.Marshal(toPlain(op.Value))
+		if err != nil {
+			return err
+		}
+		if string(actualBytes) != string(expectedBytes) {
+			return fmt.Errorf("test failed: expected %v, got %v", op.Value, actual)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported patch operation: %s", op.Op)
+	}
+}
+
+func nodeAdd(root Node, path string, value any) error {
+	if path == "" {
+		return root.Set(value)
+	}
+	parent, token, err := nodeParent(root, path)
+	if err != nil {
+		return err
+	}
+	return parent.Add(token, value)
+}
+
+// nodeAt returns the node path refers to.
+func nodeAt(root Node, path string) (Node, error) {
+	p, err := jsonpointer.New(path)
+	if err != nil {
+		return nil, err
+	}
+	return walkNode(root, p)
+}
+
+// nodeParent returns the parent of the location path refers to and the final
+// reference token. The document root has no parent.
+func nodeParent(root Node, path string) (Node, string, error) {
+	p, err := jsonpointer.New(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(p) == 0 {
+		return nil, "", fmt.Errorf("the document root has no parent")
+	}
+	parent, err := walkNode(root, p[:len(p)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	return parent, p[len(p)-1], nil
+}
+
+func walkNode(n Node, tokens []string) (Node, error) {
+	for i, tok := range tokens {
+		child, err := n.Child(tok)
+		if err != nil {
+			return nil, fmt.Errorf("path '%s' not found: %w", jsonpointer.Pointer(tokens[:i+1]).String(), err)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// DocumentNode is the Node adapter for encoding/json's representation:
+// map[string]any, []any and scalars, as well as *OrderedObject.
+type DocumentNode struct {
+	v   any
+	set func(any) // stores a new value in the parent
+
+	// Set for ordered documents, whose added values are converted to
+	// OrderedObject; path locates the node for the anchor.
+	ordered bool
+	anchor  KeyAnchor
+	path    string
+}
+
+// NewDocumentNode returns the root node of document. Operations that replace
+// the root are reflected by Document.
+func NewDocumentNode(document any) *DocumentNode {
+	return &DocumentNode{v: document, ordered: isOrderedDocument(document)}
+}
+
+// Document returns the node's current value.
+func (n *DocumentNode) Document() any {
+	return n.v
+}
+
+// Kind implements Node.
+func (n *DocumentNode) Kind() NodeKind {
+	switch n.v.(type) {
+	case map[string]any, *OrderedObject:
+		return ObjectNode
+	case []any:
+		return ArrayNode
+	}
+	return ScalarNode
+}
+
+// Len implements Node.
+func (n *DocumentNode) Len() int {
+	switch v := n.v.(type) {
+	case map[string]any:
+		return len(v)
+	case *OrderedObject:
+		return v.Len()
+	case []any:
+		return len(v)
+	}
+	return 0
+}
+
+// Keys implements Node; members of maps are sorted.
+func (n *DocumentNode) Keys() []string {
+	switch v := n.v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	case *OrderedObject:
+		return v.Keys()
+	}
+	return nil
+}
+
+func (n *DocumentNode) child(token string, value any, set func(any)) *DocumentNode {
+	c := &DocumentNode{v: value, set: set, ordered: n.ordered, anchor: n.anchor}
+	if n.anchor != nil {
+		c.path = joinPath(n.path, token)
+	}
+	return c
+}
+
+// Child implements Node.
+func (n *DocumentNode) Child(token string) (Node, error) {
+	switch v := n.v.(type) {
+	case map[string]any:
+		child, ok := v[token]
+		if !ok {
+			return nil, fmt.Errorf("member '%s' does not exist", token)
+		}
+		return n.child(token, child, func(nv any) { v[token] = nv }), nil
+	case *OrderedObject:
+		child, ok := v.Get(token)
+		if !ok {
+			return nil, fmt.Errorf("member '%s' does not exist", token)
+		}
+		return n.child(token, child, func(nv any) { v.Set(token, nv) }), nil
+	case []any:
+		idx, err := arrayIndex(token, len(v))
+		if err != nil {
+			return nil, err
+		}
+		return n.child(token, v[idx], func(nv any) { v[idx] = nv }), nil
+	}
+	return nil, fmt.Errorf("cannot address '%s' in a %s", token, jsonTypeName(n.v))
+}
+
+// Add implements Node.
+func (n *DocumentNode) Add(token string, value any) error {
+	if n.ordered {
+		value = toOrdered(cloneValue(value))
+	}
+	switch v := n.v.(type) {
+	case map[string]any:
+		v[token] = value
+		return nil
+	case *OrderedObject:
+		if n.anchor != nil {
+			if after, ok := n.anchor(n.path, token); ok {
+				v.InsertAfter(after, token, value)
+				return nil
+			}
+		}
+		v.Set(token, value)
+		return nil
+	case []any:
+		idx := len(v)
+		if token != "-" {
+			i, err := jsonpointer.ParseArrayIndex(token)
+			if err != nil {
+				return err
+			}
+			if i > uint64(len(v)) {
+				return fmt.Errorf("add operation on array index %d is out of bounds for array of length %d", i, len(v))
+			}
+			idx = int(i)
+		}
+		arr := make([]any, 0, len(v)+1)
+		arr = append(arr, v[:idx]...)
+		arr = append(arr, value)
+		arr = append(arr, v[idx:]...)
+		n.store(arr)
+		return nil
+	}
+	return fmt.Errorf("cannot add '%s' to a %s", token, jsonTypeName(n.v))
+}
+
+// Remove implements Node.
+func (n *DocumentNode) Remove(token string) error {
+	switch v := n.v.(type) {
+	case map[string]any:
+		if _, ok := v[token]; !ok {
+			return fmt.Errorf("member '%s' does not exist", token)
+		}
+		delete(v, token)
+		return nil
+	case *OrderedObject:
+		if !v.Delete(token) {
+			return fmt.Errorf("member '%s' does not exist", token)
+		}
+		return nil
+	case []any:
+		idx, err := arrayIndex(token, len(v))
+		if err != nil {
+			return err
+		}
+		arr := make([]any, 0, len(v)-1)
+		arr = append(arr, v[:idx]...)
+		arr = append(arr, v[idx+1:]...)
+		n.store(arr)
+		return nil
+	}
+	return fmt.Errorf("cannot remove '%s' from a %s", token, jsonTypeName(n.v))
+}
+
+// Set implements Node.
+func (n *DocumentNode) Set(value any) error {
+	if n.ordered {
+		value = toOrdered(cloneValue(value))
+	}
+	n.store(value)
+	return nil
+}
+
+func (n *DocumentNode) store(value any) {
+	n.v = value
+	if n.set != nil {
+		n.set(value)
+	}
+}
+
+// Value implements Node.
+func (n *DocumentNode) Value() (any, error) {
+	return n.v, nil
+}
+
+// arrayIndex parses token as an index of an existing element of an array of length n.
+func arrayIndex(token string, n int) (int, error) {
+	idx, err := jsonpointer.ParseArrayIndex(token)
+	if err != nil {
+		return 0, err
+	}
+	if idx >= uint64(n) {
+		return 0, fmt.Errorf("array index %d is out of bounds for array of length %d", idx, n)
+	}
+	return int(idx), nil
+}
@@ -0,0 +1,215 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestApplyNodeMatchesApply(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+	}{
+		{`{"a":"b"}`, `[{"op":"add","path":"/c","value":"d"}]`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"},{"op":"add","path":"/foo/-","value":1}]`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`},
+		{`{"foo":["a","b","c","d"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`},
+		{`{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":1},{"op":"replace","path":"","value":[1]}]`},
+	}
+	for _, tt := range tests {
+		var doc, want any
+		var patch jsonpatch.Patch
+		if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		want, err := jsonpatch.Apply(doc, patch)
+		if err != nil {
+			t.Fatalf("Apply(%s, %s): %v", tt.doc, tt.patch, err)
+		}
+		root := jsonpatch.NewDocumentNode(doc)
+		if err := jsonpatch.ApplyNode(root, patch); err != nil {
+			t.Fatalf("ApplyNode(%s, %s): %v", tt.doc, tt.patch, err)
+		}
+		if got := root.Document(); !reflect.DeepEqual(got, want) {
+			t.Errorf("ApplyNode(%s, %s) = %v, want %v", tt.doc, tt.patch, got, want)
+		}
+	}
+}
+
+func TestApplyNodeErrors(t *testing.T) {
+	for _, op := range []jsonpatch.Operation{
+		{Op: jsonpatch.Remove, Path: "/missing"},
+		{Op: jsonpatch.Remove, Path: ""},
+		{Op: jsonpatch.Add, Path: "/arr/5", Value: 1.0},
+		{Op: jsonpatch.Replace, Path: "/arr/-", Value: 1.0},
+		{Op: jsonpatch.Move, From: "/obj", Path: "/obj/x"},
+		{Op: jsonpatch.Test, Path: "/arr", Value: []any{}},
+	} {
+		root := jsonpatch.NewDocumentNode(map[string]any{"arr": []any{1.0}, "obj": map[string]any{}})
+		err := jsonpatch.ApplyNode(root, jsonpatch.Patch{{Op: jsonpatch.Test, Path: "/arr/0", Value: 1.0}, op})
+		var perr *jsonpatch.Error
+		if !errors.As(err, &perr) || perr.Index != 1 {
+			t.Errorf("%s %s: error = %v, want *Error at index 1", op.Op, op.Path, err)
+		}
+	}
+}
+
+// listTree is an order-preserving tree used to exercise a custom Node adapter.
+type listTree struct {
+	kind   jsonpatch.NodeKind
+	keys   []string
+	kids   []*listTree
+	scalar any
+}
+
+func newListTree(v any) *listTree {
+	t := &listTree{}
+	t.assign(v)
+	return t
+}
+
+func (t *listTree) assign(v any) {
+	*t = listTree{}
+	switch tv := v.(type) {
+	case *listTree:
+		*t = *tv
+	case map[string]any:
+		t.kind = jsonpatch.ObjectNode
+		for k, e := range tv {
+			t.keys = append(t.keys, k)
+			t.kids = append(t.kids, newListTree(e))
+		}
+	case []any:
+		t.kind = jsonpatch.ArrayNode
+		for _, e := range tv {
+			t.kids = append(t.kids, newListTree(e))
+		}
+	default:
+		t.scalar = v
+	}
+}
+
+func (t *listTree) String() string {
+	switch t.kind {
+	case jsonpatch.ObjectNode:
+		parts := make([]string, len(t.keys))
+		for i, k := range t.keys {
+			parts[i] = k + ":" + t.kids[i].String()
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case jsonpatch.ArrayNode:
+		parts := make([]string, len(t.kids))
+		for i, k := range t.kids {
+			parts[i] = k.String()
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	}
+	return fmt.Sprint(t.scalar)
+}
+
+func (t *listTree) index(token string, insert bool) (int, error) {
+	if t.kind == jsonpatch.ObjectNode {
+		for i, k := range t.keys {
+			if k == token {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("no member %q", token)
+	}
+	if insert && token == "-" {
+		return len(t.kids), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > len(t.kids) || (!insert && i == len(t.kids)) {
+		return -1, fmt.Errorf("bad index %q", token)
+	}
+	return i, nil
+}
+
+func (t *listTree) Kind() jsonpatch.NodeKind { return t.kind }
+func (t *listTree) Len() int                 { return len(t.kids) }
+func (t *listTree) Keys() []string           { return t.keys }
+
+func (t *listTree) Child(token string) (jsonpatch.Node, error) {
+	i, err := t.index(token, false)
+	if err != nil {
+		return nil, err
+	}
+	return t.kids[i], nil
+}
+
+func (t *listTree) Add(token string, value any) error {
+	child := newListTree(value)
+	if t.kind == jsonpatch.ObjectNode {
+		if i, err := t.index(token, false); err == nil {
+			t.kids[i] = child
+			return nil
+		}
+		t.keys = append(t.keys, token)
+		t.kids = append(t.kids, child)
+		return nil
+	}
+	i, err := t.index(token, true)
+	if err != nil {
+		return err
+	}
+	t.kids = append(t.kids[:i], append([]*listTree{child}, t.kids[i:]...)...)
+	return nil
+}
+
+func (t *listTree) Remove(token string) error {
+	i, err := t.index(token, false)
+	if err != nil {
+		return err
+	}
+	if t.kind == jsonpatch.ObjectNode {
+		t.keys = append(t.keys[:i], t.keys[i+1:]...)
+	}
+	t.kids = append(t.kids[:i], t.kids[i+1:]...)
+	return nil
+}
+
+func (t *listTree) Set(value any) error {
+	t.assign(value)
+	return nil
+}
+
+func (t *listTree) Value() (any, error) {
+	cp := *t
+	cp.keys = append([]string(nil), t.keys...)
+	cp.kids = append([]*listTree(nil), t.kids...)
+	return &cp, nil
+}
+
+func TestApplyNodeCustomAdapter(t *testing.T) {
+	root := &listTree{kind: jsonpatch.ObjectNode}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/z", Value: 1.0},
+		{Op: jsonpatch.Add, Path: "/a", Value: []any{}},
+		{Op: jsonpatch.Add, Path: "/m", Value: true},
+		{Op: jsonpatch.Add, Path: "/a/-", Value: "x"},
+		{Op: jsonpatch.Add, Path: "/a/0", Value: "w"},
+		{Op: jsonpatch.Replace, Path: "/z", Value: 2.0},
+		{Op: jsonpatch.Copy, From: "/a", Path: "/b"},
+		{Op: jsonpatch.Move, From: "/m", Path: "/n"},
+		{Op: jsonpatch.Remove, Path: "/b/1"},
+	}
+	if err := jsonpatch.ApplyNode(root, patch); err != nil {
+		t.Fatalf("ApplyNode: %v", err)
+	}
+	if got, want := root.String(), "{z:2,a:[w,x],b:[w],n:true}"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
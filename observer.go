@@ -0,0 +1,159 @@
+package jsonpatch
+
+import "github.com/agentflare-ai/go-jsonpointer"
+
+// OpEvent describes one concrete operation, after path expansion and relative
+// pointer resolution, as seen by an Observer. Values refer into the document
+// being patched and must not be modified.
+type OpEvent struct {
+	// Index is the position of the originating operation in the patch.
+	Index int
+	// Op is the concrete operation being applied. For errors raised while
+	// expanding its path or resolving its from pointer, it is the operation
+	// as given.
+	Op Operation
+	// Old is the value at Op.Path before the operation; OldExists reports
+	// whether there was one. Adding into an array overwrites nothing.
+	Old       any
+	OldExists bool
+	// New is the value at Op.Path after the operation; it is only set for
+	// OnAfterOp. NewExists is false after a remove.
+	New       any
+	NewExists bool
+}
+
+// Observer is notified around every operation applied by Apply, ApplyInPlace,
+// ApplyStream and Prepare. Returning an error from OnBeforeOp vetoes the
+// operation and aborts the patch with that error.
+type Observer interface {
+	OnBeforeOp(ev OpEvent) error
+	OnAfterOp(ev OpEvent)
+	OnError(ev OpEvent, err error)
+}
+
+// ObserverFuncs adapts plain functions to the Observer interface. Nil fields are skipped.
+type ObserverFuncs struct {
+	BeforeOp func(ev OpEvent) error
+	AfterOp  func(ev OpEvent)
+	Error    func(ev OpEvent, err error)
+}
+
+// OnBeforeOp calls f.BeforeOp if set.
+func (f ObserverFuncs) OnBeforeOp(ev OpEvent) error {
+	if f.BeforeOp == nil {
+		return nil
+	}
+	return f.BeforeOp(ev)
+}
+
+// OnAfterOp calls f.AfterOp if set.
+func (f ObserverFuncs) OnAfterOp(ev OpEvent) {
+	if f.AfterOp != nil {
+		f.AfterOp(ev)
+	}
+}
+
+// OnError calls f.Error if set.
+func (f ObserverFuncs) OnError(ev OpEvent, err error) {
+	if f.Error != nil {
+		f.Error(ev, err)
+	}
+}
+
+// WithObserver registers an observer. It may be given several times; observers
+// are notified in registration order.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// notifyError reports err, raised while op was being concretized, to the
+// observers.
+func notifyError(o *options, index int, op Operation, err error) {
+	ev := OpEvent{Index: index, Op: op}
+	for _, obs := range o.observers {
+		obs.OnError(ev, err)
+	}
+}
+
+// runOperation enforces limits and notifies observers around step, which
+// applies the concrete operation op to document.
+func runOperation(document any, index int, op Operation, o *options, lim *limiter, step func(any, Operation) (any, error)) (any, error) {
+	if len(o.observers) == 0 {
+		if lim != nil {
+			if err := lim.check(document, op); err != nil {
+				return nil, err
+			}
+		}
+		return step(document, op)
+	}
+
+	ev := OpEvent{Index: index, Op: op}
+	switch op.Op {
+	case Add, Copy, Move:
+		ev.Old, ev.OldExists = addTarget(document, op.Path)
+	default:
+		ev.Old, ev.OldExists = valueAt(document, op.Path)
+	}
+	fail := func(err error) (any, error) {
+		for _, obs := range o.observers {
+			obs.OnError(ev, err)
+		}
+		return nil, err
+	}
+
+	if lim != nil {
+		if err := lim.check(document, op); err != nil {
+			return fail(err)
+		}
+	}
+	for _, obs := range o.observers {
+		if err := obs.OnBeforeOp(ev); err != nil {
+			return fail(err)
+		}
+	}
+	document, err := step(document, op)
+	if err != nil {
+		return fail(err)
+	}
+	switch {
+	case op.Op == Remove:
+	case isAppendPath(op.Path):
+		// "-" appended to the parent array; report the new last element.
+		if arr, ok := parentArray(document, op.Path); ok && len(arr) > 0 {
+			ev.New, ev.NewExists = arr[len(arr)-1], true
+		}
+	default:
+		ev.New, ev.NewExists = valueAt(document, op.Path)
+	}
+	for _, obs := range o.observers {
+		obs.OnAfterOp(ev)
+	}
+	return document, nil
+}
+
+// valueAt returns the value at path and whether it exists.
+func valueAt(document any, path string) (any, bool) {
+	v, err := getPointer(document, path)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// parentArray returns the array containing the location path refers to.
+func parentArray(document any, path string) ([]any, bool) {
+	p, err := jsonpointer.New(path)
+	if err != nil || len(p) == 0 {
+		return nil, false
+	}
+	parent, err := getTokens(document, p[:len(p)-1])
+	arr, ok := parent.([]any)
+	return arr, err == nil && ok
+}
+
+// isAppendPath reports whether path ends with the "-" array append token.
+func isAppendPath(path string) bool {
+	return len(path) >= 2 && path[len(path)-2:] == "/-"
+}
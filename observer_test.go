@@ -0,0 +1,144 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestObserverEvents(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"a":1,"arr":["x"]}`), &doc)
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/a", Value: 2.0},
+		{Op: jsonpatch.Add, Path: "/arr/-", Value: "y"},
+		{Op: jsonpatch.Remove, Path: "/arr/0"},
+		{Op: jsonpatch.Test, Path: "/a", Value: 2.0},
+	}
+
+	type event struct {
+		Index     int
+		Op        jsonpatch.Op
+		Old, New  any
+		OldExists bool
+		NewExists bool
+	}
+	want := []event{
+		{0, jsonpatch.Replace, 1.0, 2.0, true, true},
+		{1, jsonpatch.Add, nil, "y", false, true},
+		{2, jsonpatch.Remove, "x", nil, true, false},
+		{3, jsonpatch.Test, 2.0, 2.0, true, true},
+	}
+
+	for _, name := range []string{"Apply", "Prepare"} {
+		t.Run(name, func(t *testing.T) {
+			var before, after []event
+			obs := jsonpatch.ObserverFuncs{
+				BeforeOp: func(ev jsonpatch.OpEvent) error {
+					before = append(before, event{Index: ev.Index, Op: ev.Op.Op, Old: ev.Old, OldExists: ev.OldExists})
+					return nil
+				},
+				AfterOp: func(ev jsonpatch.OpEvent) {
+					after = append(after, event{ev.Index, ev.Op.Op, ev.Old, ev.New, ev.OldExists, ev.NewExists})
+				},
+			}
+			var err error
+			if name == "Apply" {
+				_, err = jsonpatch.Apply(doc, patch, jsonpatch.WithObserver(obs))
+			} else {
+				_, err = jsonpatch.Prepare(doc, patch, jsonpatch.WithObserver(obs))
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(before) != len(want) {
+				t.Fatalf("expected %d OnBeforeOp calls, got %d", len(want), len(before))
+			}
+			if !reflect.DeepEqual(after, want) {
+				t.Errorf("unexpected events\n\tgot:  %+v\n\twant: %+v", after, want)
+			}
+		})
+	}
+}
+
+func TestObserverVeto(t *testing.T) {
+	doc := map[string]any{"spec": map[string]any{"replicas": 1.0}, "metadata": map[string]any{"owner": "a"}}
+	errForbidden := errors.New("forbidden")
+	var failed []string
+	obs := jsonpatch.ObserverFuncs{
+		BeforeOp: func(ev jsonpatch.OpEvent) error {
+			if strings.HasPrefix(ev.Op.Path, "/metadata") {
+				return errForbidden
+			}
+			return nil
+		},
+		Error: func(ev jsonpatch.OpEvent, err error) {
+			failed = append(failed, ev.Op.Path)
+		},
+	}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/spec/replicas", Value: 3.0},
+		{Op: jsonpatch.Remove, Path: "/metadata/owner"},
+	}
+
+	_, err := jsonpatch.Apply(doc, patch, jsonpatch.WithObserver(obs))
+	if !errors.Is(err, errForbidden) {
+		t.Fatalf("expected veto error, got %v", err)
+	}
+	var patchErr *jsonpatch.Error
+	if !errors.As(err, &patchErr) || patchErr.Index != 1 {
+		t.Errorf("expected *jsonpatch.Error for operation 1, got %v", err)
+	}
+	if !reflect.DeepEqual(failed, []string{"/metadata/owner"}) {
+		t.Errorf("expected OnError for vetoed op, got %v", failed)
+	}
+}
+
+func TestObserverSeesExpandedOperations(t *testing.T) {
+	doc := map[string]any{"items": []any{map[string]any{}, map[string]any{}}}
+	var paths []string
+	obs := jsonpatch.ObserverFuncs{AfterOp: func(ev jsonpatch.OpEvent) {
+		paths = append(paths, ev.Op.Path)
+	}}
+	patch := jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/items/*/done", Value: true}}
+	if _, err := jsonpatch.Apply(doc, patch, jsonpatch.WithPathExpansion(), jsonpatch.WithObserver(obs)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/items/0/done", "/items/1/done"}) {
+		t.Errorf("unexpected observed paths %v", paths)
+	}
+}
+
+func TestObserverSeesConcretizeErrors(t *testing.T) {
+	doc := map[string]any{"items": []any{1.0, 2.0}, "a": 1.0}
+	patches := map[string]jsonpatch.Patch{
+		"expansion": {{Op: jsonpatch.Add, Path: "/items/*", Value: 0.0}},
+		"relative":  {{Op: jsonpatch.Copy, From: "9/a", Path: "/b"}},
+		"limit":     {{Op: jsonpatch.Replace, Path: "/items/*", Value: 0.0}},
+	}
+	opts := []jsonpatch.Option{jsonpatch.WithPathExpansion(), jsonpatch.WithRelativePointers(), jsonpatch.WithLimits(jsonpatch.Limits{MaxOperations: 1})}
+	for name, patch := range patches {
+		for _, prepare := range []bool{false, true} {
+			var events []jsonpatch.OpEvent
+			obs := jsonpatch.ObserverFuncs{Error: func(ev jsonpatch.OpEvent, err error) {
+				events = append(events, ev)
+			}}
+			var err error
+			if prepare {
+				_, err = jsonpatch.Prepare(doc, patch, append(opts, jsonpatch.WithObserver(obs))...)
+			} else {
+				_, err = jsonpatch.Apply(doc, patch, append(opts, jsonpatch.WithObserver(obs))...)
+			}
+			if err == nil {
+				t.Fatalf("%s: expected an error", name)
+			}
+			if len(events) != 1 || events[0].Index != 0 || events[0].Op != patch[0] {
+				t.Errorf("%s (prepare %v): OnError events %+v, want one for the operation as given", name, prepare, events)
+			}
+		}
+	}
+}
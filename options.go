@@ -0,0 +1,83 @@
+package jsonpatch
+
+import "context"
+
+// Option configures optional behaviour of Apply, ApplyInPlace, ApplyStream and Prepare.
+type Option func(*options)
+
+type options struct {
+	expand    bool
+	relative  bool
+	limits    *Limits
+	ctx       context.Context
+	observers []Observer
+	anchor    KeyAnchor
+	ordered   bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPathExpansion enables extended operations whose path is a wildcard
+// pointer such as "/items/*/status" or an RFC 9535 JSONPath expression such as
+// "$.users[?@.role=='guest']". Each extended operation is expanded against the
+// current document into one concrete RFC 6902 operation per matched location.
+//
+// With expansion enabled a "*" reference token always acts as a wildcard; use a
+// JSONPath name selector such as "$['*']" to address a member literally named "*".
+func WithPathExpansion() Option {
+	return func(o *options) {
+		o.expand = true
+	}
+}
+
+// WithRelativePointers enables Relative JSON Pointers (e.g. "1/name" or "0-1")
+// in the from member of move and copy operations. They are resolved against the
+// operation's path, after any path expansion, so one patch template can be reused
+// across sibling subtrees.
+func WithRelativePointers() Option {
+	return func(o *options) {
+		o.relative = true
+	}
+}
+
+// rewrites reports whether op has to be concretized before it can be applied.
+func (o *options) rewrites(op Operation) bool {
+	if o.expand && isExtendedPath(op.Path) {
+		return true
+	}
+	return o.relative && (op.Op == Move || op.Op == Copy) && isRelativePointer(op.From)
+}
+
+// concretize rewrites op into plain RFC 6902 operations against the current
+// state of document: extended paths are expanded and relative from pointers
+// are resolved against each resulting path. Expansion stops as soon as it
+// exceeds the operations lim has left.
+func (o *options) concretize(document any, op Operation, lim *limiter) (Patch, error) {
+	ops := Patch{op}
+	if o.expand && isExtendedPath(op.Path) {
+		var err error
+		ops, err = expandOperation(document, op, lim.remaining())
+		if err != nil {
+			return nil, err
+		}
+		if err := lim.checkExpansion(op, len(ops)); err != nil {
+			return nil, err
+		}
+	}
+	if o.relative && (op.Op == Move || op.Op == Copy) && isRelativePointer(op.From) {
+		for i := range ops {
+			from, err := resolveRelativeLocation(document, ops[i].Path, op.From)
+			if err != nil {
+				return nil, err
+			}
+			ops[i].From = from
+		}
+	}
+	return ops, nil
+}
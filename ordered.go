@@ -0,0 +1,349 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// OrderedObject is a JSON object that preserves the order of its members.
+// Documents decoded with DecodeOrdered use it for every object, and Apply,
+// ApplyInPlace, ApplyStream and New keep member order when patching them:
+// added members are appended (see WithKeyAnchor), and replaced members keep
+// their position. Path expansion and relative pointers are not supported for
+// ordered documents. The zero value is an empty object.
+type OrderedObject struct {
+	keys   []string
+	values map[string]any
+}
+
+// NewOrderedObject returns an empty object.
+func NewOrderedObject() *OrderedObject {
+	return &OrderedObject{values: make(map[string]any)}
+}
+
+// Len returns the number of members.
+func (o *OrderedObject) Len() int {
+	return len(o.keys)
+}
+
+// Keys returns the member names in order.
+func (o *OrderedObject) Keys() []string {
+	return append([]string(nil), o.keys...)
+}
+
+// Get returns the value of member key.
+func (o *OrderedObject) Get(key string) (any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set sets member key. An existing member keeps its position; a new one is appended.
+func (o *OrderedObject) Set(key string, value any) {
+	if o.values == nil {
+		o.values = make(map[string]any)
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// InsertAfter sets member key, placing it directly after member anchor if key
+// is new. If anchor does not exist the member is appended.
+func (o *OrderedObject) InsertAfter(anchor, key string, value any) {
+	if _, ok := o.values[key]; ok {
+		o.values[key] = value
+		return
+	}
+	at := o.index(anchor)
+	if at < 0 {
+		o.Set(key, value)
+		return
+	}
+	o.keys = append(o.keys, "")
+	copy(o.keys[at+2:], o.keys[at+1:])
+	o.keys[at+1] = key
+	o.values[key] = value
+}
+
+// Delete removes member key and reports whether it existed.
+func (o *OrderedObject) Delete(key string) bool {
+	i := o.index(key)
+	if i < 0 {
+		return false
+	}
+	o.keys = append(o.keys[:i], o.keys[i+1:]...)
+	delete(o.values, key)
+	return true
+}
+
+func (o *OrderedObject) index(key string) int {
+	if _, ok := o.values[key]; !ok {
+		return -1
+	}
+	for i, k := range o.keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// MarshalJSON encodes the object with its members in order.
+func (o *OrderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object, using OrderedObject for nested objects too.
+func (o *OrderedObject) UnmarshalJSON(data []byte) error {
+	v, err := DecodeOrdered(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	obj, ok := v.(*OrderedObject)
+	if !ok {
+		return fmt.Errorf("jsonpatch: cannot unmarshal %s into OrderedObject", jsonTypeName(v))
+	}
+	*o = *obj
+	return nil
+}
+
+// DecodeOrdered reads one JSON value from r like encoding/json, except that
+// objects are decoded as *OrderedObject. For duplicate member names the last
+// value wins at the position of the first.
+func DecodeOrdered(r io.Reader) (any, error) {
+	return decodeOrdered(json.NewDecoder(r))
+}
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := NewOrderedObject()
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(keyTok.(string), value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return tok, nil
+}
+
+// KeyAnchor chooses where a new member key of the ordered object at the JSON
+// Pointer parent is inserted: directly after the returned sibling, or at the
+// end when ok is false or the sibling does not exist.
+type KeyAnchor func(parent, key string) (after string, ok bool)
+
+// WithKeyAnchor sets where members added to ordered objects are inserted.
+func WithKeyAnchor(anchor KeyAnchor) Option {
+	return func(o *options) {
+		o.anchor = anchor
+	}
+}
+
+// WithOrderedObjects makes ApplyStream, ApplyStreamLines and ApplyStreamKeyed
+// decode documents with DecodeOrdered, so the output keeps the input's member order.
+// Ordered documents support every option but WithPathExpansion and
+// WithRelativePointers, which make applying them fail.
+func WithOrderedObjects() Option {
+	return func(o *options) {
+		o.ordered = true
+	}
+}
+
+// isOrderedDocument reports whether document uses OrderedObject, judging by
+// the root or, for arrays, the first container element.
+func isOrderedDocument(document any) bool {
+	switch v := document.(type) {
+	case *OrderedObject:
+		return true
+	case []any:
+		for _, e := range v {
+			switch e.(type) {
+			case *OrderedObject:
+				return true
+			case map[string]any, []any:
+				return isOrderedDocument(e)
+			}
+		}
+	}
+	return false
+}
+
+// applyOrdered applies patch in place to an ordered document through the node engine.
+func applyOrdered(document any, patch Patch, o *options) (any, error) {
+	if err := checkOrderedOptions(o); err != nil {
+		return nil, err
+	}
+	lim, err := newLimiter(o.limits, document, patch)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range patch {
+		if document, err = applyOrderedOperation(document, i, op, o, lim); err != nil {
+			return nil, err
+		}
+	}
+	return document, nil
+}
+
+// applyOrderedOperation is applyPatchOperation for ordered documents.
+func applyOrderedOperation(document any, i int, op Operation, o *options, lim *limiter) (any, error) {
+	if o.ctx != nil {
+		if err := o.ctx.Err(); err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	document, err := runOperation(document, i, op, o, lim, func(doc any, op Operation) (any, error) {
+		root := &DocumentNode{v: doc, ordered: true, anchor: o.anchor}
+		if err := applyNodeOperation(root, op); err != nil {
+			return nil, err
+		}
+		return root.Document(), nil
+	})
+	if err != nil {
+		return nil, &Error{Index: i, Op: op.Op, Err: err}
+	}
+	return document, nil
+}
+
+// checkOrderedOptions rejects the options the node engine does not implement.
+func checkOrderedOptions(o *options) error {
+	if o.expand || o.relative {
+		return errors.New("jsonpatch: path expansion and relative pointers are not supported for ordered documents")
+	}
+	return nil
+}
+
+// toOrdered converts the objects in value to *OrderedObject, ordering members
+// of plain maps by name.
+func toOrdered(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		obj := &OrderedObject{keys: keys, values: make(map[string]any, len(v))}
+		for k, e := range v {
+			obj.values[k] = toOrdered(e)
+		}
+		return obj
+	case *OrderedObject:
+		for k, e := range v.values {
+			v.values[k] = toOrdered(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = toOrdered(e)
+		}
+		return v
+	}
+	return value
+}
+
+// toPlain converts value to encoding/json's representation, replacing ordered
+// objects by maps.
+func toPlain(value any) any {
+	switch v := value.(type) {
+	case *OrderedObject:
+		m := make(map[string]any, len(v.values))
+		for k, e := range v.values {
+			m[k] = toPlain(e)
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = toPlain(e)
+		}
+		return m
+	case []any:
+		cp := make([]any, len(v))
+		for i, e := range v {
+			cp[i] = toPlain(e)
+		}
+		return cp
+	}
+	return value
+}
+
+// diffOrderedObject diffs two objects, at least one of them ordered. Removed
+// members come first, followed by changes and additions in b's order, so
+// applying the patch to a appends new members in b's order.
+func diffOrderedObject(ctx context.Context, path string, a, b *OrderedObject) (Patch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out Patch
+	for _, k := range a.keys {
+		if _, ok := b.values[k]; !ok {
+			out = append(out, Operation{Op: Remove, Path: joinPath(path, k)})
+		}
+	}
+	for _, k := range b.keys {
+		vb := b.values[k]
+		if va, ok := a.values[k]; ok {
+			child, err := diffValue(ctx, joinPath(path, k), va, vb)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, child...)
+			continue
+		}
+		out = append(out, Operation{Op: Add, Path: joinPath(path, k), Value: cloneValue(vb)})
+	}
+	return out, nil
+}
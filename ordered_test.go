@@ -0,0 +1,168 @@
+package jsonpatch_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func mustDecodeOrdered(t *testing.T, s string) any {
+	t.Helper()
+	v, err := jsonpatch.DecodeOrdered(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("DecodeOrdered(%s): %v", s, err)
+	}
+	return v
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestDecodeOrderedRoundTrip(t *testing.T) {
+	const in = `{"z":1,"a":{"y":[{"q":true,"b":null}],"x":"s"},"m":[]}`
+	doc := mustDecodeOrdered(t, in)
+	if got := mustMarshal(t, doc); got != in {
+		t.Fatalf("round trip = %s, want %s", got, in)
+	}
+
+	var obj jsonpatch.OrderedObject
+	if err := json.Unmarshal([]byte(`{"b":1,"a":2,"b":3}`), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustMarshal(t, &obj); got != `{"b":3,"a":2}` {
+		t.Fatalf("duplicate keys = %s", got)
+	}
+}
+
+func TestApplyOrdered(t *testing.T) {
+	doc := mustDecodeOrdered(t, `{"name":"svc","replicas":1,"labels":{"tier":"web","app":"x"},"ports":[{"port":80,"proto":"tcp"}]}`)
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/replicas", Value: 3.0},
+		{Op: jsonpatch.Add, Path: "/labels/env", Value: "prod"},
+		{Op: jsonpatch.Remove, Path: "/labels/tier"},
+		{Op: jsonpatch.Add, Path: "/ports/-", Value: map[string]any{"proto": "udp", "port": 53.0}},
+		{Op: jsonpatch.Test, Path: "/labels", Value: map[string]any{"env": "prod", "app": "x"}},
+		{Op: jsonpatch.Copy, From: "/labels", Path: "/selector"},
+	}
+	got, err := jsonpatch.Apply(doc, patch)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := `{"name":"svc","replicas":3,"labels":{"app":"x","env":"prod"},"ports":[{"port":80,"proto":"tcp"},{"port":53,"proto":"udp"}],"selector":{"app":"x","env":"prod"}}`
+	if s := mustMarshal(t, got); s != want {
+		t.Fatalf("got  %s\nwant %s", s, want)
+	}
+	if s := mustMarshal(t, doc); !strings.Contains(s, `"replicas":1`) {
+		t.Fatalf("Apply modified its input: %s", s)
+	}
+
+	if _, err := jsonpatch.ApplyInPlace(doc, patch[:1]); err != nil {
+		t.Fatalf("ApplyInPlace: %v", err)
+	}
+	if s := mustMarshal(t, doc); !strings.HasPrefix(s, `{"name":"svc","replicas":3,`) {
+		t.Fatalf("ApplyInPlace result = %s", s)
+	}
+}
+
+func TestApplyOrderedKeyAnchor(t *testing.T) {
+	doc := mustDecodeOrdered(t, `{"apiVersion":"v1","kind":"Pod","spec":{}}`)
+	anchor := func(parent, key string) (string, bool) {
+		if parent == "" && key == "metadata" {
+			return "kind", true
+		}
+		return "", false
+	}
+	got, err := jsonpatch.Apply(doc, jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/metadata", Value: map[string]any{"name": "p"}},
+		{Op: jsonpatch.Add, Path: "/status", Value: "ok"},
+	}, jsonpatch.WithKeyAnchor(anchor))
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if s, want := mustMarshal(t, got), `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"p"},"spec":{},"status":"ok"}`; s != want {
+		t.Fatalf("got  %s\nwant %s", s, want)
+	}
+}
+
+func TestApplyStreamOrdered(t *testing.T) {
+	var out bytes.Buffer
+	err := jsonpatch.ApplyStream(strings.NewReader(`{"b":1,"a":2}`), &out,
+		jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/c", Value: 3.0}}, jsonpatch.WithOrderedObjects())
+	if err != nil {
+		t.Fatalf("ApplyStream: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != `{"b":1,"a":2,"c":3}` {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestNewOrdered(t *testing.T) {
+	a := mustDecodeOrdered(t, `{"z":1,"y":{"k":1},"x":2}`)
+	b := mustDecodeOrdered(t, `{"z":1,"y":{"k":2,"n":0,"m":0},"x":2,"w":3,"v":4}`)
+	patch, err := jsonpatch.New(a, b)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var paths []string
+	for _, op := range patch {
+		paths = append(paths, string(op.Op)+" "+op.Path)
+	}
+	if got, want := strings.Join(paths, ", "), "replace /y/k, add /y/n, add /y/m, add /w, add /v"; got != want {
+		t.Fatalf("patch = %s, want %s", got, want)
+	}
+	got, err := jsonpatch.Apply(a, patch)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if mustMarshal(t, got) != mustMarshal(t, b) {
+		t.Fatalf("Apply(a, New(a, b)) = %s, want %s", mustMarshal(t, got), mustMarshal(t, b))
+	}
+}
+
+func TestApplyOrderedUnsupportedOptions(t *testing.T) {
+	doc := mustDecodeOrdered(t, `{"a":1}`)
+	_, err := jsonpatch.Apply(doc, jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/a"}}, jsonpatch.WithPathExpansion())
+	if err == nil {
+		t.Fatal("Apply with path expansion on an ordered document succeeded")
+	}
+}
+
+func TestApplyOrderedLimitsAndObservers(t *testing.T) {
+	doc := mustDecodeOrdered(t, `{"b":{"x":1},"a":[1,2]}`)
+	var events []string
+	obs := jsonpatch.ObserverFuncs{AfterOp: func(ev jsonpatch.OpEvent) {
+		events = append(events, fmt.Sprintf("%s %s %s -> %s", ev.Op.Op, ev.Op.Path, mustMarshal(t, ev.Old), mustMarshal(t, ev.New)))
+	}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/b/x", Value: 2.0},
+		{Op: jsonpatch.Add, Path: "/a/-", Value: 3.0},
+	}
+	got, err := jsonpatch.Apply(doc, patch, jsonpatch.WithObserver(obs), jsonpatch.WithLimits(jsonpatch.Limits{MaxDocumentNodes: 7}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := mustMarshal(t, got); s != `{"b":{"x":2},"a":[1,2,3]}` {
+		t.Fatalf("Apply = %s", s)
+	}
+	want := []string{"replace /b/x 1 -> 2", "add /a/- null -> 3"}
+	if strings.Join(events, "; ") != strings.Join(want, "; ") {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+
+	_, err = jsonpatch.Apply(doc, patch, jsonpatch.WithLimits(jsonpatch.Limits{MaxDocumentNodes: 6}))
+	var limitErr *jsonpatch.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxDocumentNodes" {
+		t.Fatalf("Apply over the node limit = %v, want a MaxDocumentNodes *LimitError", err)
+	}
+}
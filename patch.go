@@ -1,6 +1,7 @@
 package jsonpatch
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -46,6 +47,8 @@ type Delta struct {
 	After         any    `json:"after,omitempty"`
 	ExistedBefore bool   `json:"existed_before"`
 	ExistedAfter  bool   `json:"existed_after"`
+	// Index is the position in the patch of the operation that produced the delta.
+	Index int `json:"index"`
 }
 
 // Diff encapsulates ordered deltas and precompiled forward/reverse patches.
@@ -65,6 +68,51 @@ func (d Diff) Revert(document any) (any, error) {
 	return ApplyInPlace(document, d.reverse)
 }
 
+// Forward returns the concrete patch that reproduces the effect, equivalent to
+// Apply. Its values are copies, so the patch may be modified or retained.
+func (d Diff) Forward() Patch {
+	return clonePatch(d.forward)
+}
+
+// Reverse returns the concrete patch that undoes the effect, equivalent to
+// Revert. Its values are copies, so the patch may be modified or retained.
+func (d Diff) Reverse() Patch {
+	return clonePatch(d.reverse)
+}
+
+// Clone returns a copy of d whose deltas and patches hold copies of the
+// values, so it may be modified or retained.
+func (d Diff) Clone() Diff {
+	deltas := make([]Delta, len(d.Deltas))
+	for i, delta := range d.Deltas {
+		delta.Before = cloneValue(delta.Before)
+		delta.After = cloneValue(delta.After)
+		deltas[i] = delta
+	}
+	if d.Deltas == nil {
+		deltas = nil
+	}
+	return Diff{Deltas: deltas, forward: clonePatch(d.forward), reverse: clonePatch(d.reverse)}
+}
+
+// Clone returns a copy of p whose values are copies, so it may be modified
+// or retained.
+func (p Patch) Clone() Patch {
+	return clonePatch(p)
+}
+
+func clonePatch(patch Patch) Patch {
+	if patch == nil {
+		return nil
+	}
+	out := make(Patch, len(patch))
+	for i, op := range patch {
+		op.Value = cloneValue(op.Value)
+		out[i] = op
+	}
+	return out
+}
+
 func isRootPath(path string) bool {
 	p, err := jsonpointer.New(path)
 	if err != nil {
@@ -78,178 +126,66 @@ func isRootPath(path string) bool {
 // Prepare builds a Diff by simulating applying patch to original without mutating original.
 // The returned Diff captures concrete, reproducible deltas (including resolving "-" array paths)
 // that can be applied to reproduce the patch effect or reverted to undo it.
-func Prepare(original any, patch Patch) (Diff, error) {
+func Prepare(original any, patch Patch, opts ...Option) (Diff, error) {
+	_, diff, err := prepare(original, patch, newOptions(opts))
+	return diff, err
+}
+
+// ApplyWithDiff applies patch to a copy of document like Apply and also
+// returns the Diff that Prepare would, walking the document once.
+func ApplyWithDiff(document any, patch Patch, opts ...Option) (any, Diff, error) {
+	o := newOptions(opts)
+	result, diff, err := prepare(document, patch, o)
+	if err != nil {
+		return nil, Diff{}, err
+	}
+	if isOrderedDocument(document) {
+		// prepare works on a plain copy; replay the deltas to keep member order.
+		if result, err = applyOrdered(cloneValue(document), diff.forward, &options{anchor: o.anchor}); err != nil {
+			return nil, Diff{}, err
+		}
+	}
+	return result, diff, nil
+}
+
+// prepare implements Prepare and also returns the patched copy of original.
+func prepare(original any, patch Patch, o *options) (any, Diff, error) {
 	// Work on a deep copy so the caller's document is not modified
 	docCopy, err := deepCopyAny(original)
 	if err != nil {
-		return Diff{}, fmt.Errorf("failed to deepcopy original: %w", err)
+		return nil, Diff{}, fmt.Errorf("failed to deepcopy original: %w", err)
 	}
 
-	var deltas []Delta
-
-	for _, op := range patch {
-		switch op.Op {
-		case Add:
-			// Resolve concrete path (handle "-" for arrays)
-			resolvedPath, err := resolveConcreteAddPath(docCopy, op.Path)
-			if err != nil {
-				return Diff{}, fmt.Errorf("add resolve path failed: %w", err)
-			}
-			existedBefore, beforeVal, err := tryGetDeep(docCopy, resolvedPath)
-			if err != nil {
-				return Diff{}, fmt.Errorf("add read before failed: %w", err)
-			}
-			afterVal, err := deepCopyAny(op.Value)
-			if err != nil {
-				return Diff{}, fmt.Errorf("add deepcopy value failed: %w", err)
-			}
-			deltas = append(deltas, Delta{
-				Path:          resolvedPath,
-				Op:            Add,
-				Before:        beforeVal,
-				After:         afterVal,
-				ExistedBefore: existedBefore,
-				ExistedAfter:  true,
-			})
-
-			// Apply to working document using the original (possibly "-"-containing) path
-			docCopy, err = applyAdd(docCopy, op.Path, op.Value)
-			if err != nil {
-				return Diff{}, fmt.Errorf("apply add failed: %w", err)
-			}
-
-		case Remove:
-			// Capture existing value
-			beforeValRaw, err := jsonpointer.Get(docCopy, op.Path)
-			if err != nil {
-				return Diff{}, fmt.Errorf("remove get before failed: %w", err)
-			}
-			beforeVal, err := deepCopyAny(beforeValRaw)
-			if err != nil {
-				return Diff{}, fmt.Errorf("remove deepcopy failed: %w", err)
-			}
-			deltas = append(deltas, Delta{
-				Path:          op.Path,
-				Op:            Remove,
-				Before:        beforeVal,
-				ExistedBefore: true,
-				ExistedAfter:  false,
-			})
-
-			docCopy, err = applyRemove(docCopy, op.Path)
-			if err != nil {
-				return Diff{}, fmt.Errorf("apply remove failed: %w", err)
-			}
-
-		case Replace:
-			// Replace must exist; capture before and after
-			beforeValRaw, err := jsonpointer.Get(docCopy, op.Path)
-			if err != nil {
-				return Diff{}, fmt.Errorf("replace get before failed: %w", err)
-			}
-			beforeVal, err := deepCopyAny(beforeValRaw)
-			if err != nil {
-				return Diff{}, fmt.Errorf("replace deepcopy before failed: %w", err)
-			}
-			afterVal, err := deepCopyAny(op.Value)
-			if err != nil {
-				return Diff{}, fmt.Errorf("replace deepcopy after failed: %w", err)
-			}
-			deltas = append(deltas, Delta{
-				Path:          op.Path,
-				Op:            Replace,
-				Before:        beforeVal,
-				After:         afterVal,
-				ExistedBefore: true,
-				ExistedAfter:  true,
-			})
-
-			docCopy, err = applyReplace(docCopy, op.Path, op.Value)
-			if err != nil {
-				return Diff{}, fmt.Errorf("apply replace failed: %w", err)
-			}
-
-		case Move:
-			// Move is copy then remove with respect to deltas (capture using pre-state)
-			valRaw, err := jsonpointer.Get(docCopy, op.From)
-			if err != nil {
-				return Diff{}, fmt.Errorf("move get source failed: %w", err)
-			}
-			valCopy, err := deepCopyAny(valRaw)
-			if err != nil {
-				return Diff{}, fmt.Errorf("move deepcopy source failed: %w", err)
-			}
-			resolvedDest, err := resolveConcreteAddPath(docCopy, op.Path)
-			if err != nil {
-				return Diff{}, fmt.Errorf("move resolve dest failed: %w", err)
-			}
-			destExisted, destBefore, err := tryGetDeep(docCopy, resolvedDest)
-			if err != nil {
-				return Diff{}, fmt.Errorf("move get dest before failed: %w", err)
-			}
-
-			// Add at destination first
-			deltas = append(deltas, Delta{
-				Path:          resolvedDest,
-				Op:            Add,
-				Before:        destBefore,
-				After:         valCopy,
-				ExistedBefore: destExisted,
-				ExistedAfter:  true,
-			})
-			// Then remove from source
-			deltas = append(deltas, Delta{
-				Path:          op.From,
-				Op:            Remove,
-				Before:        valCopy,
-				ExistedBefore: true,
-				ExistedAfter:  false,
-			})
+	lim, err := newLimiter(o.limits, docCopy, patch)
+	if err != nil {
+		return nil, Diff{}, err
+	}
 
-			docCopy, err = applyMove(docCopy, op.From, op.Path)
-			if err != nil {
-				return Diff{}, fmt.Errorf("apply move failed: %w", err)
-			}
+	var deltas []Delta
 
-		case Copy:
-			valRaw, err := jsonpointer.Get(docCopy, op.From)
-			if err != nil {
-				return Diff{}, fmt.Errorf("copy get source failed: %w", err)
-			}
-			valCopy, err := deepCopyAny(valRaw)
-			if err != nil {
-				return Diff{}, fmt.Errorf("copy deepcopy source failed: %w", err)
-			}
-			resolvedDest, err := resolveConcreteAddPath(docCopy, op.Path)
-			if err != nil {
-				return Diff{}, fmt.Errorf("copy resolve dest failed: %w", err)
-			}
-			destExisted, destBefore, err := tryGetDeep(docCopy, resolvedDest)
+	for i, op := range patch {
+		ops := Patch{op}
+		if o.rewrites(op) {
+			// Extended and relative paths are resolved against the working
+			// document so the deltas record every concrete location touched.
+			ops, err = o.concretize(docCopy, op, lim)
 			if err != nil {
-				return Diff{}, fmt.Errorf("copy get dest before failed: %w", err)
+				notifyError(o, i, op, err)
+				return nil, Diff{}, fmt.Errorf("%s resolve path failed: %w", op.Op, err)
 			}
-
-			deltas = append(deltas, Delta{
-				Path:          resolvedDest,
-				Op:            Add,
-				Before:        destBefore,
-				After:         valCopy,
-				ExistedBefore: destExisted,
-				ExistedAfter:  true,
+		}
+		for _, concrete := range ops {
+			docCopy, err = runOperation(docCopy, i, concrete, o, lim, func(doc any, op Operation) (any, error) {
+				doc, opDeltas, err := prepareOperation(doc, op)
+				for k := range opDeltas {
+					opDeltas[k].Index = i
+				}
+				deltas = append(deltas, opDeltas...)
+				return doc, err
 			})
-
-			docCopy, err = applyCopy(docCopy, op.From, op.Path)
 			if err != nil {
-				return Diff{}, fmt.Errorf("apply copy failed: %w", err)
-			}
-
-		case Test:
-			if err := applyTest(docCopy, op.Path, op.Value); err != nil {
-				return Diff{}, fmt.Errorf("test failed: %w", err)
+				return nil, Diff{}, err
 			}
-			// No delta recorded
-		default:
-			return Diff{}, fmt.Errorf("unsupported patch operation in prepare: %s", op.Op)
 		}
 	}
 
@@ -264,7 +200,7 @@ func Prepare(original any, patch Patch) (Diff, error) {
 		case Replace:
 			forward = append(forward, Operation{Op: Replace, Path: delta.Path, Value: delta.After})
 		default:
-			return Diff{}, fmt.Errorf("unsupported delta op in forward compile: %s", delta.Op)
+			return nil, Diff{}, fmt.Errorf("unsupported delta op in forward compile: %s", delta.Op)
 		}
 	}
 	var reverse Patch
@@ -287,11 +223,186 @@ func Prepare(original any, patch Patch) (Diff, error) {
 		case Replace:
 			reverse = append(reverse, Operation{Op: Replace, Path: delta.Path, Value: delta.Before})
 		default:
-			return Diff{}, fmt.Errorf("unsupported delta op in reverse compile: %s", delta.Op)
+			return nil, Diff{}, fmt.Errorf("unsupported delta op in reverse compile: %s", delta.Op)
 		}
 	}
 
-	return Diff{Deltas: deltas, forward: forward, reverse: reverse}, nil
+	return docCopy, Diff{Deltas: deltas, forward: forward, reverse: reverse}, nil
+}
+
+// prepareOperation applies a single concrete operation to document and returns
+// the updated document together with the deltas it produced.
+func prepareOperation(document any, op Operation) (any, []Delta, error) {
+	var deltas []Delta
+	var err error
+
+	switch op.Op {
+	case Add:
+		// Resolve concrete path (handle "-" for arrays)
+		resolvedPath, err := resolveConcreteAddPath(document, op.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("add resolve path failed: %w", err)
+		}
+		existedBefore, beforeVal, err := tryGetAddTarget(document, resolvedPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("add read before failed: %w", err)
+		}
+		afterVal, err := deepCopyAny(op.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("add deepcopy value failed: %w", err)
+		}
+		deltas = append(deltas, Delta{
+			Path:          resolvedPath,
+			Op:            Add,
+			Before:        beforeVal,
+			After:         afterVal,
+			ExistedBefore: existedBefore,
+			ExistedAfter:  true,
+		})
+
+		// Apply to working document using the original (possibly "-"-containing) path
+		document, err = applyAdd(document, op.Path, op.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apply add failed: %w", err)
+		}
+
+	case Remove:
+		// Capture existing value
+		beforeValRaw, err := jsonpointer.Get(document, op.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("remove get before failed: %w", err)
+		}
+		beforeVal, err := deepCopyAny(beforeValRaw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("remove deepcopy failed: %w", err)
+		}
+		deltas = append(deltas, Delta{
+			Path:          op.Path,
+			Op:            Remove,
+			Before:        beforeVal,
+			ExistedBefore: true,
+			ExistedAfter:  false,
+		})
+
+		document, err = applyRemove(document, op.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apply remove failed: %w", err)
+		}
+
+	case Replace:
+		// Replace must exist; capture before and after
+		beforeValRaw, err := jsonpointer.Get(document, op.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("replace get before failed: %w", err)
+		}
+		beforeVal, err := deepCopyAny(beforeValRaw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("replace deepcopy before failed: %w", err)
+		}
+		afterVal, err := deepCopyAny(op.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("replace deepcopy after failed: %w", err)
+		}
+		deltas = append(deltas, Delta{
+			Path:          op.Path,
+			Op:            Replace,
+			Before:        beforeVal,
+			After:         afterVal,
+			ExistedBefore: true,
+			ExistedAfter:  true,
+		})
+
+		document, err = applyReplace(document, op.Path, op.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apply replace failed: %w", err)
+		}
+
+	case Move:
+		// Move is remove then add, mirroring applyMove so the destination is
+		// resolved against the document with the source already removed.
+		valRaw, err := jsonpointer.Get(document, op.From)
+		if err != nil {
+			return nil, nil, fmt.Errorf("move get source failed: %w", err)
+		}
+		valCopy, err := deepCopyAny(valRaw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("move deepcopy source failed: %w", err)
+		}
+		deltas = append(deltas, Delta{
+			Path:          op.From,
+			Op:            Remove,
+			Before:        valCopy,
+			ExistedBefore: true,
+			ExistedAfter:  false,
+		})
+		document, err = applyRemove(document, op.From)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apply move failed: %w", err)
+		}
+
+		resolvedDest, err := resolveConcreteAddPath(document, op.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("move resolve dest failed: %w", err)
+		}
+		destExisted, destBefore, err := tryGetAddTarget(document, resolvedDest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("move get dest before failed: %w", err)
+		}
+		deltas = append(deltas, Delta{
+			Path:          resolvedDest,
+			Op:            Add,
+			Before:        destBefore,
+			After:         valCopy,
+			ExistedBefore: destExisted,
+			ExistedAfter:  true,
+		})
+		document, err = applyAdd(document, op.Path, valRaw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apply move failed: %w", err)
+		}
+
+	case Copy:
+		valRaw, err := jsonpointer.Get(document, op.From)
+		if err != nil {
+			return nil, nil, fmt.Errorf("copy get source failed: %w", err)
+		}
+		valCopy, err := deepCopyAny(valRaw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("copy deepcopy source failed: %w", err)
+		}
+		resolvedDest, err := resolveConcreteAddPath(document, op.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("copy resolve dest failed: %w", err)
+		}
+		destExisted, destBefore, err := tryGetAddTarget(document, resolvedDest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("copy get dest before failed: %w", err)
+		}
+
+		deltas = append(deltas, Delta{
+			Path:          resolvedDest,
+			Op:            Add,
+			Before:        destBefore,
+			After:         valCopy,
+			ExistedBefore: destExisted,
+			ExistedAfter:  true,
+		})
+
+		document, err = applyCopy(document, op.From, op.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apply copy failed: %w", err)
+		}
+
+	case Test:
+		if err = applyTest(document, op.Path, op.Value); err != nil {
+			return nil, nil, fmt.Errorf("test failed: %w", err)
+		}
+		// No delta recorded
+	default:
+		return nil, nil, fmt.Errorf("unsupported patch operation in prepare: %s", op.Op)
+	}
+
+	return document, deltas, nil
 }
 
 // deepCopyAny performs a JSON round-trip to safely copy arbitrary JSON-like values.
@@ -307,6 +418,33 @@ func deepCopyAny(value any) (any, error) {
 	return out, nil
 }
 
+// cloneValue deep-copies the containers of a value already in encoding/json's
+// representation. Leaf values are shared, which is safe since they are immutable.
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		cp := make(map[string]any, len(v))
+		for k, e := range v {
+			cp[k] = cloneValue(e)
+		}
+		return cp
+	case []any:
+		cp := make([]any, len(v))
+		for i, e := range v {
+			cp[i] = cloneValue(e)
+		}
+		return cp
+	case *OrderedObject:
+		cp := &OrderedObject{keys: append([]string(nil), v.keys...), values: make(map[string]any, len(v.values))}
+		for k, e := range v.values {
+			cp.values[k] = cloneValue(e)
+		}
+		return cp
+	default:
+		return value
+	}
+}
+
 // tryGetDeep attempts to get a value at path and returns whether it existed and a deep copy if so.
 func tryGetDeep(document any, path string) (bool, any, error) {
 	val, err := jsonpointer.Get(document, path)
@@ -320,6 +458,22 @@ func tryGetDeep(document any, path string) (bool, any, error) {
 	return true, cp, nil
 }
 
+// tryGetAddTarget is tryGetDeep for add destinations. Adding into an array
+// inserts rather than overwrites, so nothing existed before at that location.
+func tryGetAddTarget(document any, path string) (bool, any, error) {
+	p, err := jsonpointer.New(path)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(p) > 0 {
+		parent, err := jsonpointer.Pointer(p[:len(p)-1]).Get(document)
+		if _, isArray := parent.([]any); err == nil && isArray {
+			return false, nil, nil
+		}
+	}
+	return tryGetDeep(document, path)
+}
+
 // resolveConcreteAddPath converts an add path with "-" (array append) into a concrete index path
 // based on the current state of the parent array. If the path does not end with "-", it is returned unchanged.
 func resolveConcreteAddPath(document any, path string) (string, error) {
@@ -355,8 +509,38 @@ func resolveConcreteAddPath(document any, path string) (string, error) {
 
 // Apply applies a series of JSON Patch operations to a document, returning a new
 // modified document. The original document is not changed.
-func Apply(document any, patch Patch) (any, error) {
+func Apply(document any, patch Patch, opts ...Option) (any, error) {
+	return apply(document, patch, newOptions(opts))
+}
+
+func apply(document any, patch Patch, o *options) (any, error) {
+	if isOrderedDocument(document) {
+		return applyOrdered(cloneValue(document), patch, o)
+	}
+	// Reject oversized patches before paying for the copy.
+	if o.limits != nil && o.limits.MaxOperations > 0 && len(patch) > o.limits.MaxOperations {
+		return nil, &LimitError{Limit: "MaxOperations", Max: o.limits.MaxOperations, Actual: len(patch)}
+	}
+
 	// Deep copy the document to avoid modifying the original
+	result, err := copyDocument(document, o)
+	if err != nil {
+		return nil, err
+	}
+	return applyInPlace(result, patch, o)
+}
+
+// copyDocument deep-copies a document that is not ordered before it is patched.
+func copyDocument(document any, o *options) (any, error) {
+	if o.ctx != nil {
+		result, ok, err := cloneValueContext(o.ctx, document)
+		if err != nil {
+			return nil, &Error{Index: -1, Err: err}
+		}
+		if ok {
+			return result, nil
+		}
+	}
 	docBytes, err := json.Marshal(document)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal document: %w", err)
@@ -366,51 +550,101 @@ func Apply(document any, patch Patch) (any, error) {
 	if err := json.Unmarshal(docBytes, &result); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal document: %w", err)
 	}
-
-	return ApplyInPlace(result, patch)
+	return result, nil
 }
 
 // ApplyInPlace applies a series of JSON Patch operations to a document in-place.
 // WARNING: This function modifies the input document.
-func ApplyInPlace(document any, patch Patch) (any, error) {
-	for _, op := range patch {
-		var err error
-		switch op.Op {
-		case Add:
-			document, err = applyAdd(document, op.Path, op.Value)
-		case Remove:
-			document, err = applyRemove(document, op.Path)
-		case Replace:
-			document, err = applyReplace(document, op.Path, op.Value)
-		case Move:
-			document, err = applyMove(document, op.From, op.Path)
-		case Copy:
-			document, err = applyCopy(document, op.From, op.Path)
-		case Test:
-			err = applyTest(document, op.Path, op.Value)
-		default:
-			return nil, fmt.Errorf("unsupported patch operation: %s", op.Op)
+func ApplyInPlace(document any, patch Patch, opts ...Option) (any, error) {
+	return applyInPlace(document, patch, newOptions(opts))
+}
+
+func applyInPlace(document any, patch Patch, o *options) (any, error) {
+	if isOrderedDocument(document) {
+		return applyOrdered(document, patch, o)
+	}
+	lim, err := newLimiter(o.limits, document, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range patch {
+		if document, err = applyPatchOperation(document, i, op, o, lim); err != nil {
+			return nil, err
 		}
+	}
+
+	return document, nil
+}
 
+// applyPatchOperation applies the operation at index i of a patch in place,
+// concretizing it first if needed. Errors are reported as *Error.
+func applyPatchOperation(document any, i int, op Operation, o *options, lim *limiter) (any, error) {
+	if o.ctx != nil {
+		if err := o.ctx.Err(); err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	var err error
+	if o.rewrites(op) {
+		var ops Patch
+		ops, err = o.concretize(document, op, lim)
 		if err != nil {
-			return nil, fmt.Errorf("patch operation %s failed: %w", op.Op, err)
+			notifyError(o, i, op, err)
 		}
+		for j := 0; err == nil && j < len(ops); j++ {
+			document, err = runOperation(document, i, ops[j], o, lim, applyOperation)
+		}
+	} else {
+		document, err = runOperation(document, i, op, o, lim, applyOperation)
+	}
+	if err != nil {
+		return nil, &Error{Index: i, Op: op.Op, Err: err}
 	}
-
 	return document, nil
 }
 
+// applyOperation applies a single concrete operation to document.
+func applyOperation(document any, op Operation) (any, error) {
+	switch op.Op {
+	case Add:
+		return applyAdd(document, op.Path, op.Value)
+	case Remove:
+		return applyRemove(document, op.Path)
+	case Replace:
+		return applyReplace(document, op.Path, op.Value)
+	case Move:
+		return applyMove(document, op.From, op.Path)
+	case Copy:
+		return applyCopy(document, op.From, op.Path)
+	case Test:
+		return document, applyTest(document, op.Path, op.Value)
+	default:
+		return nil, fmt.Errorf("unsupported patch operation: %s", op.Op)
+	}
+}
+
 // ApplyStream applies a series of JSON Patch operations from a reader to a writer.
 // This is more memory-efficient for large documents than Apply, as it avoids
 // marshalling the intermediate document to a byte slice.
-func ApplyStream(reader io.Reader, writer io.Writer, patch Patch) error {
+func ApplyStream(reader io.Reader, writer io.Writer, patch Patch, opts ...Option) error {
+	return applyStream(reader, writer, patch, newOptions(opts))
+}
+
+func applyStream(reader io.Reader, writer io.Writer, patch Patch, o *options) error {
 	var doc any
 	decoder := json.NewDecoder(reader)
-	if err := decoder.Decode(&doc); err != nil {
+	var err error
+	if o.ordered {
+		doc, err = decodeOrdered(decoder)
+	} else {
+		err = decoder.Decode(&doc)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to decode document: %w", err)
 	}
 
-	modifiedDoc, err := Apply(doc, patch)
+	modifiedDoc, err := apply(doc, patch, o)
 	if err != nil {
 		return err
 	}
@@ -494,7 +728,9 @@ func applyCopy(document any, from, to string) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	return jsonpointer.Set(document, to, val)
+	// Copy the value so later operations on either location do not affect the
+	// other, and use add semantics for the destination per RFC6902.
+	return applyAdd(document, to, cloneValue(val))
 }
 
 func applyTest(document any, path string, expected any) error {
@@ -532,7 +768,7 @@ func New(a, b any) (Patch, error) {
 	if err != nil {
 		return nil, err
 	}
-	return diffValue("", na, nb)
+	return diffValue(context.Background(), "", na, nb)
 }
 
 // normalizeJSONInput canonicalizes arbitrary input into encoding/json's standard
@@ -552,6 +788,9 @@ func normalizeJSONInput(v any) (any, error) {
 		}
 		return out, nil
 	default:
+		if isOrderedDocument(tv) {
+			return cloneValue(tv), nil
+		}
 		// Round-trip through JSON to normalize numeric types to float64, etc.
 		return deepCopyAny(tv)
 	}
@@ -571,7 +810,7 @@ func joinPath(base, token string) string {
 	return base + "/" + escapeToken(token)
 }
 
-func diffValue(path string, a, b any) (Patch, error) {
+func diffValue(ctx context.Context, path string, a, b any) (Patch, error) {
 	// If fully equal, no ops.
 	if reflect.DeepEqual(a, b) {
 		return nil, nil
@@ -580,14 +819,32 @@ func diffValue(path string, a, b any) (Patch, error) {
 	// Object vs Object
 	if ma, ok := a.(map[string]any); ok {
 		if mb, ok := b.(map[string]any); ok {
-			return diffObject(path, ma, mb)
+			return diffObject(ctx, path, ma, mb)
+		}
+	}
+
+	// Ordered objects keep b's member order; a plain map on either side is
+	// ordered by member name.
+	oa, aOrdered := a.(*OrderedObject)
+	ob, bOrdered := b.(*OrderedObject)
+	if aOrdered || bOrdered {
+		_, aMap := a.(map[string]any)
+		_, bMap := b.(map[string]any)
+		switch {
+		case aOrdered && bMap:
+			ob, bOrdered = toOrdered(cloneValue(b)).(*OrderedObject), true
+		case bOrdered && aMap:
+			oa, aOrdered = toOrdered(cloneValue(a)).(*OrderedObject), true
+		}
+		if aOrdered && bOrdered {
+			return diffOrderedObject(ctx, path, oa, ob)
 		}
 	}
 
 	// Array vs Array
 	if sa, ok := a.([]any); ok {
 		if sb, ok := b.([]any); ok {
-			return diffArray(path, sa, sb)
+			return diffArray(ctx, path, sa, sb)
 		}
 	}
 
@@ -597,8 +854,11 @@ func diffValue(path string, a, b any) (Patch, error) {
 	}, nil
 }
 
-func diffObject(path string, a, b map[string]any) (Patch, error) {
+func diffObject(ctx context.Context, path string, a, b map[string]any) (Patch, error) {
 	var out Patch
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// Track keys in a
 	for ka := range a {
@@ -615,7 +875,7 @@ func diffObject(path string, a, b map[string]any) (Patch, error) {
 	for kb, vb := range b {
 		if va, exists := a[kb]; exists {
 			// Recurse
-			child, err := diffValue(joinPath(path, kb), va, vb)
+			child, err := diffValue(ctx, joinPath(path, kb), va, vb)
 			if err != nil {
 				return nil, err
 			}
@@ -640,13 +900,13 @@ func diffObject(path string, a, b map[string]any) (Patch, error) {
 // diffArray produces a patch transforming a -> b using an LCS-based edit script.
 // It uses tokenized equality (cached JSON marshal of elements) and emits removes
 // in descending index order followed by adds in ascending index order.
-func diffArray(path string, a, b []any) (Patch, error) {
+func diffArray(ctx context.Context, path string, a, b []any) (Patch, error) {
 	// Precompute tokens
-	atoks, err := tokenizeArray(a)
+	atoks, err := tokenizeArray(ctx, a)
 	if err != nil {
 		return nil, err
 	}
-	btoks, err := tokenizeArray(b)
+	btoks, err := tokenizeArray(ctx, b)
 	if err != nil {
 		return nil, err
 	}
@@ -662,6 +922,9 @@ func diffArray(path string, a, b []any) (Patch, error) {
 	pairs := make([]pair, 0, min(n, m))
 	seq := make([]int, 0, min(n, m))
 	for j, t := range btoks {
+		if err := pollContext(ctx, j); err != nil {
+			return nil, err
+		}
 		q := posMap[t]
 		if len(q) == 0 {
 			continue
@@ -680,6 +943,9 @@ func diffArray(path string, a, b []any) (Patch, error) {
 		prev[i] = -1
 	}
 	for i, v := range seq {
+		if err := pollContext(ctx, i); err != nil {
+			return nil, err
+		}
 		lo, hi := 0, len(tails)
 		for lo < hi {
 			mid := (lo + hi) / 2
@@ -751,9 +1017,12 @@ func min(a, b int) int {
 	return b
 }
 
-func tokenizeArray(arr []any) ([]string, error) {
+func tokenizeArray(ctx context.Context, arr []any) ([]string, error) {
 	out := make([]string, len(arr))
 	for i, v := range arr {
+		if err := pollContext(ctx, i); err != nil {
+			return nil, err
+		}
 		switch tv := v.(type) {
 		case nil:
 			out[i] = "0"
@@ -40,6 +40,33 @@ func runBenchmark(b *testing.B, docStr string, patchStr string) {
 	}
 }
 
+// runCompiledBenchmark mirrors runBenchmark but compiles the patch once up front.
+func runCompiledBenchmark(b *testing.B, docStr string, patchStr string) {
+	var doc any
+	if err := json.Unmarshal([]byte(docStr), &doc); err != nil {
+		b.Fatalf("Failed to unmarshal document: %v", err)
+	}
+
+	var patch jsonpatch.Patch
+	if err := json.Unmarshal([]byte(patchStr), &patch); err != nil {
+		b.Fatalf("Failed to unmarshal patch: %v", err)
+	}
+	compiled, err := jsonpatch.Compile(patch)
+	if err != nil {
+		b.Fatalf("Compile failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := compiled.Apply(doc)
+		if err != nil {
+			b.Fatalf("Apply failed: %v", err)
+		}
+	}
+}
+
 func BenchmarkAdd_Object(b *testing.B) {
 	runBenchmark(b, baseDoc, `[{"op": "add", "path": "/foo2", "value": "bar2"}]`)
 }
@@ -170,3 +197,60 @@ func BenchmarkCombinedOperations_InPlace(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkCompiled_Add_Object(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "add", "path": "/foo2", "value": "bar2"}]`)
+}
+
+func BenchmarkCompiled_Add_Array(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "add", "path": "/baz/1", "value": "new"}]`)
+}
+
+func BenchmarkCompiled_Remove_Object(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "remove", "path": "/foo"}]`)
+}
+
+func BenchmarkCompiled_Remove_Array(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "remove", "path": "/baz/0"}]`)
+}
+
+func BenchmarkCompiled_Replace_Nested(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "replace", "path": "/a/b/c", "value": "world"}]`)
+}
+
+func BenchmarkCompiled_Move(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "move", "from": "/foo", "path": "/foo2"}]`)
+}
+
+func BenchmarkCompiled_Copy(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "copy", "from": "/a/b", "path": "/a/d"}]`)
+}
+
+func BenchmarkCompiled_Test_Success(b *testing.B) {
+	runCompiledBenchmark(b, baseDoc, `[{"op": "test", "path": "/foo", "value": "bar"}]`)
+}
+
+func BenchmarkCompiled_CombinedOperations(b *testing.B) {
+	doc := `{
+		"metadata": {
+			"id": "12345",
+			"version": 1.0,
+			"tags": ["alpha", "beta"]
+		},
+		"data": {
+			"items": [
+				{"name": "item1", "value": 100},
+				{"name": "item2", "value": 200}
+			]
+		}
+	}`
+	patch := `[
+		{"op": "replace", "path": "/metadata/version", "value": 1.1},
+		{"op": "add", "path": "/data/items/1", "value": {"name": "item1.5", "value": 150}},
+		{"op": "remove", "path": "/metadata/tags"},
+		{"op": "test", "path": "/data/items/0/name", "value": "item1"},
+		{"op": "copy", "from": "/data/items/2", "path": "/data/items/0/copy"},
+		{"op": "move", "from": "/data/items/0", "path": "/data/items/1"}
+	]`
+	runCompiledBenchmark(b, doc, patch)
+}
@@ -151,3 +151,93 @@ func TestDiffApplyRevert_CopyAndArrayAppend(t *testing.T) {
 		t.Fatalf("Revert did not restore original:\nwant=%#v\ngot =%#v", original, restored)
 	}
 }
+
+func TestDiffApplyRevert_CopyIntoArray(t *testing.T) {
+	original := map[string]any{
+		"a":   "X",
+		"arr": []any{"A", "B"},
+	}
+	patch := Patch{
+		{Op: Copy, From: "/a", Path: "/arr/0"}, // insert at existing index -> [X,A,B]
+	}
+
+	diff, err := Prepare(original, patch)
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	if d := diff.Deltas[0]; d.Op != Add || d.ExistedBefore || d.Before != nil {
+		t.Fatalf("copy into array delta = %#v, want an insertion", d)
+	}
+
+	got, err := diff.Apply(cloneValue(original))
+	if err != nil {
+		t.Fatalf("Diff.Apply failed: %v", err)
+	}
+	want := map[string]any{"a": "X", "arr": []any{"X", "A", "B"}}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("Diff.Apply mismatch:\nwant=%#v\ngot =%#v", want, got)
+	}
+
+	restored, err := diff.Revert(got)
+	if err != nil {
+		t.Fatalf("Diff.Revert failed: %v", err)
+	}
+	if !reflect.DeepEqual(original, restored) {
+		t.Fatalf("Revert did not restore original:\nwant=%#v\ngot =%#v", original, restored)
+	}
+}
+
+func TestDiffApplyRevert_ArrayInsertAndMoveWithinArray(t *testing.T) {
+	original := map[string]any{
+		"arr": []any{"A", "B", "C"},
+	}
+	patch := Patch{
+		{Op: Add, Path: "/arr/1", Value: "X"},      // insert at existing index -> [A,X,B,C]
+		{Op: Move, From: "/arr/0", Path: "/arr/3"}, // move within the same array -> [X,B,C,A]
+	}
+
+	want, err := Apply(original, patch)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	diff, err := Prepare(original, patch)
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	// Inserts did not overwrite anything, and the move removes its source
+	// before adding it at the index it has after the removal.
+	wantDeltas := []struct {
+		path          string
+		op            Op
+		existedBefore bool
+	}{
+		{"/arr/1", Add, false},
+		{"/arr/0", Remove, true},
+		{"/arr/3", Add, false},
+	}
+	if len(diff.Deltas) != len(wantDeltas) {
+		t.Fatalf("got %d deltas, want %d: %#v", len(diff.Deltas), len(wantDeltas), diff.Deltas)
+	}
+	for i, w := range wantDeltas {
+		if d := diff.Deltas[i]; d.Path != w.path || d.Op != w.op || d.ExistedBefore != w.existedBefore {
+			t.Fatalf("delta %d = %#v, want %s %s with ExistedBefore=%v", i, d, w.op, w.path, w.existedBefore)
+		}
+	}
+
+	got, err := diff.Apply(map[string]any{"arr": []any{"A", "B", "C"}})
+	if err != nil {
+		t.Fatalf("Diff.Apply failed: %v", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("Apply vs Diff.Apply mismatch:\nwant=%#v\ngot =%#v", want, got)
+	}
+
+	restored, err := diff.Revert(got)
+	if err != nil {
+		t.Fatalf("Diff.Revert failed: %v", err)
+	}
+	if !reflect.DeepEqual(original, restored) {
+		t.Fatalf("Revert did not restore original:\nwant=%#v\ngot =%#v", original, restored)
+	}
+}
@@ -67,6 +67,18 @@ func TestApply(t *testing.T) {
 			patch:    `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
 			expected: `{"foo":["all","cows","eat","grass"]}`,
 		},
+		{
+			name:     "copy into an array inserts",
+			doc:      `{"a":"x","foo":["bar","baz"]}`,
+			patch:    `[{"op":"copy","from":"/a","path":"/foo/1"}]`,
+			expected: `{"a":"x","foo":["bar","x","baz"]}`,
+		},
+		{
+			name:     "copied value is independent of its source",
+			doc:      `{"a":{"b":1}}`,
+			patch:    `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/d","value":2}]`,
+			expected: `{"a":{"b":1},"c":{"b":1,"d":2}}`,
+		},
 		// RFC 6902, Appendix A.8. Test a Value
 		{
 			name:     "test a value (success)",
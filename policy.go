@@ -0,0 +1,271 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// Effect is the outcome of a matching policy Rule.
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Rule allows or denies operations on locations matching a pointer pattern.
+//
+// Path is a JSON Pointer in which the token "*" matches exactly one reference
+// token and "**" matches any number of tokens, including none. For example
+// "/spec/**" matches "/spec" and everything below it.
+type Rule struct {
+	Effect Effect
+	// Ops lists the operations the rule applies to; empty means all operations.
+	// Move and copy rules apply to both their path and from locations.
+	Ops  []Op
+	Path string
+	// MinDepth and MaxDepth bound the number of reference tokens of matching
+	// locations. Zero means unbounded.
+	MinDepth int
+	MaxDepth int
+}
+
+// Policy authorizes patch operations by their locations. A location is
+// rejected when any Deny rule matches it, and otherwise accepted when an Allow
+// rule matches it or DefaultAllow is set.
+//
+// Deny rules also reject operations on ancestors of the locations they match,
+// because replacing, removing or copying an ancestor touches the protected subtree.
+//
+// Build policies with NewPolicy, or call Validate on policies built as
+// literals: a rule whose path does not parse rejects every location it is
+// checked against.
+type Policy struct {
+	Rules        []Rule
+	DefaultAllow bool
+}
+
+// NewPolicy returns a Policy with rules, after validating them.
+func NewPolicy(defaultAllow bool, rules ...Rule) (*Policy, error) {
+	p := &Policy{Rules: rules, DefaultAllow: defaultAllow}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate reports the first rule with an unknown effect, a path that is not
+// a JSON Pointer or inconsistent depth bounds.
+func (p *Policy) Validate() error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Effect != Allow && r.Effect != Deny {
+			return fmt.Errorf("jsonpatch: policy rule %d: unknown effect %q", i, r.Effect)
+		}
+		if _, err := r.pattern(); err != nil {
+			return fmt.Errorf("jsonpatch: policy rule %d: invalid path '%s': %w", i, r.Path, err)
+		}
+		if r.MinDepth < 0 || r.MaxDepth < 0 || (r.MaxDepth > 0 && r.MinDepth > r.MaxDepth) {
+			return fmt.Errorf("jsonpatch: policy rule %d: invalid depth bounds %d..%d", i, r.MinDepth, r.MaxDepth)
+		}
+	}
+	return nil
+}
+
+// Violation describes one operation location rejected by a Policy.
+type Violation struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	// Op is the operation kind.
+	Op Op
+	// Path is the rejected location; it is the operation's from for sources of move and copy.
+	Path string
+	// Rule is the matching Deny rule, or nil when no Allow rule matched.
+	Rule *Rule
+	// Reason explains the rejection.
+	Reason string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("operation %d (%s '%s'): %s", v.Index, v.Op, v.Path, v.Reason)
+}
+
+// PolicyError is returned when a Policy rejects a patch while it is applied.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.String()
+	}
+	return "jsonpatch: policy violation: " + strings.Join(parts, "; ")
+}
+
+// Check verifies every operation of patch as written. Paths that can only be
+// resolved against a document, such as wildcard or JSONPath paths and relative
+// from pointers, are reported as violations; use CheckPrepared for those.
+func (p *Policy) Check(patch Patch) []Violation {
+	var out []Violation
+	for i, op := range patch {
+		if isExtendedPath(op.Path) || ((op.Op == Move || op.Op == Copy) && isRelativePointer(op.From)) {
+			out = append(out, Violation{Index: i, Op: op.Op, Path: op.Path, Reason: "path must be resolved against a document"})
+			continue
+		}
+		out = append(out, p.checkOperation(i, op)...)
+	}
+	return out
+}
+
+// CheckPrepared verifies the concrete locations that Prepare resolves for
+// patch against document, after path expansion and relative pointer resolution.
+// It returns an error only if the policy is invalid or the patch cannot be
+// prepared at all.
+func (p *Policy) CheckPrepared(document any, patch Patch, opts ...Option) ([]Violation, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	var out []Violation
+	collect := ObserverFuncs{BeforeOp: func(ev OpEvent) error {
+		out = append(out, p.checkOperation(ev.Index, ev.Op)...)
+		return nil
+	}}
+	if _, err := Prepare(document, patch, append(opts, WithObserver(collect))...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Observer returns an Observer that vetoes every concrete operation the policy
+// rejects with a *PolicyError, so the policy can be enforced by Apply. If the
+// policy is invalid, the observer vetoes every operation with the error of
+// Validate.
+func (p *Policy) Observer() Observer {
+	if err := p.Validate(); err != nil {
+		return ObserverFuncs{BeforeOp: func(OpEvent) error { return err }}
+	}
+	return ObserverFuncs{BeforeOp: func(ev OpEvent) error {
+		if vs := p.checkOperation(ev.Index, ev.Op); len(vs) > 0 {
+			return &PolicyError{Violations: vs}
+		}
+		return nil
+	}}
+}
+
+func (p *Policy) checkOperation(index int, op Operation) []Violation {
+	var out []Violation
+	if v, ok := p.checkLocation(index, op.Op, op.Path); !ok {
+		out = append(out, v)
+	}
+	if op.Op == Move || op.Op == Copy {
+		if v, ok := p.checkLocation(index, op.Op, op.From); !ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (p *Policy) checkLocation(index int, op Op, path string) (Violation, bool) {
+	v := Violation{Index: index, Op: op, Path: path}
+	tokens, err := jsonpointer.New(path)
+	if err != nil {
+		v.Reason = err.Error()
+		return v, false
+	}
+	allowed := p.DefaultAllow
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.appliesTo(op) {
+			continue
+		}
+		if _, err := r.pattern(); err != nil {
+			// Fail closed on rules that were never validated.
+			v.Rule, v.Reason = r, fmt.Sprintf("invalid rule path '%s': %v", r.Path, err)
+			return v, false
+		}
+		switch r.Effect {
+		case Deny:
+			if r.matches(tokens) {
+				v.Rule, v.Reason = r, fmt.Sprintf("denied by rule %s '%s'", r.Effect, r.Path)
+				return v, false
+			}
+			if r.coversDescendant(tokens) {
+				v.Rule, v.Reason = r, fmt.Sprintf("denied by rule %s '%s' on a descendant", r.Effect, r.Path)
+				return v, false
+			}
+		case Allow:
+			if r.matches(tokens) {
+				allowed = true
+			}
+		}
+	}
+	if !allowed {
+		v.Reason = "not allowed by any rule"
+		return v, false
+	}
+	return v, true
+}
+
+func (r *Rule) appliesTo(op Op) bool {
+	if len(r.Ops) == 0 {
+		return true
+	}
+	for _, o := range r.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) pattern() (jsonpointer.Pointer, error) {
+	return jsonpointer.New(r.Path)
+}
+
+// matches reports whether the location tokens match the rule's pattern and depth bounds.
+func (r *Rule) matches(tokens []string) bool {
+	if r.MinDepth > 0 && len(tokens) < r.MinDepth {
+		return false
+	}
+	if r.MaxDepth > 0 && len(tokens) > r.MaxDepth {
+		return false
+	}
+	pattern, err := r.pattern()
+	return err == nil && matchPattern(pattern, tokens, false)
+}
+
+// coversDescendant reports whether the pattern can match a proper descendant of tokens.
+func (r *Rule) coversDescendant(tokens []string) bool {
+	if r.MaxDepth > 0 && len(tokens) >= r.MaxDepth {
+		return false
+	}
+	pattern, err := r.pattern()
+	return err == nil && matchPattern(pattern, tokens, true)
+}
+
+// matchPattern matches tokens against pattern. With prefix set it instead
+// reports whether tokens can be extended by at least one token into a match.
+func matchPattern(pattern, tokens []string, prefix bool) bool {
+	if len(pattern) == 0 {
+		return !prefix && len(tokens) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(tokens); i++ {
+			if matchPattern(pattern[1:], tokens[i:], prefix) {
+				return true
+			}
+		}
+		// "**" may also continue past the end of tokens.
+		return prefix
+	}
+	if len(tokens) == 0 {
+		return prefix
+	}
+	if pattern[0] != "*" && pattern[0] != tokens[0] {
+		return false
+	}
+	return matchPattern(pattern[1:], tokens[1:], prefix)
+}
@@ -0,0 +1,157 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+var testPolicy = &jsonpatch.Policy{
+	Rules: []jsonpatch.Rule{
+		{Effect: jsonpatch.Allow, Ops: []jsonpatch.Op{jsonpatch.Replace, jsonpatch.Add, jsonpatch.Test}, Path: "/spec/**"},
+		{Effect: jsonpatch.Allow, Path: "/metadata/**"},
+		{Effect: jsonpatch.Deny, Path: "/metadata/ownerReferences/**"},
+		{Effect: jsonpatch.Deny, Ops: []jsonpatch.Op{jsonpatch.Remove}, Path: "/**", MaxDepth: 1},
+	},
+}
+
+func TestPolicyCheck(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patch    string
+		violated []string
+	}{
+		{
+			name:  "allowed operations",
+			patch: `[{"op":"replace","path":"/spec/replicas","value":3},{"op":"add","path":"/metadata/labels/x","value":"y"},{"op":"remove","path":"/metadata/labels"}]`,
+		},
+		{
+			name:     "operation kind not allowed",
+			patch:    `[{"op":"remove","path":"/spec/replicas"}]`,
+			violated: []string{"/spec/replicas"},
+		},
+		{
+			name:     "denied subtree",
+			patch:    `[{"op":"add","path":"/metadata/ownerReferences/0","value":{}}]`,
+			violated: []string{"/metadata/ownerReferences/0"},
+		},
+		{
+			name:     "ancestor of denied subtree",
+			patch:    `[{"op":"replace","path":"/metadata","value":{}}]`,
+			violated: []string{"/metadata"},
+		},
+		{
+			name:     "shallow remove",
+			patch:    `[{"op":"remove","path":"/metadata"}]`,
+			violated: []string{"/metadata"},
+		},
+		{
+			name:     "move from denied location",
+			patch:    `[{"op":"move","from":"/metadata/ownerReferences","path":"/metadata/old"}]`,
+			violated: []string{"/metadata/ownerReferences"},
+		},
+		{
+			name:     "copy may not read from denied location",
+			patch:    `[{"op":"copy","from":"/metadata/ownerReferences/0","path":"/metadata/first"}]`,
+			violated: []string{"/metadata/ownerReferences/0"},
+		},
+		{
+			name:     "copy may not read an ancestor of denied location",
+			patch:    `[{"op":"copy","from":"/metadata","path":"/metadata/backup"}]`,
+			violated: []string{"/metadata"},
+		},
+		{
+			name:     "every violation is listed",
+			patch:    `[{"op":"remove","path":"/status"},{"op":"replace","path":"/spec/x","value":1},{"op":"copy","from":"/spec","path":"/other"}]`,
+			violated: []string{"/status", "/other", "/spec"},
+		},
+		{
+			name:     "extended paths need a document",
+			patch:    `[{"op":"replace","path":"/spec/*/x","value":1}]`,
+			violated: []string{"/spec/*/x"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var patch jsonpatch.Patch
+			json.Unmarshal([]byte(tc.patch), &patch)
+			var got []string
+			for _, v := range testPolicy.Check(patch) {
+				got = append(got, v.Path)
+			}
+			if !reflect.DeepEqual(got, tc.violated) {
+				t.Errorf("got violations %v, want %v", got, tc.violated)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckPrepared(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"spec":{"containers":[{"image":"a"},{"image":"b"}]},"metadata":{"ownerReferences":[{"uid":"1"}],"name":"x"}}`), &doc)
+	var patch jsonpatch.Patch
+	json.Unmarshal([]byte(`[
+		{"op":"replace","path":"$.spec.containers[*].image","value":"c"},
+		{"op":"copy","from":"2/name","path":"/metadata/ownerReferences/-"},
+		{"op":"remove","path":"$..uid"}
+	]`), &patch)
+
+	violations, err := testPolicy.CheckPrepared(doc, patch, jsonpatch.WithPathExpansion(), jsonpatch.WithRelativePointers())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.Path)
+	}
+	want := []string{"/metadata/ownerReferences/-", "/metadata/ownerReferences/0/uid"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got violations %v, want %v", got, want)
+	}
+	if violations[0].Index != 1 || violations[1].Index != 2 {
+		t.Errorf("unexpected operation indices %+v", violations)
+	}
+}
+
+func TestPolicyObserver(t *testing.T) {
+	doc := map[string]any{"spec": map[string]any{"x": 1.0}, "metadata": map[string]any{}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/spec/x", Value: 2.0},
+		{Op: jsonpatch.Remove, Path: "/metadata"},
+	}
+	_, err := jsonpatch.Apply(doc, patch, jsonpatch.WithObserver(testPolicy.Observer()))
+	var policyErr *jsonpatch.PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected *PolicyError, got %v", err)
+	}
+	if len(policyErr.Violations) != 1 || policyErr.Violations[0].Index != 1 {
+		t.Errorf("unexpected violations %+v", policyErr.Violations)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := testPolicy.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if _, err := jsonpatch.NewPolicy(true, jsonpatch.Rule{Effect: jsonpatch.Deny, Path: "spec"}); err == nil {
+		t.Fatal("NewPolicy accepted a rule path that is not a JSON Pointer")
+	}
+
+	// Policies built as literals fail closed on invalid rules.
+	invalid := &jsonpatch.Policy{DefaultAllow: true, Rules: []jsonpatch.Rule{{Effect: jsonpatch.Deny, Path: "spec"}}}
+	patch := jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/spec/x", Value: 2.0}}
+	if violations := invalid.Check(patch); len(violations) != 1 {
+		t.Errorf("Check() = %+v, want one violation", violations)
+	}
+	doc := map[string]any{"spec": map[string]any{"x": 1.0}}
+	if _, err := invalid.CheckPrepared(doc, patch); err == nil {
+		t.Error("CheckPrepared accepted an invalid policy")
+	}
+	if _, err := jsonpatch.Apply(doc, patch, jsonpatch.WithObserver(invalid.Observer())); err == nil {
+		t.Error("Apply succeeded under an invalid policy")
+	}
+}
@@ -0,0 +1,289 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// PostgresUpdate is a patch compiled to SQL for a PostgreSQL jsonb column.
+type PostgresUpdate struct {
+	// Expr computes the patched document from the column, for use as
+	//
+	//	UPDATE t SET doc = <Expr> WHERE id = ... AND <Where>
+	Expr string
+	// Where holds the conditions the stored document must meet: the test
+	// operations, the existence of the values replaced, removed, moved and
+	// copied, and the existence of the parents of added values, with a
+	// jsonb_array_length condition for inserts at an index into an array.
+	// jsonb_set and jsonb_insert would otherwise leave the document
+	// unchanged under a missing parent and append past the end of an array.
+	// Values written earlier in the patch are not guarded. Where is empty
+	// when there are none.
+	Where string
+	// Args are the values of the placeholders $1 to $len(Args) used by Expr
+	// and Where: JSON text for jsonb values and []string for text[] paths.
+	Args []any
+}
+
+// ToPostgresJSONB compiles patch into a single parameterized SQL expression
+// over the jsonb column, built from jsonb_set, jsonb_insert, #- and #>, so a
+// row can be patched without reading it. The column name is quoted as an
+// identifier.
+//
+// As paths do not tell arrays from objects, numeric tokens of add operations
+// are taken to be array indices and become jsonb_insert. Test operations
+// become Where conditions: containment (@>) for scalar values on paths of
+// member names, which can use a GIN index, and equality otherwise.
+//
+// Wildcard paths, removing the root and tests of values changed earlier in
+// the patch cannot be expressed; they are reported together in a
+// *TranslationError.
+func ToPostgresJSONB(column string, patch Patch) (*PostgresUpdate, error) {
+	b := &pgBuilder{column: `"` + strings.ReplaceAll(column, `"`, `""`) + `"`}
+	b.expr = b.column
+	var unsupported []UnsupportedOperation
+	for i, op := range patch {
+		if reason := b.operation(op); reason != "" {
+			unsupported = append(unsupported, UnsupportedOperation{Index: i, Op: op, Reason: reason})
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, &TranslationError{Target: "PostgreSQL", Ops: unsupported}
+	}
+	return &PostgresUpdate{Expr: b.expr, Where: strings.Join(b.where, " AND "), Args: b.args}, nil
+}
+
+type pgBuilder struct {
+	column  string
+	expr    string
+	where   []string
+	args    []any
+	touched []string          // paths written by the patch so far
+	paths   map[string]string // placeholders of text[] paths
+	scopes  int
+}
+
+// param adds a placeholder for v.
+func (b *pgBuilder) param(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *pgBuilder) jsonParam(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return b.param(string(data)) + "::jsonb", nil
+}
+
+func (b *pgBuilder) pathParam(tokens []string) string {
+	key := jsonpointer.Pointer(tokens).String()
+	if p, ok := b.paths[key]; ok {
+		return p
+	}
+	p := b.param(append([]string{}, tokens...)) + "::text[]"
+	if b.paths == nil {
+		b.paths = make(map[string]string)
+	}
+	b.paths[key] = p
+	return p
+}
+
+// touch records that the patch writes the value at path. Inserting or
+// removing an array element shifts its siblings, so the whole array counts
+// as written then.
+func (b *pgBuilder) touch(path []string, shifts bool) {
+	if shifts && len(path) > 0 {
+		path = path[:len(path)-1]
+	}
+	b.touched = append(b.touched, jsonpointer.Pointer(path).String())
+}
+
+// operation compiles op, returning why it cannot be expressed, if so.
+func (b *pgBuilder) operation(op Operation) string {
+	path, err := jsonpointer.New(op.Path)
+	if err != nil {
+		return err.Error()
+	}
+	if hasWildcard(path) {
+		return "wildcard paths cannot be expressed in SQL"
+	}
+
+	switch op.Op {
+	case Add, Replace:
+		value, err := b.jsonParam(op.Value)
+		if err != nil {
+			return err.Error()
+		}
+		switch {
+		case len(path) == 0:
+			b.expr = value
+		case op.Op == Replace:
+			b.guard(op.Path, path)
+			b.expr = fmt.Sprintf("jsonb_set(%s, %s, %s, false)", b.expr, b.pathParam(path), value)
+		default:
+			b.guardParent(path)
+			b.expr = b.add(b.expr, path, value)
+		}
+		b.touch(path, op.Op == Add && insertsElement(path))
+	case Remove:
+		if len(path) == 0 {
+			return "cannot remove the document root"
+		}
+		b.guard(op.Path, path)
+		b.expr = fmt.Sprintf("(%s #- %s)", b.expr, b.pathParam(path))
+		b.touch(path, isArrayIndex(path[len(path)-1]))
+	case Move, Copy:
+		from, err := jsonpointer.New(op.From)
+		if err != nil {
+			return err.Error()
+		}
+		if hasWildcard(from) {
+			return "wildcard paths cannot be expressed in SQL"
+		}
+		if op.Op == Move && op.From == op.Path {
+			break
+		}
+		b.guard(op.From, from)
+		if op.Op == Move {
+			// The value is removed before it is added.
+			b.touch(from, len(from) > 0 && isArrayIndex(from[len(from)-1]))
+		}
+		if len(path) > 0 {
+			b.guardParent(path)
+		}
+		// Bind the document once, as it is both read and written.
+		b.scopes++
+		alias := "m" + strconv.Itoa(b.scopes)
+		fromParam := b.pathParam(from)
+		doc := alias + ".d"
+		target := doc
+		if op.Op == Move {
+			target = fmt.Sprintf("(%s #- %s)", doc, fromParam)
+		}
+		value := fmt.Sprintf("(%s #> %s)", doc, fromParam)
+		if len(path) == 0 {
+			b.expr = fmt.Sprintf("(SELECT %s FROM (SELECT %s AS d) AS %s)", value, b.expr, alias)
+		} else {
+			b.expr = fmt.Sprintf("(SELECT %s FROM (SELECT %s AS d) AS %s)", b.add(target, path, value), b.expr, alias)
+		}
+		b.touch(path, insertsElement(path))
+	case Test:
+		for _, t := range b.touched {
+			if pathsOverlap(t, op.Path) {
+				return "the tested value is changed by an earlier operation"
+			}
+		}
+		if cond, ok := b.containment(path, op.Value); ok {
+			b.where = append(b.where, cond)
+			break
+		}
+		value, err := b.jsonParam(op.Value)
+		if err != nil {
+			return err.Error()
+		}
+		b.where = append(b.where, fmt.Sprintf("%s #> %s = %s", b.column, b.pathParam(path), value))
+	default:
+		return fmt.Sprintf("unknown operation %q", op.Op)
+	}
+	return ""
+}
+
+// add returns the expression adding value at path to doc.
+func (b *pgBuilder) add(doc string, path []string, value string) string {
+	last := path[len(path)-1]
+	switch {
+	case last == "-":
+		end := append(append([]string{}, path[:len(path)-1]...), "-1")
+		return fmt.Sprintf("jsonb_insert(%s, %s, %s, true)", doc, b.pathParam(end), value)
+	case isArrayIndex(last):
+		return fmt.Sprintf("jsonb_insert(%s, %s, %s)", doc, b.pathParam(path), value)
+	}
+	return fmt.Sprintf("jsonb_set(%s, %s, %s, true)", doc, b.pathParam(path), value)
+}
+
+// guard requires the value at path to exist, unless the patch wrote it.
+func (b *pgBuilder) guard(pointer string, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	for _, t := range b.touched {
+		if pathsOverlap(t, pointer) {
+			return
+		}
+	}
+	b.where = append(b.where, fmt.Sprintf("%s #> %s IS NOT NULL", b.column, b.pathParam(path)))
+}
+
+// guardParent requires the parent of path to exist and, when adding at an
+// index of an array, to hold at least that many elements, unless the patch
+// wrote it. The root always exists. As numeric tokens may also be member
+// names, the length is only checked if the parent is an array.
+func (b *pgBuilder) guardParent(path []string) {
+	parent := path[:len(path)-1]
+	pointer := jsonpointer.Pointer(parent).String()
+	for _, t := range b.touched {
+		if pathsOverlap(t, pointer) {
+			return
+		}
+	}
+	b.guard(pointer, parent)
+	last := path[len(path)-1]
+	if !isArrayIndex(last) || last == "0" {
+		return
+	}
+	value := b.column
+	if len(parent) > 0 {
+		value = fmt.Sprintf("(%s #> %s)", b.column, b.pathParam(parent))
+	}
+	b.where = append(b.where, fmt.Sprintf("CASE jsonb_typeof(%s) WHEN 'array' THEN jsonb_array_length(%s) >= %s ELSE true END", value, value, last))
+}
+
+// containment returns a @> condition testing a scalar value at a path of
+// member names. Containment of objects and arrays is not equality.
+func (b *pgBuilder) containment(path []string, value any) (string, bool) {
+	switch value.(type) {
+	case map[string]any, []any:
+		return "", false
+	}
+	if len(path) == 0 {
+		return "", false
+	}
+	for _, tok := range path {
+		if isArrayIndex(tok) || tok == "-" {
+			return "", false
+		}
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		value = map[string]any{path[i]: value}
+	}
+	doc, err := b.jsonParam(value)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s @> %s", b.column, doc), true
+}
+
+// insertsElement reports whether adding at path inserts an array element,
+// taking numeric tokens to be array indices.
+func insertsElement(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	last := path[len(path)-1]
+	return last == "-" || isArrayIndex(last)
+}
+
+func hasWildcard(tokens []string) bool {
+	for _, tok := range tokens {
+		if tok == "*" || tok == "**" {
+			return true
+		}
+	}
+	return false
+}
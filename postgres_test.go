@@ -0,0 +1,84 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata")
+
+// TestToPostgresJSONB compiles each testdata/postgres/*.patch.json and
+// compares the SQL with the .golden file next to it.
+func TestToPostgresJSONB(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "postgres", "*.patch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden inputs found")
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".patch.json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var patch jsonpatch.Patch
+			if err := json.Unmarshal(data, &patch); err != nil {
+				t.Fatal(err)
+			}
+			u, err := jsonpatch.ToPostgresJSONB("doc", patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got strings.Builder
+			fmt.Fprintf(&got, "SET doc = %s\n", u.Expr)
+			if u.Where != "" {
+				fmt.Fprintf(&got, "WHERE %s\n", u.Where)
+			}
+			for i, arg := range u.Args {
+				a, _ := json.Marshal(arg)
+				fmt.Fprintf(&got, "$%d = %s\n", i+1, a)
+			}
+
+			golden := filepath.Join("testdata", "postgres", name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got.String()), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("SQL mismatch\ngot:\n%s\nwant:\n%s", got.String(), want)
+			}
+		})
+	}
+}
+
+func TestToPostgresJSONBUnsupported(t *testing.T) {
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/a", Value: 1.0},
+		{Op: jsonpatch.Test, Path: "/a", Value: 1.0},
+		{Op: jsonpatch.Remove, Path: ""},
+		{Op: jsonpatch.Replace, Path: "/items/*/done", Value: true},
+		{Op: jsonpatch.Add, Path: "/list/0", Value: 1.0},
+		{Op: jsonpatch.Test, Path: "/list/2", Value: 1.0},
+	}
+	_, err := jsonpatch.ToPostgresJSONB("doc", patch)
+	var te *jsonpatch.TranslationError
+	if !errors.As(err, &te) || te.Target != "PostgreSQL" || len(te.Ops) != 4 {
+		t.Fatalf("err = %v, want a *TranslationError with 4 operations", err)
+	}
+}
@@ -0,0 +1,215 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// RawOperation is an Operation whose value is kept as undecoded JSON. It
+// lets patches be validated, stored and forwarded without decoding and
+// re-encoding their values.
+type RawOperation struct {
+	Op    Op              `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// RawPatch is a patch of RawOperations. It is decoded and encoded with
+// encoding/json like Patch; the values are copied verbatim.
+type RawPatch []RawOperation
+
+// EncodeRawPatch converts patch to a RawPatch by encoding its values.
+func EncodeRawPatch(patch Patch) (RawPatch, error) {
+	raw := make(RawPatch, len(patch))
+	for i, op := range patch {
+		raw[i] = RawOperation{Op: op.Op, Path: op.Path, From: op.From}
+		if op.Op == Add || op.Op == Replace || op.Op == Test {
+			b, err := json.Marshal(op.Value)
+			if err != nil {
+				return nil, &Error{Index: i, Op: op.Op, Err: err}
+			}
+			raw[i].Value = b
+		}
+	}
+	return raw, nil
+}
+
+// Operation decodes the value of op.
+func (op RawOperation) Operation() (Operation, error) {
+	out := Operation{Op: op.Op, Path: op.Path, From: op.From}
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &out.Value); err != nil {
+			return out, fmt.Errorf("invalid value: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// Patch decodes the values of p. Errors are reported as *Error.
+func (p RawPatch) Patch() (Patch, error) {
+	patch := make(Patch, len(p))
+	for i, op := range p {
+		var err error
+		if patch[i], err = op.Operation(); err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return patch, nil
+}
+
+// Validate checks that every operation is well formed: its op is known, its
+// pointers parse, and add, replace and test carry a value that is valid JSON.
+// Values are scanned but not decoded. Errors are reported as *Error.
+func (p RawPatch) Validate() error {
+	for i, op := range p {
+		if err := op.validate(); err != nil {
+			return &Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return nil
+}
+
+func (op RawOperation) validate() error {
+	if _, _, err := parseOperation(op.Op, op.Path, op.From); err != nil {
+		return err
+	}
+	_, err := op.value()
+	return err
+}
+
+// value returns the value of an add, replace or test operation.
+func (op RawOperation) value() (json.RawMessage, error) {
+	switch op.Op {
+	case Add, Replace, Test:
+	default:
+		return nil, nil
+	}
+	if len(op.Value) == 0 {
+		return nil, errors.New("missing value")
+	}
+	if !json.Valid(op.Value) {
+		return nil, errors.New("invalid value: not valid JSON")
+	}
+	return op.Value, nil
+}
+
+// ApplyRaw applies patch to the JSON document and returns the encoded result.
+// Values inserted by add and replace are copied into the output verbatim and
+// only decoded if a later operation addresses a location inside them; test
+// decodes the values it compares.
+func ApplyRaw(document []byte, patch RawPatch) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+	for i, op := range patch {
+		var err error
+		if doc, err = applyRawOperation(doc, op); err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func applyRawOperation(document any, op RawOperation) (any, error) {
+	path, from, err := parseOperation(op.Op, op.Path, op.From)
+	if err != nil {
+		return nil, err
+	}
+	value, err := op.value()
+	if err != nil {
+		return nil, err
+	}
+	if op.Op == Test {
+		if document, err = materialize(document, parentTokens(path)); err != nil {
+			return nil, err
+		}
+		actual, err := getTokens(document, path)
+		if err != nil {
+			return nil, err
+		}
+		var expected any
+		if err := json.Unmarshal(value, &expected); err != nil {
+			return nil, err
+		}
+		if actual, err = deepCopyAny(actual); err != nil {
+			return nil, err
+		}
+		if !jsonEqual(actual, expected) {
+			return nil, fmt.Errorf("test failed: expected %s, got %v", value, actual)
+		}
+		return document, nil
+	}
+
+	if document, err = materialize(document, parentTokens(path)); err != nil {
+		return nil, err
+	}
+	if from != nil {
+		if document, err = materialize(document, parentTokens(from)); err != nil {
+			return nil, err
+		}
+	}
+	c := compiledOp{op: op.Op, path: path, from: from}
+	if value != nil {
+		c.value = value
+	}
+	return c.apply(document)
+}
+
+func parentTokens(tokens []string) []string {
+	if len(tokens) == 0 {
+		return tokens
+	}
+	return tokens[:len(tokens)-1]
+}
+
+// materialize decodes the raw values of document on the way to the location
+// identified by tokens, including the value there, so that the location can be
+// addressed. Missing locations are left for the operation to report.
+func materialize(document any, tokens []string) (any, error) {
+	root, err := decodeRaw(document)
+	if err != nil {
+		return nil, err
+	}
+	current := root
+	for _, tok := range tokens {
+		switch c := current.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return root, nil
+			}
+			if v, err = decodeRaw(v); err != nil {
+				return nil, err
+			}
+			c[tok] = v
+			current = v
+		case []any:
+			idx, err := arrayIndex(tok, len(c))
+			if err != nil {
+				return root, nil
+			}
+			v, err := decodeRaw(c[idx])
+			if err != nil {
+				return nil, err
+			}
+			c[idx] = v
+			current = v
+		default:
+			return root, nil
+		}
+	}
+	return root, nil
+}
+
+func decodeRaw(v any) (any, error) {
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		return v, nil
+	}
+	var out any
+	err := json.Unmarshal(raw, &out)
+	return out, err
+}
@@ -0,0 +1,97 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestRawPatchRoundTrip(t *testing.T) {
+	const in = `[{"op":"add","path":"/a","value":{"z":1,"b":[true,null]}},{"op":"move","path":"/c","from":"/a"},{"op":"test","path":"/c/z","value":1}]`
+	var raw jsonpatch.RawPatch
+	if err := json.Unmarshal([]byte(in), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := string(raw[0].Value); got != `{"z":1,"b":[true,null]}` {
+		t.Fatalf("raw value = %s", got)
+	}
+	out, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Fatalf("re-encoded\n%s\nwant\n%s", out, in)
+	}
+
+	patch, err := raw.Patch()
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if want := map[string]any{"z": 1.0, "b": []any{true, nil}}; !reflect.DeepEqual(patch[0].Value, want) {
+		t.Fatalf("decoded value = %v", patch[0].Value)
+	}
+	back, err := jsonpatch.EncodeRawPatch(patch)
+	if err != nil {
+		t.Fatalf("EncodeRawPatch: %v", err)
+	}
+	if back[1].Value != nil || string(back[2].Value) != "1" {
+		t.Fatalf("EncodeRawPatch = %v", back)
+	}
+}
+
+func TestRawPatchValidate(t *testing.T) {
+	for i, raw := range []jsonpatch.RawPatch{
+		{{Op: "frobnicate", Path: "/a"}},
+		{{Op: jsonpatch.Add, Path: "a", Value: json.RawMessage(`1`)}},
+		{{Op: jsonpatch.Add, Path: "/a"}},
+		{{Op: jsonpatch.Replace, Path: "/a", Value: json.RawMessage(`{"x":`)}},
+		{{Op: jsonpatch.Move, From: "/a", Path: "/a/b"}},
+	} {
+		err := append(jsonpatch.RawPatch{{Op: jsonpatch.Remove, Path: "/x"}}, raw...).Validate()
+		var perr *jsonpatch.Error
+		if !errors.As(err, &perr) || perr.Index != 1 {
+			t.Errorf("case %d: error = %v, want *Error at index 1", i, err)
+		}
+	}
+}
+
+func TestApplyRaw(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":1}`, `[{"op":"add","path":"/b","value":{"y":2,"x":[1,  2]}}]`, `{"a":1,"b":{"y":2,"x":[1,2]}}`},
+		{`{"a":1}`, `[{"op":"add","path":"/b","value":{"x":[]}},{"op":"add","path":"/b/x/-","value":"v"}]`, `{"a":1,"b":{"x":["v"]}}`},
+		{`{"a":[1,2]}`, `[{"op":"copy","from":"/a","path":"/b"},{"op":"remove","path":"/a/0"},{"op":"test","path":"/b","value":[1,2]}]`, `{"a":[2],"b":[1,2]}`},
+		{`{"a":{"b":1}}`, `[{"op":"replace","path":"","value":{"n":{"m":0}}},{"op":"move","from":"/n/m","path":"/m"}]`, `{"m":0,"n":{}}`},
+		{`[]`, `[{"op":"add","path":"/-","value":{"k":"v","a":1}},{"op":"test","path":"/0","value":{"a":1,"k":"v"}}]`, `[{"k":"v","a":1}]`},
+	}
+	for _, tt := range tests {
+		var raw jsonpatch.RawPatch
+		if err := json.Unmarshal([]byte(tt.patch), &raw); err != nil {
+			t.Fatal(err)
+		}
+		got, err := jsonpatch.ApplyRaw([]byte(tt.doc), raw)
+		if err != nil {
+			t.Errorf("ApplyRaw(%s, %s): %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ApplyRaw(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+
+	_, err := jsonpatch.ApplyRaw([]byte(`{"a":1}`), jsonpatch.RawPatch{
+		{Op: jsonpatch.Add, Path: "/b", Value: json.RawMessage(`2`)},
+		{Op: jsonpatch.Test, Path: "/a", Value: json.RawMessage(`"1"`)},
+	})
+	var perr *jsonpatch.Error
+	if !errors.As(err, &perr) || perr.Index != 1 {
+		t.Fatalf("error = %v, want *Error at index 1", err)
+	}
+}
@@ -0,0 +1,157 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// relativePointer is a parsed Relative JSON Pointer such as "1/name", "0-1" or "2#".
+type relativePointer struct {
+	up      int
+	shift   int
+	shifted bool
+	keyOnly bool
+	tail    jsonpointer.Pointer
+}
+
+// isRelativePointer reports whether s has the shape of a Relative JSON Pointer.
+// Absolute pointers are empty or start with '/', relative ones start with a digit.
+func isRelativePointer(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+func parseRelativePointer(s string) (relativePointer, error) {
+	var rp relativePointer
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 || (s[0] == '0' && i > 1) {
+		return rp, fmt.Errorf("jsonpatch: invalid relative pointer '%s': bad prefix", s)
+	}
+	up, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return rp, fmt.Errorf("jsonpatch: invalid relative pointer '%s': %w", s, err)
+	}
+	rp.up = up
+	rest := s[i:]
+
+	if rest != "" && (rest[0] == '+' || rest[0] == '-') {
+		j := 1
+		for j < len(rest) && rest[j] >= '0' && rest[j] <= '9' {
+			j++
+		}
+		if j == 1 || (rest[1] == '0' && j > 2) {
+			return rp, fmt.Errorf("jsonpatch: invalid relative pointer '%s': bad index manipulation", s)
+		}
+		shift, err := strconv.Atoi(rest[:j])
+		if err != nil {
+			return rp, fmt.Errorf("jsonpatch: invalid relative pointer '%s': %w", s, err)
+		}
+		rp.shift, rp.shifted = shift, true
+		rest = rest[j:]
+	}
+
+	if rest == "#" {
+		rp.keyOnly = true
+		return rp, nil
+	}
+	tail, err := jsonpointer.New(rest)
+	if err != nil {
+		return rp, fmt.Errorf("jsonpatch: invalid relative pointer '%s': %w", s, err)
+	}
+	rp.tail = tail
+	return rp, nil
+}
+
+// resolve returns the absolute location the pointer refers to from base, and
+// whether that location is an array element. The document is consulted to
+// validate index manipulation, which only applies to array elements.
+func (rp relativePointer) resolve(document any, base string) (jsonpointer.Pointer, bool, error) {
+	baseTokens, err := jsonpointer.New(base)
+	if err != nil {
+		return nil, false, err
+	}
+	if rp.up > len(baseTokens) {
+		return nil, false, fmt.Errorf("jsonpatch: relative pointer goes %d levels up from '%s'", rp.up, base)
+	}
+	tokens := make(jsonpointer.Pointer, len(baseTokens)-rp.up, len(baseTokens)-rp.up+len(rp.tail))
+	copy(tokens, baseTokens)
+
+	inArray := false
+	if len(tokens) > 0 {
+		parent, err := jsonpointer.Pointer(tokens[:len(tokens)-1]).Get(document)
+		_, inArray = parent.([]any)
+		inArray = inArray && err == nil
+	}
+	if rp.shifted {
+		if !inArray {
+			return nil, false, fmt.Errorf("jsonpatch: index manipulation requires an array element, '%s' is not one", tokens.String())
+		}
+		idx, err := jsonpointer.ParseArrayIndex(tokens[len(tokens)-1])
+		if err != nil {
+			return nil, false, fmt.Errorf("jsonpatch: index manipulation on '%s': %w", tokens.String(), err)
+		}
+		shifted := int(idx) + rp.shift
+		if shifted < 0 {
+			return nil, false, fmt.Errorf("jsonpatch: index manipulation on '%s' yields negative index %d", tokens.String(), shifted)
+		}
+		tokens[len(tokens)-1] = strconv.Itoa(shifted)
+	}
+	if len(rp.tail) > 0 {
+		inArray = false
+	}
+	return append(tokens, rp.tail...), inArray, nil
+}
+
+// resolveRelativeLocation resolves a Relative JSON Pointer against base into an
+// absolute JSON Pointer. The "#" form yields a key rather than a location and is rejected.
+func resolveRelativeLocation(document any, base, rel string) (string, error) {
+	rp, err := parseRelativePointer(rel)
+	if err != nil {
+		return "", err
+	}
+	if rp.keyOnly {
+		return "", fmt.Errorf("jsonpatch: relative pointer '%s' does not identify a location", rel)
+	}
+	tokens, _, err := rp.resolve(document, base)
+	if err != nil {
+		return "", err
+	}
+	return tokens.String(), nil
+}
+
+// GetRelative evaluates the Relative JSON Pointer rel against document, starting
+// from the location identified by the absolute JSON Pointer base. For the "#"
+// form it returns the member name (string) or array index (float64) of the
+// referenced location instead of its value.
+func GetRelative(document any, base, rel string) (any, error) {
+	rp, err := parseRelativePointer(rel)
+	if err != nil {
+		return nil, err
+	}
+	tokens, inArray, err := rp.resolve(document, base)
+	if err != nil {
+		return nil, err
+	}
+	if !rp.keyOnly {
+		return tokens.Get(document)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("jsonpatch: relative pointer '%s' has no key at the document root", rel)
+	}
+	if _, err := tokens.Get(document); err != nil {
+		return nil, err
+	}
+	key := tokens[len(tokens)-1]
+	if inArray {
+		idx, err := jsonpointer.ParseArrayIndex(key)
+		if err != nil {
+			return nil, err
+		}
+		return float64(idx), nil
+	}
+	return key, nil
+}
@@ -0,0 +1,124 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestGetRelative(t *testing.T) {
+	// Examples from draft-handrews-relative-json-pointer, section 5.1.
+	var doc any
+	json.Unmarshal([]byte(`{"foo":["bar","baz"],"highly":{"nested":{"objects":true}}}`), &doc)
+
+	testCases := []struct {
+		base     string
+		rel      string
+		expected any
+	}{
+		{"/foo/1", "0", "baz"},
+		{"/foo/1", "1/0", "bar"},
+		{"/foo/1", "0-1", "bar"},
+		{"/foo/1", "2/highly/nested/objects", true},
+		{"/foo/1", "0#", 1.0},
+		{"/foo/1", "0-1#", 0.0},
+		{"/foo/1", "1#", "foo"},
+		{"/highly/nested", "0/objects", true},
+		{"/highly/nested", "1/nested/objects", true},
+		{"/highly/nested", "2/foo/0", "bar"},
+		{"/highly/nested", "0#", "nested"},
+		{"/highly/nested", "1#", "highly"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.base+" "+tc.rel, func(t *testing.T) {
+			got, err := jsonpatch.GetRelative(doc, tc.base, tc.rel)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %#v, want %#v", got, tc.expected)
+			}
+		})
+	}
+
+	for _, rel := range []string{"", "01", "3", "0+", "0-01", "1-1", "0x", "2#"} {
+		if _, err := jsonpatch.GetRelative(doc, "/highly/nested", rel); err == nil {
+			t.Errorf("expected error for %q", rel)
+		}
+	}
+}
+
+func TestApplyRelativeFrom(t *testing.T) {
+	testCases := []struct {
+		name     string
+		doc      string
+		patch    string
+		opts     []jsonpatch.Option
+		expected string
+	}{
+		{
+			name:     "copy sibling member",
+			doc:      `{"user":{"name":"ann"}}`,
+			patch:    `[{"op":"copy","from":"1/name","path":"/user/display"}]`,
+			opts:     []jsonpatch.Option{jsonpatch.WithRelativePointers()},
+			expected: `{"user":{"name":"ann","display":"ann"}}`,
+		},
+		{
+			name:     "move previous array element",
+			doc:      `{"arr":["a","b","c"]}`,
+			patch:    `[{"op":"move","from":"0+1","path":"/arr/0"}]`,
+			opts:     []jsonpatch.Option{jsonpatch.WithRelativePointers()},
+			expected: `{"arr":["b","a","c"]}`,
+		},
+		{
+			name:     "template across expanded siblings",
+			doc:      `{"items":[{"name":"a"},{"name":"b"}]}`,
+			patch:    `[{"op":"copy","from":"1/name","path":"/items/*/label"}]`,
+			opts:     []jsonpatch.Option{jsonpatch.WithRelativePointers(), jsonpatch.WithPathExpansion()},
+			expected: `{"items":[{"name":"a","label":"a"},{"name":"b","label":"b"}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc, expected any
+			json.Unmarshal([]byte(tc.doc), &doc)
+			json.Unmarshal([]byte(tc.expected), &expected)
+			var patch jsonpatch.Patch
+			json.Unmarshal([]byte(tc.patch), &patch)
+
+			result, err := jsonpatch.Apply(doc, patch, tc.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, expected) {
+				resBytes, _ := json.Marshal(result)
+				t.Errorf("unexpected result\n\tgot: %s\n\twant: %s", resBytes, tc.expected)
+			}
+
+			diff, err := jsonpatch.Prepare(doc, patch, tc.opts...)
+			if err != nil {
+				t.Fatalf("Prepare failed: %v", err)
+			}
+			restored, err := diff.Revert(result)
+			if err != nil {
+				t.Fatalf("Revert failed: %v", err)
+			}
+			if !reflect.DeepEqual(restored, doc) {
+				t.Errorf("Revert did not restore original: %v", restored)
+			}
+		})
+	}
+
+	doc := map[string]any{"a": map[string]any{"b": 1.0}}
+	patch := jsonpatch.Patch{{Op: jsonpatch.Copy, From: "0#", Path: "/a/c"}}
+	if _, err := jsonpatch.Apply(doc, patch, jsonpatch.WithRelativePointers()); err == nil {
+		t.Error("expected '#' relative pointer to be rejected as a from location")
+	}
+	if _, err := jsonpatch.Apply(doc, jsonpatch.Patch{{Op: jsonpatch.Copy, From: "1/b", Path: "/a/c"}}); err == nil {
+		t.Error("expected relative from to be rejected without WithRelativePointers")
+	}
+}
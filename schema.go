@@ -0,0 +1,717 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema (draft 2020-12) supporting the core and
+// applicator keywords and the validation vocabulary. It validates documents in
+// encoding/json's representation. Format is treated as an annotation, and
+// unevaluatedItems and unevaluatedProperties are not supported.
+//
+// A Schema is immutable once compiled and safe for concurrent use.
+type Schema struct {
+	location string // keyword location of this schema, as a JSON Pointer
+	always   *bool  // set for the boolean schemas true and false
+
+	ref     string
+	refNode *Schema
+	base    *url.URL
+
+	types            []string
+	enum             []any
+	hasEnum          bool
+	constValue       any
+	hasConst         bool
+	multipleOf       *float64
+	maximum          *float64
+	exclusiveMaximum *float64
+	minimum          *float64
+	exclusiveMinimum *float64
+	maxLength        *int
+	minLength        *int
+	pattern          *regexp.Regexp
+	maxItems         *int
+	minItems         *int
+	uniqueItems      bool
+	maxContains      *int
+	minContains      *int
+	maxProperties    *int
+	minProperties    *int
+	required         []string
+	dependentReq     map[string][]string
+
+	allOf, anyOf, oneOf []*Schema
+	not                 *Schema
+	ifSchema            *Schema
+	thenSchema          *Schema
+	elseSchema          *Schema
+	dependentSchemas    map[string]*Schema
+	prefixItems         []*Schema
+	items               *Schema
+	contains            *Schema
+	properties          map[string]*Schema
+	patternProperties   []patternSchema
+	additionalProps     *Schema
+	propertyNames       *Schema
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *Schema
+}
+
+// SchemaError is a single JSON Schema validation failure.
+type SchemaError struct {
+	// InstancePath is the JSON Pointer of the invalid value in the document.
+	InstancePath string
+	// KeywordLocation is the JSON Pointer of the failing keyword in the schema.
+	KeywordLocation string
+	// Message describes the failure.
+	Message string
+
+	// focus is the location of a missing member the failure is about, if any.
+	focus string
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("'%s': %s", e.InstancePath, e.Message)
+}
+
+// CompileSchema compiles a JSON Schema given as []byte, json.RawMessage or a
+// value in encoding/json's representation.
+func CompileSchema(schema any) (*Schema, error) {
+	doc, err := normalizeJSONInput(schema)
+	if err != nil {
+		return nil, err
+	}
+	c := &schemaCompiler{index: make(map[string]*Schema)}
+	base, _ := url.Parse("urn:jsonpatch:root")
+	root, err := c.compile(doc, "", "", base)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range c.refs {
+		target, err := c.resolve(s.base, s.ref)
+		if err != nil {
+			return nil, fmt.Errorf("jsonpatch: schema at '%s': %w", s.location, err)
+		}
+		s.refNode = target
+	}
+	return root, nil
+}
+
+// Validate checks document against the schema and returns every failure.
+func (s *Schema) Validate(document any) []SchemaError {
+	v := &schemaValidator{}
+	v.validate(s, document, "")
+	return v.errors
+}
+
+type schemaCompiler struct {
+	index map[string]*Schema // absolute URI with fragment -> schema
+	refs  []*Schema
+}
+
+// compile compiles raw found at keyword location loc. rloc is the location
+// relative to the enclosing schema resource, whose URI is base.
+func (c *schemaCompiler) compile(raw any, loc, rloc string, base *url.URL) (*Schema, error) {
+	s := &Schema{location: loc}
+	m, isObject := raw.(map[string]any)
+	if isObject {
+		if id, ok := m["$id"].(string); ok {
+			u, err := base.Parse(id)
+			if err != nil {
+				return nil, fmt.Errorf("jsonpatch: schema at '%s': invalid $id: %w", loc, err)
+			}
+			base, rloc = u, ""
+		}
+	}
+	s.base = base
+	c.index[withoutFragment(base)+"#"+rloc] = s
+
+	switch v := raw.(type) {
+	case bool:
+		s.always = &v
+		return s, nil
+	case map[string]any:
+		return s, c.compileObject(s, v, loc, rloc, base)
+	default:
+		return nil, fmt.Errorf("jsonpatch: schema at '%s' must be an object or boolean", loc)
+	}
+}
+
+func (c *schemaCompiler) compileObject(s *Schema, m map[string]any, loc, rloc string, base *url.URL) error {
+	var err error
+	for _, kw := range []string{"$anchor", "$dynamicAnchor"} {
+		if anchor, ok := m[kw].(string); ok {
+			c.index[withoutFragment(base)+"#"+anchor] = s
+		}
+	}
+	// $dynamicRef is resolved statically, like $ref.
+	for _, kw := range []string{"$ref", "$dynamicRef"} {
+		if ref, ok := m[kw].(string); ok {
+			s.ref = ref
+			c.refs = append(c.refs, s)
+		}
+	}
+
+	at := func(suffix string) (string, string) {
+		return loc + "/" + suffix, rloc + "/" + suffix
+	}
+	sub := func(key string) (*Schema, error) {
+		raw, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		l, r := at(escapeToken(key))
+		return c.compile(raw, l, r, base)
+	}
+	subList := func(key string) ([]*Schema, error) {
+		raw, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		arr, ok := raw.([]any)
+		if !ok || len(arr) == 0 {
+			return nil, fmt.Errorf("jsonpatch: schema at '%s': %s must be a non-empty array", loc, key)
+		}
+		out := make([]*Schema, len(arr))
+		for i, e := range arr {
+			l, r := at(key + "/" + strconv.Itoa(i))
+			if out[i], err = c.compile(e, l, r, base); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	subMap := func(key string) (map[string]*Schema, error) {
+		raw, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("jsonpatch: schema at '%s': %s must be an object", loc, key)
+		}
+		out := make(map[string]*Schema, len(obj))
+		for name, e := range obj {
+			l, r := at(key + "/" + escapeToken(name))
+			if out[name], err = c.compile(e, l, r, base); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	if s.allOf, err = subList("allOf"); err != nil {
+		return err
+	}
+	if s.anyOf, err = subList("anyOf"); err != nil {
+		return err
+	}
+	if s.oneOf, err = subList("oneOf"); err != nil {
+		return err
+	}
+	if s.prefixItems, err = subList("prefixItems"); err != nil {
+		return err
+	}
+	for key, dst := range map[string]**Schema{
+		"not": &s.not, "if": &s.ifSchema, "then": &s.thenSchema, "else": &s.elseSchema,
+		"items": &s.items, "contains": &s.contains,
+		"additionalProperties": &s.additionalProps, "propertyNames": &s.propertyNames,
+	} {
+		if *dst, err = sub(key); err != nil {
+			return err
+		}
+	}
+	if s.properties, err = subMap("properties"); err != nil {
+		return err
+	}
+	if s.dependentSchemas, err = subMap("dependentSchemas"); err != nil {
+		return err
+	}
+	if _, err = subMap("$defs"); err != nil {
+		return err
+	}
+	if pp, err := subMap("patternProperties"); err != nil {
+		return err
+	} else if len(pp) > 0 {
+		keys := make([]string, 0, len(pp))
+		for k := range pp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			re, err := regexp.Compile(k)
+			if err != nil {
+				return fmt.Errorf("jsonpatch: schema at '%s': invalid pattern property %q: %w", loc, k, err)
+			}
+			s.patternProperties = append(s.patternProperties, patternSchema{re: re, schema: pp[k]})
+		}
+	}
+
+	if t, ok := m["type"]; ok {
+		switch tv := t.(type) {
+		case string:
+			s.types = []string{tv}
+		case []any:
+			for _, e := range tv {
+				name, ok := e.(string)
+				if !ok {
+					return fmt.Errorf("jsonpatch: schema at '%s': type entries must be strings", loc)
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return fmt.Errorf("jsonpatch: schema at '%s': type must be a string or array", loc)
+		}
+	}
+	if e, ok := m["enum"]; ok {
+		arr, ok := e.([]any)
+		if !ok {
+			return fmt.Errorf("jsonpatch: schema at '%s': enum must be an array", loc)
+		}
+		s.enum, s.hasEnum = arr, true
+	}
+	if cv, ok := m["const"]; ok {
+		s.constValue, s.hasConst = cv, true
+	}
+	for key, dst := range map[string]**float64{
+		"multipleOf": &s.multipleOf, "maximum": &s.maximum, "exclusiveMaximum": &s.exclusiveMaximum,
+		"minimum": &s.minimum, "exclusiveMinimum": &s.exclusiveMinimum,
+	} {
+		if raw, ok := m[key]; ok {
+			f, ok := toFloat(raw)
+			if !ok {
+				return fmt.Errorf("jsonpatch: schema at '%s': %s must be a number", loc, key)
+			}
+			*dst = &f
+		}
+	}
+	if s.multipleOf != nil && *s.multipleOf <= 0 {
+		return fmt.Errorf("jsonpatch: schema at '%s': multipleOf must be positive", loc)
+	}
+	for key, dst := range map[string]**int{
+		"maxLength": &s.maxLength, "minLength": &s.minLength, "maxItems": &s.maxItems, "minItems": &s.minItems,
+		"maxContains": &s.maxContains, "minContains": &s.minContains,
+		"maxProperties": &s.maxProperties, "minProperties": &s.minProperties,
+	} {
+		if raw, ok := m[key]; ok {
+			f, ok := toFloat(raw)
+			if !ok || f < 0 || f != math.Trunc(f) {
+				return fmt.Errorf("jsonpatch: schema at '%s': %s must be a non-negative integer", loc, key)
+			}
+			n := int(f)
+			*dst = &n
+		}
+	}
+	if p, ok := m["pattern"].(string); ok {
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			return fmt.Errorf("jsonpatch: schema at '%s': invalid pattern: %w", loc, err)
+		}
+	}
+	if u, ok := m["uniqueItems"].(bool); ok {
+		s.uniqueItems = u
+	}
+	if r, ok := m["required"]; ok {
+		if s.required, err = stringList(r); err != nil {
+			return fmt.Errorf("jsonpatch: schema at '%s': required: %w", loc, err)
+		}
+	}
+	if dr, ok := m["dependentRequired"].(map[string]any); ok {
+		s.dependentReq = make(map[string][]string, len(dr))
+		for k, v := range dr {
+			if s.dependentReq[k], err = stringList(v); err != nil {
+				return fmt.Errorf("jsonpatch: schema at '%s': dependentRequired: %w", loc, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *schemaCompiler) resolve(base *url.URL, ref string) (*Schema, error) {
+	u, err := base.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q: %w", ref, err)
+	}
+	if s, ok := c.index[withoutFragment(u)+"#"+u.Fragment]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unresolvable $ref %q", ref)
+}
+
+func withoutFragment(u *url.URL) string {
+	cp := *u
+	cp.Fragment = ""
+	cp.RawFragment = ""
+	return cp.String()
+}
+
+func stringList(v any) ([]string, error) {
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("must be an array of strings")
+	}
+	out := make([]string, len(arr))
+	for i, e := range arr {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be an array of strings")
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+type schemaValidator struct {
+	errors []SchemaError
+	depth  int
+}
+
+// maxSchemaDepth stops runaway $ref recursion on cyclic schemas.
+const maxSchemaDepth = 256
+
+func (v *schemaValidator) fail(s *Schema, keyword, path, format string, args ...any) {
+	v.errors = append(v.errors, SchemaError{
+		InstancePath:    path,
+		KeywordLocation: s.location + "/" + keyword,
+		Message:         fmt.Sprintf(format, args...),
+	})
+}
+
+// valid reports whether value validates against s without recording errors.
+func (v *schemaValidator) valid(s *Schema, value any, path string) bool {
+	sub := &schemaValidator{depth: v.depth}
+	sub.validate(s, value, path)
+	return len(sub.errors) == 0
+}
+
+func (v *schemaValidator) validate(s *Schema, value any, path string) {
+	if s.always != nil {
+		if !*s.always {
+			v.errors = append(v.errors, SchemaError{InstancePath: path, KeywordLocation: s.location, Message: "no value is allowed here"})
+		}
+		return
+	}
+	if s.refNode != nil {
+		v.depth++
+		if v.depth > maxSchemaDepth {
+			v.fail(s, "$ref", path, "schema reference depth exceeded")
+		} else {
+			v.validate(s.refNode, value, path)
+		}
+		v.depth--
+	}
+
+	if len(s.types) > 0 && !matchesAnyType(value, s.types) {
+		v.fail(s, "type", path, "expected %s, got %s", strings.Join(s.types, " or "), jsonTypeName(value))
+	}
+	if s.hasEnum {
+		found := false
+		for _, e := range s.enum {
+			if jsonEqual(value, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(s, "enum", path, "value is not one of the allowed values")
+		}
+	}
+	if s.hasConst && !jsonEqual(value, s.constValue) {
+		v.fail(s, "const", path, "value must equal the constant %v", s.constValue)
+	}
+
+	if n, ok := toFloat(value); ok {
+		v.validateNumber(s, n, path)
+	}
+	switch tv := value.(type) {
+	case string:
+		v.validateString(s, tv, path)
+	case []any:
+		v.validateArray(s, tv, path)
+	case map[string]any:
+		v.validateObject(s, tv, path)
+	}
+
+	for _, sub := range s.allOf {
+		v.validate(sub, value, path)
+	}
+	if len(s.anyOf) > 0 {
+		ok := false
+		for _, sub := range s.anyOf {
+			if v.valid(sub, value, path) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			v.fail(s, "anyOf", path, "value does not match any of the schemas")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if v.valid(sub, value, path) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.fail(s, "oneOf", path, "value matches %d of the schemas, expected exactly one", matches)
+		}
+	}
+	if s.not != nil && v.valid(s.not, value, path) {
+		v.fail(s, "not", path, "value must not match the schema")
+	}
+	if s.ifSchema != nil {
+		if v.valid(s.ifSchema, value, path) {
+			if s.thenSchema != nil {
+				v.validate(s.thenSchema, value, path)
+			}
+		} else if s.elseSchema != nil {
+			v.validate(s.elseSchema, value, path)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(s *Schema, n float64, path string) {
+	if s.multipleOf != nil {
+		q := n / *s.multipleOf
+		if math.IsInf(q, 0) || math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(s, "multipleOf", path, "%v is not a multiple of %v", n, *s.multipleOf)
+		}
+	}
+	if s.maximum != nil && n > *s.maximum {
+		v.fail(s, "maximum", path, "%v is greater than the maximum %v", n, *s.maximum)
+	}
+	if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+		v.fail(s, "exclusiveMaximum", path, "%v is not less than %v", n, *s.exclusiveMaximum)
+	}
+	if s.minimum != nil && n < *s.minimum {
+		v.fail(s, "minimum", path, "%v is less than the minimum %v", n, *s.minimum)
+	}
+	if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+		v.fail(s, "exclusiveMinimum", path, "%v is not greater than %v", n, *s.exclusiveMinimum)
+	}
+}
+
+func (v *schemaValidator) validateString(s *Schema, str string, path string) {
+	length := utf8.RuneCountInString(str)
+	if s.maxLength != nil && length > *s.maxLength {
+		v.fail(s, "maxLength", path, "string is longer than %d characters", *s.maxLength)
+	}
+	if s.minLength != nil && length < *s.minLength {
+		v.fail(s, "minLength", path, "string is shorter than %d characters", *s.minLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		v.fail(s, "pattern", path, "string does not match pattern %q", s.pattern.String())
+	}
+}
+
+func (v *schemaValidator) validateArray(s *Schema, arr []any, path string) {
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		v.fail(s, "maxItems", path, "array has more than %d items", *s.maxItems)
+	}
+	if s.minItems != nil && len(arr) < *s.minItems {
+		v.fail(s, "minItems", path, "array has fewer than %d items", *s.minItems)
+	}
+	if s.uniqueItems {
+		for i := 1; i < len(arr); i++ {
+			for j := 0; j < i; j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					v.fail(s, "uniqueItems", path, "items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+	for i, sub := range s.prefixItems {
+		if i >= len(arr) {
+			break
+		}
+		v.validate(sub, arr[i], joinPath(path, strconv.Itoa(i)))
+	}
+	if s.items != nil {
+		for i := len(s.prefixItems); i < len(arr); i++ {
+			v.validate(s.items, arr[i], joinPath(path, strconv.Itoa(i)))
+		}
+	}
+	if s.contains != nil {
+		count := 0
+		for i, e := range arr {
+			if v.valid(s.contains, e, joinPath(path, strconv.Itoa(i))) {
+				count++
+			}
+		}
+		minContains := 1
+		if s.minContains != nil {
+			minContains = *s.minContains
+		}
+		if count < minContains {
+			v.fail(s, "contains", path, "array contains %d matching items, expected at least %d", count, minContains)
+		}
+		if s.maxContains != nil && count > *s.maxContains {
+			v.fail(s, "maxContains", path, "array contains %d matching items, expected at most %d", count, *s.maxContains)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(s *Schema, obj map[string]any, path string) {
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		v.fail(s, "maxProperties", path, "object has more than %d properties", *s.maxProperties)
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		v.fail(s, "minProperties", path, "object has fewer than %d properties", *s.minProperties)
+	}
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			v.fail(s, "required", path, "missing required property %q", name)
+			v.errors[len(v.errors)-1].focus = joinPath(path, name)
+		}
+	}
+	for name, deps := range s.dependentReq {
+		if _, ok := obj[name]; !ok {
+			continue
+		}
+		for _, d := range deps {
+			if _, ok := obj[d]; !ok {
+				v.fail(s, "dependentRequired", path, "property %q requires property %q", name, d)
+				v.errors[len(v.errors)-1].focus = joinPath(path, d)
+			}
+		}
+	}
+	for name, sub := range s.dependentSchemas {
+		if _, ok := obj[name]; ok {
+			v.validate(sub, obj, path)
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := joinPath(path, k)
+		if s.propertyNames != nil && !v.valid(s.propertyNames, k, child) {
+			v.fail(s, "propertyNames", child, "property name %q is not allowed", k)
+		}
+		matched := false
+		if sub, ok := s.properties[k]; ok {
+			matched = true
+			v.validate(sub, obj[k], child)
+		}
+		for _, pp := range s.patternProperties {
+			if pp.re.MatchString(k) {
+				matched = true
+				v.validate(pp.schema, obj[k], child)
+			}
+		}
+		if !matched && s.additionalProps != nil {
+			if s.additionalProps.always != nil && !*s.additionalProps.always {
+				v.fail(s, "additionalProperties", child, "additional property %q is not allowed", k)
+				continue
+			}
+			v.validate(s.additionalProps, obj[k], child)
+		}
+	}
+}
+
+func matchesAnyType(value any, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := toFloat(value); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := toFloat(value); ok && f == math.Trunc(f) && !math.IsInf(f, 0) {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]any); ok {
+				return true
+			}
+		case "object":
+			if _, ok := value.(map[string]any); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	if f, ok := toFloat(value); ok {
+		if f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual compares JSON values structurally, comparing numbers by value.
+func jsonEqual(a, b any) bool {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, e := range av {
+			other, ok := bv[k]
+			if !ok || !jsonEqual(e, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
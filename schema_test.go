@@ -0,0 +1,118 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		instance string
+		valid    bool
+	}{
+		{"true schema", `true`, `{"a":1}`, true},
+		{"false schema", `false`, `1`, false},
+		{"type string", `{"type":"string"}`, `"x"`, true},
+		{"type mismatch", `{"type":"string"}`, `1`, false},
+		{"type integer", `{"type":"integer"}`, `1.0`, true},
+		{"type integer fraction", `{"type":"integer"}`, `1.5`, false},
+		{"type list", `{"type":["string","null"]}`, `null`, true},
+		{"enum", `{"enum":[1,"a",{"b":[2]}]}`, `{"b":[2.0]}`, true},
+		{"enum miss", `{"enum":[1,"a"]}`, `"b"`, false},
+		{"const", `{"const":{"a":1}}`, `{"a":1}`, true},
+		{"multipleOf", `{"multipleOf":0.5}`, `2.5`, true},
+		{"multipleOf miss", `{"multipleOf":2}`, `3`, false},
+		{"maximum", `{"maximum":3}`, `3`, true},
+		{"exclusiveMaximum", `{"exclusiveMaximum":3}`, `3`, false},
+		{"minimum", `{"minimum":3}`, `2`, false},
+		{"exclusiveMinimum", `{"exclusiveMinimum":3}`, `3.1`, true},
+		{"maxLength counts runes", `{"maxLength":2}`, `"éé"`, true},
+		{"minLength", `{"minLength":2}`, `"a"`, false},
+		{"pattern", `{"pattern":"^a+$"}`, `"aab"`, false},
+		{"maxItems", `{"maxItems":1}`, `[1,2]`, false},
+		{"minItems", `{"minItems":1}`, `[]`, false},
+		{"uniqueItems", `{"uniqueItems":true}`, `[1,{"a":1},{"a":1.0}]`, false},
+		{"prefixItems and items", `{"prefixItems":[{"type":"string"}],"items":{"type":"number"}}`, `["a",1,2]`, true},
+		{"items false", `{"prefixItems":[true],"items":false}`, `[1,2]`, false},
+		{"contains", `{"contains":{"type":"string"}}`, `[1,"a"]`, true},
+		{"contains none", `{"contains":{"type":"string"}}`, `[1,2]`, false},
+		{"minContains zero", `{"contains":{"type":"string"},"minContains":0}`, `[1]`, true},
+		{"maxContains", `{"contains":{"type":"string"},"maxContains":1}`, `["a","b"]`, false},
+		{"required", `{"required":["a"]}`, `{"b":1}`, false},
+		{"required ignores non-objects", `{"required":["a"]}`, `1`, true},
+		{"maxProperties", `{"maxProperties":1}`, `{"a":1,"b":2}`, false},
+		{"minProperties", `{"minProperties":1}`, `{}`, false},
+		{"dependentRequired", `{"dependentRequired":{"a":["b"]}}`, `{"a":1}`, false},
+		{"dependentSchemas", `{"dependentSchemas":{"a":{"required":["b"]}}}`, `{"a":1,"b":2}`, true},
+		{"properties", `{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, false},
+		{"patternProperties", `{"patternProperties":{"^x-":{"type":"string"}}}`, `{"x-a":1}`, false},
+		{"additionalProperties false", `{"properties":{"a":true},"additionalProperties":false}`, `{"a":1,"b":2}`, false},
+		{"additionalProperties schema", `{"patternProperties":{"^x":true},"additionalProperties":{"type":"string"}}`, `{"x1":1,"b":"s"}`, true},
+		{"propertyNames", `{"propertyNames":{"maxLength":2}}`, `{"abc":1}`, false},
+		{"allOf", `{"allOf":[{"type":"number"},{"minimum":2}]}`, `1`, false},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"minimum":2}]}`, `3`, true},
+		{"oneOf both", `{"oneOf":[{"type":"number"},{"minimum":2}]}`, `3`, false},
+		{"not", `{"not":{"type":"null"}}`, `null`, false},
+		{"if then", `{"if":{"properties":{"a":{"const":1}}},"then":{"required":["b"]},"else":{"required":["c"]}}`, `{"a":1,"c":1}`, false},
+		{"if else", `{"if":{"properties":{"a":{"const":1}}},"then":{"required":["b"]},"else":{"required":["c"]}}`, `{"a":2,"c":1}`, true},
+		{"ref defs", `{"$defs":{"pos":{"minimum":0}},"properties":{"n":{"$ref":"#/$defs/pos"}}}`, `{"n":-1}`, false},
+		{"ref anchor", `{"$defs":{"s":{"$anchor":"str","type":"string"}},"items":{"$ref":"#str"}}`, `["a",1]`, false},
+		{"ref recursive", `{"type":"object","properties":{"child":{"$ref":"#"}},"required":["id"]}`, `{"id":1,"child":{"id":2,"child":{}}}`, false},
+		{"ref embedded id", `{"$id":"https://example.com/root","$defs":{"x":{"$id":"x.json","type":"string"}},"items":{"$ref":"x.json"}}`, `["a"]`, true},
+		{"ref escaped pointer", `{"$defs":{"a/b":{"type":"string"}},"$ref":"#/$defs/a~1b"}`, `1`, false},
+		{"format is an annotation", `{"format":"email"}`, `"nope"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := jsonpatch.CompileSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("CompileSchema: %v", err)
+			}
+			var instance any
+			if err := json.Unmarshal([]byte(tt.instance), &instance); err != nil {
+				t.Fatal(err)
+			}
+			errs := s.Validate(instance)
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Fatalf("valid = %v, want %v (errors: %v)", valid, tt.valid, errs)
+			}
+		})
+	}
+}
+
+func TestSchemaErrorLocations(t *testing.T) {
+	s, err := jsonpatch.CompileSchema([]byte(`{"properties":{"items":{"type":"array","items":{"type":"integer"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := s.Validate(map[string]any{"items": []any{1.0, "two"}})
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1: %v", len(errs), errs)
+	}
+	if errs[0].InstancePath != "/items/1" {
+		t.Errorf("InstancePath = %q, want /items/1", errs[0].InstancePath)
+	}
+	if errs[0].KeywordLocation != "/properties/items/items/type" {
+		t.Errorf("KeywordLocation = %q, want /properties/items/items/type", errs[0].KeywordLocation)
+	}
+}
+
+func TestCompileSchemaErrors(t *testing.T) {
+	for _, schema := range []string{
+		`1`,
+		`{"type":1}`,
+		`{"allOf":[]}`,
+		`{"minLength":-1}`,
+		`{"pattern":"("}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"properties":{"a":"b"}}`,
+	} {
+		if _, err := jsonpatch.CompileSchema([]byte(schema)); err == nil {
+			t.Errorf("CompileSchema(%s) succeeded, want error", schema)
+		}
+	}
+}
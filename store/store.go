@@ -0,0 +1,257 @@
+// Package store keeps a JSON document together with a version counter and an
+// append-only log of the patches applied to it. It supports optimistic
+// concurrency, reconstruction of past versions and catch-up patches for
+// clients that lag behind.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+// ErrVersionConflict is matched by errors.Is for every *ConflictError.
+var ErrVersionConflict = errors.New("store: version conflict")
+
+// ErrUnknownVersion is returned for versions the store does not have.
+var ErrUnknownVersion = errors.New("store: unknown version")
+
+// ConflictError reports that a patch was based on an outdated version.
+type ConflictError struct {
+	Expected uint64
+	Current  uint64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("store: version conflict: expected version %d, current version is %d", e.Expected, e.Current)
+}
+
+// Is makes errors.Is(err, ErrVersionConflict) report true.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// Entry is one applied patch in the log of a Store.
+type Entry struct {
+	// Version is the version the patch produced.
+	Version uint64
+	// Patch is the patch as it was applied.
+	Patch jsonpatch.Patch
+	// Diff holds the concrete deltas of the patch.
+	Diff jsonpatch.Diff
+	// Time is when the patch was applied.
+	Time time.Time
+}
+
+type snapshot struct {
+	version uint64
+	doc     any
+}
+
+// Store is a versioned JSON document. Version 0 is the document the store was
+// created with, and each successful Apply increments the version by one.
+//
+// A Store is safe for concurrent use. Documents it returns are never modified
+// by the store, so readers always see a consistent version.
+type Store struct {
+	mu        sync.RWMutex
+	doc       any
+	version   uint64
+	base      uint64     // oldest version kept, see Compact
+	log       []Entry    // entries of the versions after base
+	snapshots []snapshot // ascending by version, starting at base
+	every     int
+	opts      []jsonpatch.Option
+	now       func() time.Time
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithSnapshotEvery keeps a copy of the document every n versions, bounding
+// the number of log entries At has to replay. The default is 100; n <= 0
+// keeps no snapshot besides the document the store was created with, or the
+// one Compact kept.
+func WithSnapshotEvery(n int) Option {
+	return func(s *Store) {
+		s.every = n
+	}
+}
+
+// WithPatchOptions sets options, such as jsonpatch.WithLimits, used whenever
+// the store applies a patch.
+func WithPatchOptions(opts ...jsonpatch.Option) Option {
+	return func(s *Store) {
+		s.opts = append(s.opts, opts...)
+	}
+}
+
+// New returns a store holding a copy of document at version 0.
+func New(document any, opts ...Option) (*Store, error) {
+	doc, err := jsonpatch.Apply(document, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{doc: doc, every: 100, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.snapshots = []snapshot{{version: 0, doc: doc}}
+	return s, nil
+}
+
+// Document returns the current document and its version. The document is
+// shared with the store and other readers and must not be modified.
+func (s *Store) Document() (any, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.doc, s.version
+}
+
+// Version returns the current version.
+func (s *Store) Version() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// Apply applies patch to the current document if it is still at
+// expectedVersion and returns the new version. Otherwise it returns a
+// *ConflictError and leaves the store unchanged, as it does when the patch
+// fails.
+func (s *Store) Apply(patch jsonpatch.Patch, expectedVersion uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expectedVersion != s.version {
+		return s.version, &ConflictError{Expected: expectedVersion, Current: s.version}
+	}
+	doc, diff, err := jsonpatch.ApplyWithDiff(s.doc, patch, s.opts...)
+	if err != nil {
+		return s.version, err
+	}
+	s.version++
+	s.doc = doc
+	s.log = append(s.log, Entry{Version: s.version, Patch: patch.Clone(), Diff: diff, Time: s.now()})
+	if s.every > 0 && s.version%uint64(s.every) == 0 {
+		s.snapshots = append(s.snapshots, snapshot{version: s.version, doc: doc})
+	}
+	return s.version, nil
+}
+
+// At returns a copy of the document as it was at version, reconstructed from
+// the nearest snapshot by replaying or reverting logged diffs.
+func (s *Store) At(version uint64) (any, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.check(version); err != nil {
+		return nil, err
+	}
+	return s.at(version)
+}
+
+func (s *Store) at(version uint64) (any, error) {
+	// Candidates are the last snapshot at or before version, the first one
+	// after it, and the current document.
+	i := sort.Search(len(s.snapshots), func(i int) bool { return s.snapshots[i].version > version })
+	below := s.snapshots[i-1]
+	above := snapshot{version: s.version, doc: s.doc}
+	if i < len(s.snapshots) {
+		above = s.snapshots[i]
+	}
+
+	var patch jsonpatch.Patch
+	base := below.doc
+	if above.version-version < version-below.version {
+		base = above.doc
+		for v := above.version; v > version; v-- {
+			patch = append(patch, s.entry(v).Diff.Reverse()...)
+		}
+	} else {
+		for v := below.version + 1; v <= version; v++ {
+			patch = append(patch, s.entry(v).Diff.Forward()...)
+		}
+	}
+	return jsonpatch.Apply(base, patch)
+}
+
+// Since returns the concrete patch that brings a document at version up to
+// the current version, together with the current version.
+func (s *Store) Since(version uint64) (jsonpatch.Patch, uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.check(version); err != nil {
+		return nil, s.version, err
+	}
+	patch := jsonpatch.Patch{}
+	for v := version + 1; v <= s.version; v++ {
+		patch = append(patch, s.entry(v).Diff.Forward()...)
+	}
+	return patch, s.version, nil
+}
+
+// Entries returns copies of the log entries after version, oldest first.
+// Entries removed by Compact are not returned.
+func (s *Store) Entries(since uint64) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if since >= s.version {
+		return nil
+	}
+	since = max(since, s.base)
+	entries := make([]Entry, 0, s.version-since)
+	for _, e := range s.log[since-s.base:] {
+		e.Patch = e.Patch.Clone()
+		e.Diff = e.Diff.Clone()
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Compact discards the log entries and snapshots of the versions before
+// version, keeping a snapshot of the document at version, so the memory held
+// by the store no longer grows with its whole history. Afterwards At and
+// Since return ErrUnknownVersion for the discarded versions.
+func (s *Store) Compact(version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(version); err != nil {
+		return err
+	}
+	if version == s.base {
+		return nil
+	}
+	doc, err := s.at(version)
+	if err != nil {
+		return err
+	}
+	snapshots := []snapshot{{version: version, doc: doc}}
+	for _, snap := range s.snapshots {
+		if snap.version > version {
+			snapshots = append(snapshots, snap)
+		}
+	}
+	s.snapshots = snapshots
+	s.log = append([]Entry(nil), s.log[version-s.base:]...)
+	s.base = version
+	return nil
+}
+
+// check returns ErrUnknownVersion if the store does not have version.
+func (s *Store) check(version uint64) error {
+	switch {
+	case version > s.version:
+		return fmt.Errorf("%w: %d is newer than the current version %d", ErrUnknownVersion, version, s.version)
+	case version < s.base:
+		return fmt.Errorf("%w: %d was compacted, the oldest version is %d", ErrUnknownVersion, version, s.base)
+	}
+	return nil
+}
+
+// entry returns the log entry that produced version v, which must be after base.
+func (s *Store) entry(v uint64) *Entry {
+	return &s.log[v-1-s.base]
+}
@@ -0,0 +1,243 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+	"github.com/agentflare-ai/go-jsonpatch/store"
+)
+
+func TestStoreApply(t *testing.T) {
+	s, err := store.New(map[string]any{"n": 0.0, "items": []any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.Apply(jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/items/-", Value: "a"}}, 0)
+	if err != nil || v != 1 {
+		t.Fatalf("Apply = %d, %v", v, err)
+	}
+
+	_, err = s.Apply(jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/n", Value: 1.0}}, 0)
+	var cerr *store.ConflictError
+	if !errors.As(err, &cerr) || cerr.Current != 1 || !errors.Is(err, store.ErrVersionConflict) {
+		t.Fatalf("stale Apply error = %v, want conflict at version 1", err)
+	}
+
+	if _, err := s.Apply(jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/missing"}}, 1); err == nil {
+		t.Fatal("failing patch was applied")
+	}
+	doc, v := s.Document()
+	if want := map[string]any{"n": 0.0, "items": []any{"a"}}; v != 1 || !reflect.DeepEqual(doc, want) {
+		t.Fatalf("Document = %v at %d, want %v at 1", doc, v, want)
+	}
+	if entries := s.Entries(0); len(entries) != 1 || entries[0].Version != 1 || entries[0].Time.IsZero() {
+		t.Fatalf("Entries = %+v", entries)
+	}
+}
+
+func TestStoreEntriesAreCopies(t *testing.T) {
+	s, err := store.New(map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/m", Value: map[string]any{"k": "v"}}}
+	if _, err := s.Apply(patch, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Neither the caller's patch nor the entries handed out share values
+	// with the log.
+	patch[0].Value.(map[string]any)["k"] = "caller"
+	entries := s.Entries(0)
+	entries[0].Patch[0].Value.(map[string]any)["k"] = "patch"
+	entries[0].Diff.Deltas[0].After.(map[string]any)["k"] = "delta"
+
+	e := s.Entries(0)[0]
+	if got := e.Patch[0].Value.(map[string]any)["k"]; got != "v" {
+		t.Fatalf("logged patch value = %v, want v", got)
+	}
+	if got := e.Diff.Deltas[0].After.(map[string]any)["k"]; got != "v" {
+		t.Fatalf("logged delta value = %v, want v", got)
+	}
+	since, _, err := s.Since(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := since[0].Value.(map[string]any)["k"]; got != "v" {
+		t.Fatalf("Since value = %v, want v", got)
+	}
+}
+
+func TestStoreAtAndSince(t *testing.T) {
+	s, err := store.New(map[string]any{"items": []any{}}, store.WithSnapshotEvery(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := []any{map[string]any{"items": []any{}}}
+	for i := 1; i <= 10; i++ {
+		patch := jsonpatch.Patch{
+			{Op: jsonpatch.Add, Path: "/items/0", Value: float64(i)},
+			{Op: jsonpatch.Replace, Path: "/last", Value: float64(i)},
+		}
+		if i == 1 {
+			patch[1].Op = jsonpatch.Add
+		}
+		if i%3 == 0 {
+			patch = append(patch, jsonpatch.Operation{Op: jsonpatch.Remove, Path: "/items/1"})
+		}
+		if _, err := s.Apply(patch, uint64(i-1)); err != nil {
+			t.Fatalf("Apply %d: %v", i, err)
+		}
+		doc, _ := s.Document()
+		history = append(history, doc)
+	}
+
+	for v, want := range history {
+		got, err := s.At(uint64(v))
+		if err != nil {
+			t.Fatalf("At(%d): %v", v, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("At(%d) = %v, want %v", v, got, want)
+		}
+
+		patch, current, err := s.Since(uint64(v))
+		if err != nil || current != 10 {
+			t.Fatalf("Since(%d) = %d, %v", v, current, err)
+		}
+		caughtUp, err := jsonpatch.Apply(want, patch)
+		if err != nil {
+			t.Fatalf("applying Since(%d): %v", v, err)
+		}
+		if !reflect.DeepEqual(caughtUp, history[10]) {
+			t.Errorf("Since(%d) led to %v, want %v", v, caughtUp, history[10])
+		}
+	}
+
+	if _, err := s.At(11); !errors.Is(err, store.ErrUnknownVersion) {
+		t.Fatalf("At(11) error = %v", err)
+	}
+}
+
+// applyAll applies each patch in turn and returns the document at every version.
+func applyAll(t *testing.T, s *store.Store, patches ...jsonpatch.Patch) []any {
+	t.Helper()
+	doc, _ := s.Document()
+	history := []any{doc}
+	for i, patch := range patches {
+		if _, err := s.Apply(patch, uint64(i)); err != nil {
+			t.Fatalf("Apply %d: %v", i+1, err)
+		}
+		doc, _ := s.Document()
+		history = append(history, doc)
+	}
+	return history
+}
+
+func TestStoreAtCopyIntoArray(t *testing.T) {
+	s, err := store.New(map[string]any{"a": "X", "n": 0.0, "arr": []any{"A", "B"}}, store.WithSnapshotEvery(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patches []jsonpatch.Patch
+	for i := 1; i <= 4; i++ {
+		patches = append(patches, jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/n", Value: float64(i)}})
+	}
+	patches = append(patches,
+		jsonpatch.Patch{{Op: jsonpatch.Copy, From: "/a", Path: "/arr/0"}},
+		jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/a", Value: "Y"}},
+	)
+	history := applyAll(t, s, patches...)
+
+	// Version 4 is closer to the current version 6, so At reverts the copy.
+	got, err := s.At(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, history[4]) {
+		t.Fatalf("At(4) = %v, want %v", got, history[4])
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	s, err := store.New(map[string]any{"items": []any{}}, store.WithSnapshotEvery(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patches []jsonpatch.Patch
+	for i := 1; i <= 5; i++ {
+		patches = append(patches, jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/items/0", Value: float64(i)}})
+	}
+	history := applyAll(t, s, patches...)
+
+	if err := s.Compact(3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.At(2); !errors.Is(err, store.ErrUnknownVersion) {
+		t.Fatalf("At(2) after Compact(3) error = %v", err)
+	}
+	if _, _, err := s.Since(2); !errors.Is(err, store.ErrUnknownVersion) {
+		t.Fatalf("Since(2) after Compact(3) error = %v", err)
+	}
+	for v := 3; v <= 5; v++ {
+		got, err := s.At(uint64(v))
+		if err != nil || !reflect.DeepEqual(got, history[v]) {
+			t.Errorf("At(%d) = %v, %v, want %v", v, got, err, history[v])
+		}
+	}
+	if entries := s.Entries(0); len(entries) != 2 || entries[0].Version != 4 {
+		t.Fatalf("Entries(0) = %+v, want versions 4 and 5", entries)
+	}
+	if _, err := s.Apply(patches[0], 5); err != nil {
+		t.Fatalf("Apply after Compact: %v", err)
+	}
+}
+
+func TestStoreConcurrent(t *testing.T) {
+	s, err := store.New(map[string]any{"n": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for applied := 0; applied < 25; {
+				doc, v := s.Document()
+				n := doc.(map[string]any)["n"].(float64)
+				_, err := s.Apply(jsonpatch.Patch{
+					{Op: jsonpatch.Test, Path: "/n", Value: n},
+					{Op: jsonpatch.Replace, Path: "/n", Value: n + 1},
+				}, v)
+				if errors.Is(err, store.ErrVersionConflict) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				applied++
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				doc, v := s.Document()
+				if got := doc.(map[string]any)["n"]; got != float64(v) {
+					t.Errorf("version %d has n = %v", v, got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	doc, v := s.Document()
+	if v != 100 || fmt.Sprint(doc) != "map[n:100]" {
+		t.Fatalf("final document %v at version %d", doc, v)
+	}
+}
@@ -0,0 +1,107 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// FieldError reports that a patched document could not be decoded back into
+// the Go type it was derived from.
+type FieldError struct {
+	// Struct is the name of the outermost struct type being decoded.
+	Struct string
+	// Field is the dotted path of JSON names from the root to the field, e.g. "address.zip".
+	Field string
+	// Value describes the JSON value that did not fit, e.g. "string" or "number 1.5".
+	Value string
+	// Type is the Go type of the field.
+	Type reflect.Type
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("jsonpatch: cannot decode %s into %s", e.Value, e.Type)
+	}
+	return fmt.Sprintf("jsonpatch: cannot decode %s into field %s.%s of type %s", e.Value, e.Struct, e.Field, e.Type)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyTo applies patch to the JSON representation of v, as defined by its
+// json struct tags, and decodes the result into a new T. v is not modified.
+func ApplyTo[T any](v T, patch Patch, opts ...Option) (T, error) {
+	var out T
+	doc, err := toDocument(v)
+	if err != nil {
+		return out, err
+	}
+	// doc is a private copy, so it can be patched in place.
+	doc, err = applyInPlace(doc, patch, newOptions(opts))
+	if err != nil {
+		return out, err
+	}
+	err = fromDocument(doc, &out)
+	return out, err
+}
+
+// ApplyToPtr is like ApplyTo but stores the result in *v. On error *v is left
+// unchanged. Fields that have no JSON representation are reset to their zero value.
+func ApplyToPtr[T any](v *T, patch Patch, opts ...Option) error {
+	if v == nil {
+		return errors.New("jsonpatch: ApplyToPtr called with nil pointer")
+	}
+	out, err := ApplyTo(*v, patch, opts...)
+	if err != nil {
+		return err
+	}
+	*v = out
+	return nil
+}
+
+// NewFrom generates a patch that transforms the JSON representation of a into
+// that of b.
+func NewFrom[T any](a, b T) (Patch, error) {
+	docA, err := toDocument(a)
+	if err != nil {
+		return nil, err
+	}
+	docB, err := toDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	return New(docA, docB)
+}
+
+// toDocument converts v into encoding/json's generic representation.
+func toDocument(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("jsonpatch: encode %T: %w", v, err)
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("jsonpatch: decode %T: %w", v, err)
+	}
+	return doc, nil
+}
+
+// fromDocument decodes doc into out, reporting type mismatches as *FieldError.
+func fromDocument(doc any, out any) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("jsonpatch: encode patched document: %w", err)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return &FieldError{Struct: typeErr.Struct, Field: typeErr.Field, Value: typeErr.Value, Type: typeErr.Type, Err: err}
+		}
+		return fmt.Errorf("jsonpatch: decode patched document into %T: %w", out, err)
+	}
+	return nil
+}
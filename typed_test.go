@@ -0,0 +1,96 @@
+package jsonpatch_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+type testAddress struct {
+	Street string `json:"street"`
+	Zip    int    `json:"zip"`
+}
+
+type testPerson struct {
+	Name    string       `json:"name"`
+	Age     int          `json:"age,omitempty"`
+	Tags    []string     `json:"tags"`
+	Address *testAddress `json:"address,omitempty"`
+	Secret  string       `json:"-"`
+}
+
+func TestApplyTo(t *testing.T) {
+	in := testPerson{Name: "Ann", Age: 30, Tags: []string{"a"}, Address: &testAddress{Street: "Main", Zip: 1}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/name", Value: "Bea"},
+		{Op: jsonpatch.Add, Path: "/tags/-", Value: "b"},
+		{Op: jsonpatch.Replace, Path: "/address/zip", Value: 2.0},
+	}
+	out, err := jsonpatch.ApplyTo(in, patch)
+	if err != nil {
+		t.Fatalf("ApplyTo: %v", err)
+	}
+	want := testPerson{Name: "Bea", Age: 30, Tags: []string{"a", "b"}, Address: &testAddress{Street: "Main", Zip: 2}}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("got %+v, want %+v", out, want)
+	}
+	if in.Name != "Ann" || len(in.Tags) != 1 || in.Address.Zip != 1 {
+		t.Fatalf("input was modified: %+v", in)
+	}
+}
+
+func TestApplyToFieldError(t *testing.T) {
+	in := testPerson{Name: "Ann", Address: &testAddress{Zip: 1}}
+	_, err := jsonpatch.ApplyTo(in, jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/address/zip", Value: "x"}})
+	var ferr *jsonpatch.FieldError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("error = %v, want *FieldError", err)
+	}
+	if ferr.Struct != "testPerson" || ferr.Field != "address.zip" || ferr.Type.Kind() != reflect.Int {
+		t.Fatalf("FieldError = %+v", ferr)
+	}
+	if got, want := err.Error(), "jsonpatch: cannot decode string into field testPerson.address.zip of type int"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestApplyToPtr(t *testing.T) {
+	p := &testPerson{Name: "Ann", Secret: "s"}
+	if err := jsonpatch.ApplyToPtr(p, jsonpatch.Patch{{Op: jsonpatch.Add, Path: "/age", Value: 5.0}}); err != nil {
+		t.Fatalf("ApplyToPtr: %v", err)
+	}
+	if p.Age != 5 || p.Secret != "" {
+		t.Fatalf("got %+v", p)
+	}
+
+	before := *p
+	err := jsonpatch.ApplyToPtr(p, jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/name", Value: "Bea"},
+		{Op: jsonpatch.Remove, Path: "/missing"},
+	})
+	var perr *jsonpatch.Error
+	if !errors.As(err, &perr) || perr.Index != 1 {
+		t.Fatalf("error = %v, want *Error at index 1", err)
+	}
+	if !reflect.DeepEqual(*p, before) {
+		t.Fatalf("failed patch modified value: %+v", p)
+	}
+}
+
+func TestNewFrom(t *testing.T) {
+	a := testPerson{Name: "Ann", Tags: []string{"a"}}
+	b := testPerson{Name: "Ann", Age: 3, Tags: []string{"a", "b"}}
+	patch, err := jsonpatch.NewFrom(a, b)
+	if err != nil {
+		t.Fatalf("NewFrom: %v", err)
+	}
+	got, err := jsonpatch.ApplyTo(a, patch)
+	if err != nil {
+		t.Fatalf("ApplyTo: %v", err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Fatalf("round trip = %+v, want %+v", got, b)
+	}
+}
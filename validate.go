@@ -0,0 +1,114 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// SchemaViolation is a schema failure of a patched document, attributed to the
+// patch operation that introduced it.
+type SchemaViolation struct {
+	SchemaError
+	// Index is the position in the patch of the last operation that changed the
+	// invalid value, one of its ancestors or one of its descendants, or -1 when
+	// the patch did not touch it.
+	Index int
+	// Op is the operation at Index; it is the zero Operation when Index is -1.
+	Op Operation
+}
+
+func (v SchemaViolation) String() string {
+	if v.Index < 0 {
+		return v.SchemaError.Error()
+	}
+	return fmt.Sprintf("operation %d (%s '%s'): %s", v.Index, v.Op.Op, v.Op.Path, v.SchemaError.Error())
+}
+
+// ValidationError is returned by ApplyValidated when the patched document does
+// not satisfy the schema.
+type ValidationError struct {
+	Violations []SchemaViolation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.String()
+	}
+	return "jsonpatch: schema validation failed: " + strings.Join(parts, "; ")
+}
+
+// ApplyValidated applies patch to a copy of document and validates the result
+// against schema. If validation fails it returns a *ValidationError that maps
+// each failure to the operation that caused it, and document is left untouched.
+func ApplyValidated(document any, patch Patch, schema *Schema, opts ...Option) (any, error) {
+	result, diff, err := prepare(document, patch, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	errs := schema.Validate(result)
+	if len(errs) == 0 {
+		return result, nil
+	}
+	violations := make([]SchemaViolation, len(errs))
+	for i, e := range errs {
+		index := -1
+		if e.focus != "" {
+			index = lastTouching(result, diff, e.focus)
+		}
+		if index < 0 {
+			index = lastTouching(result, diff, e.InstancePath)
+		}
+		violations[i] = SchemaViolation{SchemaError: e, Index: index}
+		if index >= 0 {
+			violations[i].Op = patch[index]
+		}
+	}
+	return nil, &ValidationError{Violations: violations}
+}
+
+// lastTouching returns the operation index of the last delta at path, above it
+// or below it, or -1 if there is none. path locates a value of result, the
+// patched document; walking back through the deltas, it is rebased over every
+// element inserted into or removed from an array above it, the way Revert
+// undoes them.
+func lastTouching(result any, diff Diff, path string) int {
+	tokens, err := jsonpointer.New(path)
+	if err != nil {
+		return -1
+	}
+	tokens = append(jsonpointer.Pointer{}, tokens...)
+	doc := cloneValue(result)
+	for i := len(diff.Deltas) - 1; i >= 0; i-- {
+		d := diff.Deltas[i]
+		if pathsOverlap(d.Path, tokens.String()) {
+			return d.Index
+		}
+		if at, err := jsonpointer.New(d.Path); err == nil && len(at) > 0 && len(at) <= len(tokens) && hasTokenPrefix(tokens, at[:len(at)-1]) {
+			depth := len(at) - 1
+			parent, err := jsonpointer.Pointer(at[:depth]).Get(doc)
+			k, kerr := strconv.Atoi(at[depth])
+			j, jerr := strconv.Atoi(tokens[depth])
+			if _, isArray := parent.([]any); err == nil && isArray && kerr == nil && jerr == nil {
+				switch {
+				case d.Op == Add && j > k:
+					tokens[depth] = strconv.Itoa(j - 1)
+				case d.Op == Remove && j >= k:
+					tokens[depth] = strconv.Itoa(j + 1)
+				}
+			}
+		}
+		if doc, err = ApplyInPlace(doc, diff.reverse[len(diff.Deltas)-1-i:len(diff.Deltas)-i]); err != nil {
+			return -1
+		}
+	}
+	return -1
+}
+
+// pathsOverlap reports whether one JSON Pointer equals or contains the other.
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(b, a+"/") || strings.HasPrefix(a, b+"/")
+}
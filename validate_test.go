@@ -0,0 +1,136 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+var personSchema = mustCompileSchema(`{
+	"type": "object",
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true}
+	},
+	"additionalProperties": false
+}`)
+
+func mustCompileSchema(s string) *jsonpatch.Schema {
+	schema, err := jsonpatch.CompileSchema([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func TestApplyValidated(t *testing.T) {
+	doc := map[string]any{"name": "Ann", "age": 30.0, "tags": []any{"a"}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/name", Value: "Bea"},
+		{Op: jsonpatch.Add, Path: "/tags/-", Value: "b"},
+	}
+	got, err := jsonpatch.ApplyValidated(doc, patch, personSchema)
+	if err != nil {
+		t.Fatalf("ApplyValidated: %v", err)
+	}
+	want := map[string]any{"name": "Bea", "age": 30.0, "tags": []any{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if doc["name"] != "Ann" {
+		t.Fatalf("input document was modified: %v", doc)
+	}
+}
+
+func TestApplyValidatedAttributesViolations(t *testing.T) {
+	doc := map[string]any{"name": "Ann", "age": 30.0, "tags": []any{"a"}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/age", Value: "thirty"},
+		{Op: jsonpatch.Add, Path: "/tags/0", Value: "a"},
+		{Op: jsonpatch.Remove, Path: "/name"},
+		{Op: jsonpatch.Add, Path: "/extra", Value: true},
+	}
+	_, err := jsonpatch.ApplyValidated(doc, patch, personSchema)
+	var verr *jsonpatch.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want *ValidationError", err)
+	}
+
+	got := map[string]int{}
+	for _, v := range verr.Violations {
+		got[v.KeywordLocation] = v.Index
+	}
+	want := map[string]int{
+		"/required":                    2,
+		"/properties/age/type":         0,
+		"/properties/tags/uniqueItems": 1,
+		"/additionalProperties":        3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("violation indices = %v, want %v", got, want)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "operation 0 (replace '/age'): '/age': expected integer, got string") {
+		t.Errorf("error message %q does not name the offending operation", msg)
+	}
+}
+
+func TestApplyValidatedUntouchedViolation(t *testing.T) {
+	doc := map[string]any{"name": 1.0, "age": 3.0}
+	patch := jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/age", Value: 4.0}}
+	_, err := jsonpatch.ApplyValidated(doc, patch, personSchema)
+	var verr *jsonpatch.ValidationError
+	if !errors.As(err, &verr) || len(verr.Violations) != 1 {
+		t.Fatalf("error = %v, want one violation", err)
+	}
+	if v := verr.Violations[0]; v.Index != -1 || v.InstancePath != "/name" {
+		t.Fatalf("violation = %+v, want unattributed /name", v)
+	}
+}
+
+func TestApplyValidatedIndexShift(t *testing.T) {
+	schema := mustCompileSchema(`{"properties": {"items": {"items": {"properties": {"age": {"type": "integer"}}}}}}`)
+	doc := map[string]any{"items": []any{map[string]any{"age": 1.0}, map[string]any{"age": 2.0}}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/items/1/age", Value: "two"},
+		{Op: jsonpatch.Add, Path: "/items/0", Value: map[string]any{"age": 0.0}},
+		{Op: jsonpatch.Remove, Path: "/items/0"},
+		{Op: jsonpatch.Add, Path: "/items/0", Value: map[string]any{"age": 0.0}},
+	}
+	_, err := jsonpatch.ApplyValidated(doc, patch, schema)
+	var verr *jsonpatch.ValidationError
+	if !errors.As(err, &verr) || len(verr.Violations) != 1 {
+		t.Fatalf("error = %v, want one violation", err)
+	}
+	if v := verr.Violations[0]; v.Index != 0 || v.InstancePath != "/items/2/age" {
+		t.Fatalf("violation = %+v, want /items/2/age attributed to operation 0", v)
+	}
+}
+
+func TestPrepareDeltaIndex(t *testing.T) {
+	doc := map[string]any{"a": 1.0, "b": []any{1.0}}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/a", Value: 2.0},
+		{Op: jsonpatch.Move, From: "/a", Path: "/b/0"},
+	}
+	diff, err := jsonpatch.Prepare(doc, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, d := range diff.Deltas {
+		got = append(got, d.Index)
+	}
+	if want := []int{0, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("delta indices = %v, want %v", got, want)
+	}
+	b, _ := json.Marshal(diff.Deltas[0])
+	if !strings.Contains(string(b), `"index":0`) {
+		t.Errorf("delta JSON %s lacks index", b)
+	}
+}
@@ -0,0 +1,777 @@
+package jsonpatch
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// ApplyValue applies patch directly to the Go value ptr points to, using
+// reflection instead of a JSON round trip. Structs are addressed by their json
+// field names, maps must have string or integer keys, and slices and arrays by
+// index; pointers and interfaces are followed. Struct fields always exist:
+// removing one resets it to its zero value. Types implementing json.Marshaler
+// and json.Unmarshaler are converted through JSON.
+//
+// Values that cannot be assigned to their destination are reported as a
+// *FieldError wrapped in an *Error. Like ApplyInPlace, the value may be
+// partially modified when an operation fails.
+func ApplyValue(ptr any, patch Patch) error {
+	root, err := NewValueNode(ptr)
+	if err != nil {
+		return err
+	}
+	return applyNodePatch(root, patch)
+}
+
+// NewValueNode returns a Node for the Go value ptr points to, using the same
+// mapping as ApplyValue.
+func NewValueNode(ptr any) (Node, error) {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return nil, fmt.Errorf("jsonpatch: a non-nil pointer is required, got %T", ptr)
+	}
+	elem := rv.Elem()
+	name := elem.Type().Name()
+	if name == "" {
+		name = elem.Type().String()
+	}
+	return &reflectNode{doc: &reflectDoc{name: name}, v: elem}, nil
+}
+
+// reflectDoc holds state shared by all nodes of one ApplyValue call.
+type reflectDoc struct {
+	name string // root type name, for FieldError
+}
+
+// reflectNode adapts a settable reflect.Value. Values that are not addressable
+// in place, such as map elements, are copied; commit stores the copy back into
+// its container after a change.
+type reflectNode struct {
+	doc    *reflectDoc
+	v      reflect.Value
+	path   []string
+	commit func()
+}
+
+func (n *reflectNode) done() error {
+	if n.commit != nil {
+		n.commit()
+	}
+	return nil
+}
+
+// target follows non-nil pointers from the node's slot.
+func (n *reflectNode) target() reflect.Value {
+	v := n.v
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// dynamic returns a node for the value held by a non-nil interface, or nil.
+func (n *reflectNode) dynamic() Node {
+	slot := n.target()
+	if slot.Kind() != reflect.Interface || slot.IsNil() {
+		return nil
+	}
+	e := slot.Elem()
+	if slot.NumMethod() == 0 {
+		switch e.Interface().(type) {
+		case map[string]any, []any:
+			return &DocumentNode{v: e.Interface(), set: func(nv any) {
+				if nv == nil {
+					slot.Set(reflect.Zero(slot.Type()))
+				} else {
+					slot.Set(reflect.ValueOf(nv))
+				}
+				n.done()
+			}}
+		}
+	}
+	cp := reflect.New(e.Type()).Elem()
+	cp.Set(e)
+	return &reflectNode{doc: n.doc, v: cp, path: n.path, commit: func() {
+		slot.Set(cp)
+		n.done()
+	}}
+}
+
+func (n *reflectNode) child(token string, v reflect.Value, commit func()) *reflectNode {
+	path := make([]string, len(n.path), len(n.path)+1)
+	copy(path, n.path)
+	return &reflectNode{doc: n.doc, v: v, path: append(path, token), commit: commit}
+}
+
+func (n *reflectNode) Kind() NodeKind {
+	if d := n.dynamic(); d != nil {
+		return d.Kind()
+	}
+	t := n.target()
+	if isJSONMarshaler(t) {
+		return ScalarNode
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return ObjectNode
+	case reflect.Slice:
+		if t.Type().Elem().Kind() == reflect.Uint8 {
+			return ScalarNode
+		}
+		return ArrayNode
+	case reflect.Array:
+		return ArrayNode
+	}
+	return ScalarNode
+}
+
+func (n *reflectNode) Len() int {
+	if d := n.dynamic(); d != nil {
+		return d.Len()
+	}
+	switch t := n.target(); n.Kind() {
+	case ObjectNode:
+		return len(n.Keys())
+	case ArrayNode:
+		return t.Len()
+	}
+	return 0
+}
+
+func (n *reflectNode) Keys() []string {
+	if d := n.dynamic(); d != nil {
+		return d.Keys()
+	}
+	if n.Kind() != ObjectNode {
+		return nil
+	}
+	t := n.target()
+	var keys []string
+	if t.Kind() == reflect.Struct {
+		for _, f := range cachedFields(t.Type()) {
+			fv, ok := fieldByIndex(t, f.index, false)
+			if ok && !(f.omitEmpty && isEmptyValue(fv)) {
+				keys = append(keys, f.name)
+			}
+		}
+		return keys
+	}
+	for _, k := range t.MapKeys() {
+		if s, err := mapKeyString(k); err == nil {
+			keys = append(keys, s)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (n *reflectNode) Child(token string) (Node, error) {
+	if d := n.dynamic(); d != nil {
+		return d.Child(token)
+	}
+	t := n.target()
+	if isJSONMarshaler(t) {
+		return nil, fmt.Errorf("cannot address '%s' in %s", token, t.Type())
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		f, ok := fieldNamed(t.Type(), token)
+		if !ok {
+			return nil, fmt.Errorf("%s has no field '%s'", t.Type(), token)
+		}
+		fv, ok := fieldByIndex(t, f.index, false)
+		if !ok {
+			return nil, fmt.Errorf("field '%s' of %s is behind a nil pointer", token, t.Type())
+		}
+		return n.child(token, fv, n.commit), nil
+	case reflect.Map:
+		key, err := mapKey(t.Type().Key(), token)
+		if err != nil {
+			return nil, err
+		}
+		mv := t.MapIndex(key)
+		if !mv.IsValid() {
+			return nil, fmt.Errorf("member '%s' does not exist", token)
+		}
+		cp := reflect.New(mv.Type()).Elem()
+		cp.Set(mv)
+		return n.child(token, cp, func() {
+			t.SetMapIndex(key, cp)
+			n.done()
+		}), nil
+	case reflect.Slice, reflect.Array:
+		if n.Kind() != ArrayNode {
+			break
+		}
+		idx, err := arrayIndex(token, t.Len())
+		if err != nil {
+			return nil, err
+		}
+		return n.child(token, t.Index(idx), n.commit), nil
+	case reflect.Pointer, reflect.Interface:
+		return nil, fmt.Errorf("cannot address '%s' in null", token)
+	}
+	return nil, fmt.Errorf("cannot address '%s' in %s", token, t.Type())
+}
+
+func (n *reflectNode) Add(token string, value any) error {
+	if d := n.dynamic(); d != nil {
+		return d.Add(token, value)
+	}
+	t := n.target()
+	switch {
+	case n.Kind() == ObjectNode && t.Kind() == reflect.Struct:
+		f, ok := fieldNamed(t.Type(), token)
+		if !ok {
+			return fmt.Errorf("%s has no field '%s'", t.Type(), token)
+		}
+		fv, _ := fieldByIndex(t, f.index, true)
+		if err := n.doc.assign(fv, value, n.pathTo(token)); err != nil {
+			return err
+		}
+		return n.done()
+	case n.Kind() == ObjectNode && t.Kind() == reflect.Map:
+		key, err := mapKey(t.Type().Key(), token)
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(t.Type().Elem()).Elem()
+		if err := n.doc.assign(elem, value, n.pathTo(token)); err != nil {
+			return err
+		}
+		if t.IsNil() {
+			t.Set(reflect.MakeMap(t.Type()))
+		}
+		t.SetMapIndex(key, elem)
+		return n.done()
+	case n.Kind() == ArrayNode && t.Kind() == reflect.Slice:
+		idx := t.Len()
+		if token != "-" {
+			i, err := jsonpointer.ParseArrayIndex(token)
+			if err != nil {
+				return err
+			}
+			if i > uint64(t.Len()) {
+				return fmt.Errorf("add operation on array index %d is out of bounds for array of length %d", i, t.Len())
+			}
+			idx = int(i)
+		}
+		elem := reflect.New(t.Type().Elem()).Elem()
+		if err := n.doc.assign(elem, value, n.pathTo(strconv.Itoa(idx))); err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(t.Type(), 0, t.Len()+1)
+		s = reflect.AppendSlice(s, t.Slice(0, idx))
+		s = reflect.Append(s, elem)
+		s = reflect.AppendSlice(s, t.Slice(idx, t.Len()))
+		t.Set(s)
+		return n.done()
+	case n.Kind() == ArrayNode:
+		return fmt.Errorf("cannot add to fixed-size array %s", t.Type())
+	}
+	return fmt.Errorf("cannot add '%s' to %s", token, t.Type())
+}
+
+func (n *reflectNode) Remove(token string) error {
+	if d := n.dynamic(); d != nil {
+		return d.Remove(token)
+	}
+	t := n.target()
+	switch {
+	case n.Kind() == ObjectNode && t.Kind() == reflect.Struct:
+		f, ok := fieldNamed(t.Type(), token)
+		if !ok {
+			return fmt.Errorf("%s has no field '%s'", t.Type(), token)
+		}
+		if fv, ok := fieldByIndex(t, f.index, false); ok {
+			fv.Set(reflect.Zero(fv.Type()))
+		}
+		return n.done()
+	case n.Kind() == ObjectNode && t.Kind() == reflect.Map:
+		key, err := mapKey(t.Type().Key(), token)
+		if err != nil {
+			return err
+		}
+		if !t.MapIndex(key).IsValid() {
+			return fmt.Errorf("member '%s' does not exist", token)
+		}
+		t.SetMapIndex(key, reflect.Value{})
+		return n.done()
+	case n.Kind() == ArrayNode && t.Kind() == reflect.Slice:
+		idx, err := arrayIndex(token, t.Len())
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(t.Type(), 0, t.Len()-1)
+		s = reflect.AppendSlice(s, t.Slice(0, idx))
+		s = reflect.AppendSlice(s, t.Slice(idx+1, t.Len()))
+		t.Set(s)
+		return n.done()
+	case n.Kind() == ArrayNode:
+		return fmt.Errorf("cannot remove from fixed-size array %s", t.Type())
+	}
+	return fmt.Errorf("cannot remove '%s' from %s", token, t.Type())
+}
+
+func (n *reflectNode) Set(value any) error {
+	if err := n.doc.assign(n.v, value, n.path); err != nil {
+		return err
+	}
+	return n.done()
+}
+
+func (n *reflectNode) Value() (any, error) {
+	return toJSONValue(n.v)
+}
+
+func (n *reflectNode) pathTo(token string) []string {
+	return append(append([]string(nil), n.path...), token)
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeFor[json.Marshaler]()
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// isJSONMarshaler reports whether v encodes itself, so it is treated as opaque.
+func isJSONMarshaler(v reflect.Value) bool {
+	if !v.IsValid() || v.Kind() == reflect.Interface {
+		return false
+	}
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	pt := reflect.PointerTo(t)
+	return v.CanAddr() && (pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType))
+}
+
+// toJSONValue converts v into encoding/json's representation, following the
+// encoding rules of encoding/json.
+func toJSONValue(v reflect.Value) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() != reflect.Pointer && isJSONMarshaler(v) {
+		x := v.Interface()
+		if v.CanAddr() {
+			x = v.Addr().Interface()
+		}
+		b, err := json.Marshal(x)
+		if err != nil {
+			return nil, err
+		}
+		var out any
+		err = json.Unmarshal(b, &out)
+		return out, err
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toJSONValue(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		fallthrough
+	case reflect.Array:
+		out := make([]any, v.Len())
+		for i := range out {
+			e, err := toJSONValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = e
+		}
+		return out, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := mapKeyString(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if out[k], err = toJSONValue(iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case reflect.Struct:
+		out := make(map[string]any)
+		for _, f := range cachedFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			e, err := toJSONValue(fv)
+			if err != nil {
+				return nil, err
+			}
+			out[f.name] = e
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("jsonpatch: unsupported type %s", v.Type())
+}
+
+// assign stores src into the settable dst. src is usually in encoding/json's
+// representation; other Go values are converted first.
+func (d *reflectDoc) assign(dst reflect.Value, src any, path []string) error {
+	if src != nil {
+		if sv := reflect.ValueOf(src); sv.Type().AssignableTo(dst.Type()) {
+			dst.Set(sv)
+			return nil
+		}
+	}
+	switch src.(type) {
+	case nil, bool, float64, string, map[string]any, []any:
+	default:
+		converted, err := toJSONValue(reflect.ValueOf(src))
+		if err != nil {
+			return err
+		}
+		src = converted
+	}
+
+	if dst.Kind() != reflect.Pointer && dst.CanAddr() {
+		pt := dst.Addr().Type()
+		if pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+			b, err := json.Marshal(src)
+			if err != nil {
+				return err
+			}
+			dst.Set(reflect.Zero(dst.Type()))
+			if err := json.Unmarshal(b, dst.Addr().Interface()); err != nil {
+				return d.fieldError(dst, src, path, err)
+			}
+			return nil
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.NumMethod() == 0 {
+			dst.Set(reflect.ValueOf(src))
+			return nil
+		}
+	case reflect.Pointer:
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		e := reflect.New(dst.Type().Elem())
+		if err := d.assign(e.Elem(), src, path); err != nil {
+			return err
+		}
+		dst.Set(e)
+		return nil
+	case reflect.Bool:
+		if b, ok := src.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.String:
+		if s, ok := src.(string); ok {
+			dst.SetString(s)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f, ok := src.(float64); ok && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 && !dst.OverflowInt(int64(f)) {
+			dst.SetInt(int64(f))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f, ok := src.(float64); ok && f == math.Trunc(f) && f >= 0 && f < math.MaxUint64 && !dst.OverflowUint(uint64(f)) {
+			dst.SetUint(uint64(f))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := src.(float64); ok && !dst.OverflowFloat(f) {
+			dst.SetFloat(f)
+			return nil
+		}
+	case reflect.Slice:
+		switch s := src.(type) {
+		case nil:
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		case string:
+			if dst.Type().Elem().Kind() != reflect.Uint8 {
+				break
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return d.fieldError(dst, src, path, err)
+			}
+			dst.SetBytes(b)
+			return nil
+		case []any:
+			out := reflect.MakeSlice(dst.Type(), len(s), len(s))
+			for i, e := range s {
+				if err := d.assign(out.Index(i), e, append(path, strconv.Itoa(i))); err != nil {
+					return err
+				}
+			}
+			dst.Set(out)
+			return nil
+		}
+	case reflect.Array:
+		if s, ok := src.([]any); ok && len(s) <= dst.Len() {
+			out := reflect.New(dst.Type()).Elem()
+			for i, e := range s {
+				if err := d.assign(out.Index(i), e, append(path, strconv.Itoa(i))); err != nil {
+					return err
+				}
+			}
+			dst.Set(out)
+			return nil
+		}
+	case reflect.Map:
+		switch m := src.(type) {
+		case nil:
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		case map[string]any:
+			out := reflect.MakeMapWithSize(dst.Type(), len(m))
+			for k, e := range m {
+				key, err := mapKey(dst.Type().Key(), k)
+				if err != nil {
+					return d.fieldError(dst, src, path, err)
+				}
+				elem := reflect.New(dst.Type().Elem()).Elem()
+				if err := d.assign(elem, e, append(path, k)); err != nil {
+					return err
+				}
+				out.SetMapIndex(key, elem)
+			}
+			dst.Set(out)
+			return nil
+		}
+	case reflect.Struct:
+		if m, ok := src.(map[string]any); ok {
+			out := reflect.New(dst.Type()).Elem()
+			for k, e := range m {
+				f, ok := fieldNamed(dst.Type(), k)
+				if !ok {
+					return d.fieldError(dst, src, path, fmt.Errorf("%s has no field '%s'", dst.Type(), k))
+				}
+				fv, _ := fieldByIndex(out, f.index, true)
+				if err := d.assign(fv, e, append(path, k)); err != nil {
+					return err
+				}
+			}
+			dst.Set(out)
+			return nil
+		}
+	}
+	return d.fieldError(dst, src, path, nil)
+}
+
+func (d *reflectDoc) fieldError(dst reflect.Value, src any, path []string, err error) error {
+	return &FieldError{Struct: d.name, Field: strings.Join(path, "."), Value: describeJSONValue(src), Type: dst.Type(), Err: err}
+}
+
+// describeJSONValue describes a value the way encoding/json's UnmarshalTypeError does.
+func describeJSONValue(v any) string {
+	switch tv := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number " + strconv.FormatFloat(tv, 'g', -1, 64)
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func mapKey(t reflect.Type, token string) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(token).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(token, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid %s map key '%s'", t, token)
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(token, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid %s map key '%s'", t, token)
+		}
+		return reflect.ValueOf(u).Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported map key type %s", t)
+}
+
+func mapKeyString(k reflect.Value) (string, error) {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("jsonpatch: unsupported map key type %s", k.Type())
+}
+
+// isEmptyValue reports whether omitempty drops v, as in encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// structField is a JSON-visible struct field, possibly promoted from an embedded struct.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type -> []structField
+
+func cachedFields(t reflect.Type) []structField {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]structField)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]structField)
+}
+
+func fieldNamed(t reflect.Type, name string) (structField, bool) {
+	for _, f := range cachedFields(t) {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// typeFields lists the JSON fields of t. Fields of untagged embedded structs
+// are promoted; shallower fields win over deeper ones with the same name.
+func typeFields(t reflect.Type) []structField {
+	type level struct {
+		t     reflect.Type
+		index []int
+	}
+	var fields []structField
+	seen := make(map[string]bool)
+	for current := []level{{t: t}}; len(current) > 0; {
+		var next []level
+		depthNames := make(map[string]bool)
+		for _, l := range current {
+			for i := 0; i < l.t.NumField(); i++ {
+				sf := l.t.Field(i)
+				index := append(append([]int(nil), l.index...), i)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				if sf.Anonymous && name == "" {
+					ft := sf.Type
+					if ft.Kind() == reflect.Pointer {
+						if !sf.IsExported() {
+							continue
+						}
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						next = append(next, level{t: ft, index: index})
+						continue
+					}
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				if name == "" {
+					name = sf.Name
+				}
+				if seen[name] {
+					continue
+				}
+				depthNames[name] = true
+				fields = append(fields, structField{name: name, index: index, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+			}
+		}
+		for name := range depthNames {
+			seen[name] = true
+		}
+		current = next
+	}
+	return fields
+}
+
+// fieldByIndex returns the field at index, following embedded pointers. With
+// alloc set nil embedded pointers are allocated; otherwise ok is false when
+// one is nil.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
@@ -0,0 +1,151 @@
+package jsonpatch_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+type testBase struct {
+	ID string `json:"id"`
+}
+
+type testItem struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty"`
+}
+
+type testOrder struct {
+	testBase
+	Items    []testItem          `json:"items"`
+	ByName   map[string]testItem `json:"byName,omitempty"`
+	Counts   map[int]uint8       `json:"counts,omitempty"`
+	Note     *string             `json:"note,omitempty"`
+	Extra    any                 `json:"extra,omitempty"`
+	Fixed    [2]int              `json:"fixed"`
+	Created  time.Time           `json:"created"`
+	internal int
+}
+
+func TestApplyValue(t *testing.T) {
+	order := testOrder{
+		testBase: testBase{ID: "o1"},
+		Items:    []testItem{{SKU: "a", Qty: 1}, {SKU: "b", Qty: 2}},
+		ByName:   map[string]testItem{"a": {SKU: "a", Qty: 1}},
+		Extra:    map[string]any{"tags": []any{"x"}},
+	}
+	patch := jsonpatch.Patch{
+		{Op: jsonpatch.Test, Path: "/id", Value: "o1"},
+		{Op: jsonpatch.Replace, Path: "/id", Value: "o2"},
+		{Op: jsonpatch.Add, Path: "/items/1", Value: map[string]any{"sku": "c", "qty": 3.0}},
+		{Op: jsonpatch.Replace, Path: "/items/0/qty", Value: 5},
+		{Op: jsonpatch.Remove, Path: "/items/2"},
+		{Op: jsonpatch.Replace, Path: "/byName/a/qty", Value: 7.0},
+		{Op: jsonpatch.Copy, From: "/items/1", Path: "/byName/c"},
+		{Op: jsonpatch.Add, Path: "/counts/3", Value: 4.0},
+		{Op: jsonpatch.Add, Path: "/note", Value: "fragile"},
+		{Op: jsonpatch.Add, Path: "/extra/tags/-", Value: "y"},
+		{Op: jsonpatch.Replace, Path: "/fixed/1", Value: 9.0},
+		{Op: jsonpatch.Replace, Path: "/created", Value: "2024-01-02T03:04:05Z"},
+		{Op: jsonpatch.Move, From: "/byName/a", Path: "/byName/z"},
+		{Op: jsonpatch.Test, Path: "/byName/z", Value: map[string]any{"sku": "a", "qty": 7.0}},
+	}
+	if err := jsonpatch.ApplyValue(&order, patch); err != nil {
+		t.Fatalf("ApplyValue: %v", err)
+	}
+
+	note := "fragile"
+	want := testOrder{
+		testBase: testBase{ID: "o2"},
+		Items:    []testItem{{SKU: "a", Qty: 5}, {SKU: "c", Qty: 3}},
+		ByName:   map[string]testItem{"z": {SKU: "a", Qty: 7}, "c": {SKU: "c", Qty: 3}},
+		Counts:   map[int]uint8{3: 4},
+		Note:     &note,
+		Extra:    map[string]any{"tags": []any{"x", "y"}},
+		Fixed:    [2]int{0, 9},
+		Created:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("got  %+v\nwant %+v", order, want)
+	}
+}
+
+func TestApplyValueRemoveField(t *testing.T) {
+	note := "x"
+	order := testOrder{Note: &note, Items: []testItem{{SKU: "a"}}}
+	if err := jsonpatch.ApplyValue(&order, jsonpatch.Patch{
+		{Op: jsonpatch.Remove, Path: "/note"},
+		{Op: jsonpatch.Remove, Path: "/items"},
+	}); err != nil {
+		t.Fatalf("ApplyValue: %v", err)
+	}
+	if order.Note != nil || order.Items != nil {
+		t.Fatalf("fields not reset: %+v", order)
+	}
+}
+
+func TestApplyValueMapRoot(t *testing.T) {
+	m := map[string][]int{"a": {1}}
+	if err := jsonpatch.ApplyValue(&m, jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/a/0", Value: 0.0},
+		{Op: jsonpatch.Add, Path: "/b", Value: []any{2.0}},
+	}); err != nil {
+		t.Fatalf("ApplyValue: %v", err)
+	}
+	if want := map[string][]int{"a": {0, 1}, "b": {2}}; !reflect.DeepEqual(m, want) {
+		t.Fatalf("got %v, want %v", m, want)
+	}
+	if err := jsonpatch.ApplyValue(&m, jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "", Value: map[string]any{}}}); err != nil {
+		t.Fatalf("replace root: %v", err)
+	}
+	if len(m) != 0 {
+		t.Fatalf("root not replaced: %v", m)
+	}
+}
+
+func TestApplyValueErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    jsonpatch.Operation
+		field string
+	}{
+		{"string into int", jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/items/0/qty", Value: "many"}, "items.0.qty"},
+		{"fraction into int", jsonpatch.Operation{Op: jsonpatch.Replace, Path: "/items/0/qty", Value: 1.5}, "items.0.qty"},
+		{"overflow", jsonpatch.Operation{Op: jsonpatch.Add, Path: "/counts/1", Value: 300.0}, "counts.1"},
+		{"unknown nested field", jsonpatch.Operation{Op: jsonpatch.Add, Path: "/items/-", Value: map[string]any{"color": "red"}}, "items.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := testOrder{Items: []testItem{{SKU: "a"}}}
+			err := jsonpatch.ApplyValue(&order, jsonpatch.Patch{tt.op})
+			var ferr *jsonpatch.FieldError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("error = %v, want *FieldError", err)
+			}
+			if ferr.Struct != "testOrder" || ferr.Field != tt.field {
+				t.Fatalf("FieldError = %+v, want field %s", ferr, tt.field)
+			}
+		})
+	}
+
+	order := testOrder{}
+	for _, op := range []jsonpatch.Operation{
+		{Op: jsonpatch.Add, Path: "/missing", Value: 1.0},
+		{Op: jsonpatch.Remove, Path: "/byName/x"},
+		{Op: jsonpatch.Add, Path: "/fixed/0", Value: 1.0},
+		{Op: jsonpatch.Replace, Path: "/items/0", Value: map[string]any{}},
+		{Op: jsonpatch.Test, Path: "/id", Value: "nope"},
+		{Op: jsonpatch.Add, Path: "/internal", Value: 1.0},
+	} {
+		var perr *jsonpatch.Error
+		if err := jsonpatch.ApplyValue(&order, jsonpatch.Patch{op}); !errors.As(err, &perr) {
+			t.Errorf("%s %s: error = %v, want *Error", op.Op, op.Path, err)
+		}
+	}
+	if err := jsonpatch.ApplyValue(order, nil); err == nil {
+		t.Error("ApplyValue on a non-pointer succeeded")
+	}
+}
@@ -0,0 +1,325 @@
+package jsonpatch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/agentflare-ai/go-jsonpointer"
+)
+
+// Change is what a subscription sees of an applied patch at one matched location.
+type Change struct {
+	// Path is the concrete location matched by the subscription's pattern.
+	Path string
+	// From is set when inserts or removals in an enclosing array moved the
+	// watched location; it is the location before the patch. A change that
+	// only reports such a move has no deltas.
+	From string
+	// Deltas are the deltas at or below Path, with paths relative to Path.
+	// A delta with the empty path means the value at Path was added, replaced
+	// or removed as a whole.
+	Deltas []Delta
+	// Patch is the forward patch of Deltas, applicable to the value at Path.
+	// It ends in a remove of "" if the value at Path was removed.
+	Patch Patch
+}
+
+// Watcher dispatches the changes of applied patches to subscriptions on parts
+// of a document. Feed it the Diff of every patch with Notify. A Watcher is
+// safe for concurrent use.
+type Watcher struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription is a registration made with Watcher.Watch.
+type Subscription struct {
+	w       *Watcher
+	pattern []string
+	fn      func([]Change)
+}
+
+// NewWatcher returns a Watcher without subscriptions.
+func NewWatcher() *Watcher {
+	return &Watcher{subs: make(map[*Subscription]struct{})}
+}
+
+// Watch subscribes fn to changes at and below the locations matching pattern.
+// Patterns use the syntax of Rule.Path: "*" matches one reference token and
+// "**" any number of tokens.
+//
+// When an array element is inserted or removed before an array index in the
+// literal prefix of the pattern (the tokens before the first wildcard), the
+// index is shifted so the subscription keeps following the same element. If
+// that element is removed, the subscription stays at its index.
+//
+// fn is called once per Notify that affects the subscription, with one Change
+// per matched location, from the goroutine calling Notify.
+func (w *Watcher) Watch(pattern string, fn func([]Change)) (*Subscription, error) {
+	tokens, err := jsonpointer.New(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s := &Subscription{w: w, pattern: tokens, fn: fn}
+	w.mu.Lock()
+	w.subs[s] = struct{}{}
+	w.mu.Unlock()
+	return s, nil
+}
+
+// Pattern returns the subscription's pattern, with array indices shifted by
+// the changes seen so far.
+func (s *Subscription) Pattern() string {
+	s.w.mu.Lock()
+	defer s.w.mu.Unlock()
+	return jsonpointer.Pointer(s.pattern).String()
+}
+
+// Cancel removes the subscription. fn is not called after Cancel returns,
+// unless a concurrent Notify already collected its changes.
+func (s *Subscription) Cancel() {
+	s.w.mu.Lock()
+	delete(s.w.subs, s)
+	s.w.mu.Unlock()
+}
+
+// Notify dispatches the deltas of diff, the result of preparing a patch
+// against document, to the subscriptions they affect. The deltas are replayed
+// on a copy of document to tell array elements from object members when
+// translating index shifts.
+func (w *Watcher) Notify(document any, diff Diff) {
+	type delivery struct {
+		fn      func([]Change)
+		changes []Change
+	}
+	var out []delivery
+
+	w.mu.Lock()
+	var inArray []bool
+	if len(w.subs) > 0 {
+		inArray = deltasInArray(document, diff)
+	}
+	for s := range w.subs {
+		if changes := s.collect(inArray, diff.Deltas); len(changes) > 0 {
+			out = append(out, delivery{fn: s.fn, changes: changes})
+		}
+	}
+	w.mu.Unlock()
+
+	for _, d := range out {
+		d.fn(d.changes)
+	}
+}
+
+// deltasInArray reports for each delta of diff whether its parent is an array
+// when it is applied to document.
+func deltasInArray(document any, diff Diff) []bool {
+	out := make([]bool, len(diff.Deltas))
+	doc := cloneValue(document)
+	for i, d := range diff.Deltas {
+		_, out[i] = parentArray(doc, d.Path)
+		var err error
+		if doc, err = ApplyInPlace(doc, Patch{deltaOperation(d)}); err != nil {
+			break
+		}
+	}
+	return out
+}
+
+// collect matches deltas against the subscription, shifting its pattern as
+// array elements are inserted and removed; inArray tells which deltas
+// insert or remove array elements. Callers hold the watcher's lock.
+func (s *Subscription) collect(inArray []bool, deltas []Delta) []Change {
+	var changes []Change
+	byPath := make(map[string]int)
+	add := func(base, from string, d Delta) {
+		i, ok := byPath[base]
+		if !ok {
+			i = len(changes)
+			byPath[base] = i
+			changes = append(changes, Change{Path: base})
+		}
+		if from != "" {
+			if changes[i].From == "" {
+				changes[i].From = from
+			}
+			return
+		}
+		changes[i].Deltas = append(changes[i].Deltas, d)
+		changes[i].Patch = append(changes[i].Patch, deltaOperation(d))
+	}
+
+	for i, d := range deltas {
+		tokens, err := jsonpointer.New(d.Path)
+		if err != nil {
+			continue
+		}
+		// Shift first: an insert or removal that moves the watched element
+		// does not touch it.
+		if from, moved := s.shift(tokens, d.Op, inArray[i]); moved {
+			to := jsonpointer.Pointer(s.literalPrefix()).String()
+			// Follow the shift in the changes collected so far.
+			for i := range changes {
+				p := changes[i].Path
+				if p != from && !strings.HasPrefix(p, from+"/") {
+					continue
+				}
+				delete(byPath, p)
+				changes[i].Path = to + p[len(from):]
+				byPath[changes[i].Path] = i
+				if changes[i].From == "" {
+					changes[i].From = p
+				}
+			}
+			if len(s.literalPrefix()) == len(s.pattern) {
+				add(to, from, Delta{})
+			}
+		}
+
+		if k := s.matchPrefix(tokens); k >= 0 {
+			rel := d
+			rel.Path = jsonpointer.Pointer(tokens[k:]).String()
+			add(jsonpointer.Pointer(tokens[:k]).String(), "", rel)
+		} else if matchPattern(s.pattern, tokens, true) {
+			// The delta wrote an ancestor of the matched locations.
+			for _, m := range s.matchBelow(tokens, d) {
+				add(jsonpointer.Pointer(append(tokens[:len(tokens):len(tokens)], m.rel...)).String(), "", m.delta)
+			}
+		}
+	}
+	return changes
+}
+
+// matchPrefix returns the length of the shortest prefix of tokens matching
+// the pattern, or -1.
+func (s *Subscription) matchPrefix(tokens []string) int {
+	for k := 0; k <= len(tokens); k++ {
+		if matchPattern(s.pattern, tokens[:k], false) {
+			return k
+		}
+	}
+	return -1
+}
+
+type watchMatch struct {
+	rel   []string
+	delta Delta
+}
+
+// matchBelow finds the locations matching the pattern inside the values the
+// delta d at tokens replaced and wrote, and describes how each one changed.
+func (s *Subscription) matchBelow(tokens []string, d Delta) []watchMatch {
+	type sides struct {
+		before, after       any
+		hasBefore, hasAfter bool
+	}
+	found := make(map[string]*sides)
+	var order [][]string
+	var walk func(v any, rel []string, after bool)
+	walk = func(v any, rel []string, after bool) {
+		full := append(append([]string(nil), tokens...), rel...)
+		if matchPattern(s.pattern, full, false) {
+			key := jsonpointer.Pointer(rel).String()
+			sd, ok := found[key]
+			if !ok {
+				sd = &sides{}
+				found[key] = sd
+				order = append(order, append([]string(nil), rel...))
+			}
+			if after {
+				sd.after, sd.hasAfter = v, true
+			} else {
+				sd.before, sd.hasBefore = v, true
+			}
+			return
+		}
+		if !matchPattern(s.pattern, full, true) {
+			return
+		}
+		switch c := v.(type) {
+		case map[string]any:
+			keys := make([]string, 0, len(c))
+			for k := range c {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(c[k], append(rel, k), after)
+			}
+		case []any:
+			for i, e := range c {
+				walk(e, append(rel, strconv.Itoa(i)), after)
+			}
+		}
+	}
+	if d.ExistedBefore {
+		walk(d.Before, nil, false)
+	}
+	if d.ExistedAfter {
+		walk(d.After, nil, true)
+	}
+
+	out := make([]watchMatch, 0, len(order))
+	for _, rel := range order {
+		sd := found[jsonpointer.Pointer(rel).String()]
+		delta := Delta{Op: Replace, Index: d.Index, Before: sd.before, After: sd.after, ExistedBefore: sd.hasBefore, ExistedAfter: sd.hasAfter}
+		switch {
+		case !sd.hasBefore:
+			delta.Op = Add
+		case !sd.hasAfter:
+			delta.Op = Remove
+		}
+		out = append(out, watchMatch{rel: rel, delta: delta})
+	}
+	return out
+}
+
+// literalPrefix returns the pattern tokens before the first wildcard.
+func (s *Subscription) literalPrefix() []string {
+	for i, tok := range s.pattern {
+		if tok == "*" || tok == "**" {
+			return s.pattern[:i]
+		}
+	}
+	return s.pattern
+}
+
+// shift moves an array index in the literal prefix of the pattern when the
+// delta inserts or removes an element before it, and returns the previous
+// location of that prefix. inArray tells whether the delta's parent is an array.
+func (s *Subscription) shift(tokens []string, op Op, inArray bool) (string, bool) {
+	if (op != Add && op != Remove) || len(tokens) == 0 || !inArray {
+		return "", false
+	}
+	lit := s.literalPrefix()
+	depth := len(tokens) - 1
+	if depth >= len(lit) || !hasTokenPrefix(lit, tokens[:depth]) {
+		return "", false
+	}
+	at, err1 := strconv.Atoi(tokens[depth])
+	idx, err2 := strconv.Atoi(lit[depth])
+	if err1 != nil || err2 != nil {
+		return "", false
+	}
+	switch {
+	case op == Add && at <= idx:
+		idx++
+	case op == Remove && at < idx:
+		idx--
+	default:
+		return "", false
+	}
+	from := jsonpointer.Pointer(lit).String()
+	s.pattern[depth] = strconv.Itoa(idx)
+	return from, true
+}
+
+// deltaOperation returns the forward operation of a delta.
+func deltaOperation(d Delta) Operation {
+	if d.Op == Remove {
+		return Operation{Op: Remove, Path: d.Path}
+	}
+	return Operation{Op: d.Op, Path: d.Path, Value: d.After}
+}
@@ -0,0 +1,150 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/agentflare-ai/go-jsonpatch"
+)
+
+// watchApply prepares patch against doc, notifies w and returns the patched document.
+func watchApply(t *testing.T, w *jsonpatch.Watcher, doc any, patch jsonpatch.Patch) any {
+	t.Helper()
+	diff, err := jsonpatch.Prepare(doc, patch)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	w.Notify(doc, diff)
+	out, err := jsonpatch.Apply(doc, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func recordChanges(t *testing.T, w *jsonpatch.Watcher, pattern string) *[]string {
+	t.Helper()
+	var got []string
+	_, err := w.Watch(pattern, func(changes []jsonpatch.Change) {
+		for _, c := range changes {
+			b, err := json.Marshal(c.Patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := c.Path + " " + string(b)
+			if c.From != "" {
+				s = c.From + "->" + s
+			}
+			got = append(got, s)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &got
+}
+
+func TestWatcherPrefix(t *testing.T) {
+	w := jsonpatch.NewWatcher()
+	spec := recordChanges(t, w, "/spec")
+	names := recordChanges(t, w, "/users/*/name")
+
+	doc := any(map[string]any{
+		"spec":  map[string]any{"replicas": 1.0},
+		"users": []any{map[string]any{"name": "a"}},
+		"other": 0.0,
+	})
+	doc = watchApply(t, w, doc, jsonpatch.Patch{
+		{Op: jsonpatch.Replace, Path: "/spec/replicas", Value: 2.0},
+		{Op: jsonpatch.Replace, Path: "/other", Value: 1.0},
+		{Op: jsonpatch.Add, Path: "/users/-", Value: map[string]any{"name": "b", "age": 3.0}},
+		{Op: jsonpatch.Replace, Path: "/users/0/name", Value: "A"},
+	})
+	watchApply(t, w, doc, jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "", Value: map[string]any{"users": []any{}}}})
+
+	wantSpec := []string{
+		`/spec [{"op":"replace","path":"/replicas","value":2}]`,
+		`/spec [{"op":"remove","path":""}]`,
+	}
+	wantNames := []string{
+		`/users/1/name [{"op":"add","path":"","value":"b"}]`,
+		`/users/0/name [{"op":"replace","path":"","value":"A"}]`,
+		`/users/0/name [{"op":"remove","path":""}]`,
+		`/users/1/name [{"op":"remove","path":""}]`,
+	}
+	assertStrings(t, "spec", *spec, wantSpec)
+	assertStrings(t, "names", *names, wantNames)
+}
+
+func TestWatcherIndexShift(t *testing.T) {
+	w := jsonpatch.NewWatcher()
+	third := recordChanges(t, w, "/items/2")
+	sub, err := w.Watch("/items/2/tags/*", func([]jsonpatch.Change) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := any(map[string]any{"items": []any{
+		map[string]any{"id": "a"}, map[string]any{"id": "b"}, map[string]any{"id": "c", "tags": []any{}},
+	}})
+	doc = watchApply(t, w, doc, jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/items/0", Value: map[string]any{"id": "z"}},
+		{Op: jsonpatch.Replace, Path: "/items/3/id", Value: "C"},
+	})
+	doc = watchApply(t, w, doc, jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/items/1"}})
+	watchApply(t, w, doc, jsonpatch.Patch{{Op: jsonpatch.Remove, Path: "/items/2"}})
+
+	assertStrings(t, "third", *third, []string{
+		`/items/2->/items/3 [{"op":"replace","path":"/id","value":"C"}]`,
+		`/items/3->/items/2 null`,
+		`/items/2 [{"op":"remove","path":""}]`,
+	})
+	if got := sub.Pattern(); got != "/items/2/tags/*" {
+		t.Fatalf("Pattern() = %s", got)
+	}
+}
+
+func TestWatcherNestedIndexShift(t *testing.T) {
+	w := jsonpatch.NewWatcher()
+	sub, err := w.Watch("/list/0/items/1", func([]jsonpatch.Change) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := any(map[string]any{"list": []any{map[string]any{"items": []any{"a", "b"}}}})
+	// The second insert is into an array that only exists at /list/1 once
+	// the first one is applied.
+	watchApply(t, w, doc, jsonpatch.Patch{
+		{Op: jsonpatch.Add, Path: "/list/0", Value: map[string]any{"items": []any{}}},
+		{Op: jsonpatch.Add, Path: "/list/1/items/0", Value: "z"},
+	})
+	if got := sub.Pattern(); got != "/list/1/items/2" {
+		t.Fatalf("Pattern() = %s, want /list/1/items/2", got)
+	}
+}
+
+func TestWatcherCancel(t *testing.T) {
+	w := jsonpatch.NewWatcher()
+	calls := 0
+	sub, err := w.Watch("/a", func([]jsonpatch.Change) { calls++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := watchApply(t, w, map[string]any{"a": 1.0}, jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/a", Value: 2.0}})
+	sub.Cancel()
+	watchApply(t, w, doc, jsonpatch.Patch{{Op: jsonpatch.Replace, Path: "/a", Value: 3.0}})
+	if calls != 1 {
+		t.Fatalf("fn called %d times, want 1", calls)
+	}
+}
+
+func assertStrings(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d changes %q, want %q", name, len(got), got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s[%d] = %s, want %s", name, i, got[i], want[i])
+		}
+	}
+}